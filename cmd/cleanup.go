@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+	"github.com/spf13/cobra"
+)
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Drop the TPC-C dataset",
+	Long: `Drop the TPC-C tables, or collections for MongoDB, created by prepare.
+With --truncate the rows are deleted and the schema is kept for the next prepare.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dbname, _ := cmd.Root().PersistentFlags().GetString("db")
+		dbdriver, _ := cmd.Root().PersistentFlags().GetString("dbdriver")
+		uri, _ := cmd.Root().PersistentFlags().GetString("uri")
+		truncate, _ := cmd.Flags().GetBool("truncate")
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		if dbname == "" || uri == "" {
+			panic("empty")
+		}
+
+		action := "Drop"
+		if truncate {
+			action = "Truncate"
+		}
+
+		if !yes && !confirm(fmt.Sprintf("%s the TPC-C tables of database %s (%s)?", action, dbname, dbdriver)) {
+			fmt.Fprintln(os.Stderr, "Aborted")
+			os.Exit(1)
+		}
+
+		c := tpcc.Configuration{
+			DBDriver: dbdriver,
+			DBName:   dbname,
+			URI:      uri,
+		}
+
+		w, err := tpcc.NewWorker(context.Background(), &c, nil, nil, 0)
+		if err != nil {
+			panic(err)
+		}
+
+		if truncate {
+			fmt.Println("Truncating tables")
+			err = w.TruncateSchema()
+		} else {
+			fmt.Println("Dropping schema")
+			err = w.DropSchema()
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println("... done")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cleanupCmd)
+
+	cleanupCmd.Flags().Bool("truncate", false, "Delete all rows but keep the tables and indexes")
+	cleanupCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation")
+}
+
+// confirm asks a yes/no question on the terminal, anything but yes is a no
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
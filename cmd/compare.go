@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+	"github.com/spf13/cobra"
+)
+
+// compareCmd represents the compare command
+var compareCmd = &cobra.Command{
+	Use:   "compare BASELINE CANDIDATE",
+	Short: "Compare the results of two runs",
+	Long: `Compare the summaries of two runs written with --report-format json.
+
+Each threshold is METRIC=[+|-]PERCENT. A negative threshold fails when the
+metric drops by more than PERCENT, a positive one when it grows by more than
+PERCENT. Metrics are named like the fields of the JSON summary: tpmC, tps, trx,
+failed, timedOut and retries for the whole run, or TYPE.METRIC for a
+transaction type where METRIC is tps, trx, failed, timedOut, retries, min,
+mean, max or a percentile such as p95, for example NewOrder.p95=+10.
+
+The command exits with a non-zero status when a threshold is exceeded, and
+refuses the summary of an interrupted run, which does not cover the whole run.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// the arguments are fine from here on, errors are about the results
+		cmd.SilenceUsage = true
+
+		list, _ := cmd.Flags().GetStringSlice("threshold")
+
+		thresholds, err := parseThresholds(list)
+		if err != nil {
+			return err
+		}
+
+		baseline, err := readSummary(args[0])
+		if err != nil {
+			return err
+		}
+
+		candidate, err := readSummary(args[1])
+		if err != nil {
+			return err
+		}
+
+		if err := checkComplete(args[0], baseline); err != nil {
+			return err
+		}
+		if err := checkComplete(args[1], candidate); err != nil {
+			return err
+		}
+
+		printComparison(baseline, candidate)
+
+		failed := 0
+		for _, t := range thresholds {
+			ok, err := t.check(baseline, candidate)
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d thresholds exceeded", failed, len(thresholds))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().StringSlice("threshold", []string{"tpmC=-5", "NewOrder.p95=+10"}, "Regression thresholds as METRIC=[+|-]PERCENT")
+}
+
+// readSummary returns the summary record of a result file. The last one wins
+// so several runs appended to the same file compare their latest run.
+func readSummary(file string) (*runSummary, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var summary *runSummary
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		var s runSummary
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+
+		if s.Type == summaryRecord {
+			summary = &s
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	if summary == nil {
+		return nil, fmt.Errorf("%s: no summary record found, results must be written with --report-format json", file)
+	}
+
+	return summary, nil
+}
+
+// checkComplete fails for the summary of an interrupted run, its numbers only
+// cover the part of the run that was completed
+func checkComplete(file string, s *runSummary) error {
+	if s.Interrupted {
+		return fmt.Errorf("%s: the run was interrupted, its summary can not be compared", file)
+	}
+
+	return nil
+}
+
+// metric looks up a run metric such as "tpmC" or a per type metric such as "NewOrder.p95"
+func (s *runSummary) metric(name string) (float64, error) {
+	dot := strings.IndexByte(name, '.')
+	if dot < 0 {
+		switch name {
+		case "tpmC":
+			return s.TpmC, nil
+		case "tps":
+			return s.TPS, nil
+		case "trx":
+			return float64(s.Trx), nil
+		case "failed":
+			return float64(s.Failed), nil
+		case "timedOut":
+			return float64(s.TimedOut), nil
+		case "retries":
+			return float64(s.Retries), nil
+		}
+
+		return 0, fmt.Errorf("unknown metric %q", name)
+	}
+
+	ts, ok := s.Transactions[name[:dot]]
+	if !ok {
+		return 0, fmt.Errorf("unknown transaction type in metric %q", name)
+	}
+
+	switch key := name[dot+1:]; key {
+	case "tps":
+		if s.Duration == 0 {
+			return 0, nil
+		}
+		return float64(ts.Trx) / s.Duration, nil
+	case "trx":
+		return float64(ts.Trx), nil
+	case "failed":
+		return float64(ts.Failed), nil
+	case "timedOut":
+		return float64(ts.TimedOut), nil
+	case "retries":
+		return float64(ts.Retries), nil
+	default:
+		v, ok := ts.Latency[key]
+		if !ok {
+			return 0, fmt.Errorf("metric %q not found, was the run reporting this percentile?", name)
+		}
+		return v, nil
+	}
+}
+
+type threshold struct {
+	Metric string
+	// Percent is the allowed change, negative for metrics that must not drop
+	Percent float64
+}
+
+func parseThresholds(list []string) ([]threshold, error) {
+	var thresholds []threshold
+
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid threshold %q, use METRIC=[+|-]PERCENT", item)
+		}
+
+		p, err := strconv.ParseFloat(strings.TrimSuffix(kv[1], "%"), 64)
+		if err != nil || p == 0 {
+			return nil, fmt.Errorf("invalid threshold %q, use METRIC=[+|-]PERCENT", item)
+		}
+
+		thresholds = append(thresholds, threshold{Metric: kv[0], Percent: p})
+	}
+
+	return thresholds, nil
+}
+
+// check prints the verdict for the threshold and reports whether it holds
+func (t threshold) check(baseline, candidate *runSummary) (bool, error) {
+	b, err := baseline.metric(t.Metric)
+	if err != nil {
+		return false, err
+	}
+
+	c, err := candidate.metric(t.Metric)
+	if err != nil {
+		return false, err
+	}
+
+	delta := change(b, c)
+
+	ok := delta <= t.Percent
+	if t.Percent < 0 {
+		ok = delta >= t.Percent
+	}
+
+	verdict := "OK"
+	if !ok {
+		verdict = "FAIL"
+	}
+	fmt.Printf("%-4s %s %+.2f%% (threshold %+.2f%%)\n", verdict, t.Metric, delta, t.Percent)
+
+	return ok, nil
+}
+
+// change is the relative change from b to c in percent
+func change(b, c float64) float64 {
+	if b == 0 {
+		if c == 0 {
+			return 0
+		}
+		return math.Inf(int(math.Copysign(1, c)))
+	}
+
+	return (c - b) * 100 / math.Abs(b)
+}
+
+func printComparison(baseline, candidate *runSummary) {
+	row := func(name string) {
+		b, _ := baseline.metric(name)
+		c, _ := candidate.metric(name)
+		fmt.Printf("%-24s %12.2f %12.2f %+9.2f%%\n", name, b, c, change(b, c))
+	}
+
+	fmt.Printf("%-24s %12s %12s %10s\n", "Metric", "Baseline", "Candidate", "Delta")
+	for _, name := range []string{"tpmC", "tps", "failed", "timedOut", "retries"} {
+		row(name)
+	}
+
+	for _, t := range tpcc.TransactionTypes {
+		bt, ok := baseline.Transactions[t.String()]
+		if !ok {
+			continue
+		}
+		ct, ok := candidate.Transactions[t.String()]
+		if !ok {
+			continue
+		}
+
+		row(t.String() + ".tps")
+
+		// only the latencies both runs reported can be compared
+		var keys []string
+		for k := range bt.Latency {
+			if _, ok := ct.Latency[k]; ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return latencyOrder(keys[i]) < latencyOrder(keys[j])
+		})
+
+		for _, k := range keys {
+			row(t.String() + "." + k)
+		}
+	}
+
+	fmt.Println()
+}
+
+// latencyOrder sorts min, mean and the percentiles ascending, then max
+func latencyOrder(key string) float64 {
+	switch key {
+	case "min":
+		return -2
+	case "mean":
+		return -1
+	case "max":
+		return 101
+	}
+
+	p, _ := strconv.ParseFloat(strings.TrimPrefix(key, "p"), 64)
+	return p
+}
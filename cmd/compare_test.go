@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseThresholds(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    []string
+		want    []threshold
+		wantErr bool
+	}{
+		{"drop", []string{"tpmC=-5"}, []threshold{{"tpmC", -5}}, false},
+		{"growth", []string{"NewOrder.p95=+10"}, []threshold{{"NewOrder.p95", 10}}, false},
+		{"unsigned is growth", []string{"failed=3"}, []threshold{{"failed", 3}}, false},
+		{"percent sign", []string{"tps=-2.5%"}, []threshold{{"tps", -2.5}}, false},
+		{"spaces and empty items", []string{" tpmC=-5 ", ""}, []threshold{{"tpmC", -5}}, false},
+		{"no value", []string{"tpmC"}, nil, true},
+		{"no metric", []string{"=-5"}, nil, true},
+		{"not a number", []string{"tpmC=-five"}, nil, true},
+		{"zero", []string{"tpmC=0"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseThresholds(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("thresholds = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultThresholds(t *testing.T) {
+	list, err := compareCmd.Flags().GetStringSlice("threshold")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := parseThresholds(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []threshold{{"tpmC", -5}, {"NewOrder.p95", 10}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("default thresholds = %v, want %v", got, want)
+	}
+}
+
+func TestChange(t *testing.T) {
+	tests := []struct {
+		b, c float64
+		want float64
+	}{
+		{100, 95, -5},
+		{100, 110, 10},
+		{-10, -5, 50},
+		{0, 0, 0},
+		{0, 1, math.Inf(1)},
+		{0, -1, math.Inf(-1)},
+	}
+
+	for _, tt := range tests {
+		if got := change(tt.b, tt.c); got != tt.want {
+			t.Errorf("change(%v, %v) = %v, want %v", tt.b, tt.c, got, tt.want)
+		}
+	}
+}
+
+func testSummary(tpmC, p95 float64) *runSummary {
+	return &runSummary{
+		Type:     summaryRecord,
+		Duration: 10,
+		Trx:      1000,
+		TPS:      100,
+		TpmC:     tpmC,
+		Failed:   4,
+		TimedOut: 2,
+		Retries:  7,
+		Transactions: map[string]*typeSummary{
+			"NewOrder": {Trx: 450, Failed: 3, TimedOut: 1, Retries: 5, Latency: map[string]float64{"min": 0.5, "p95": p95}},
+		},
+	}
+}
+
+func TestMetric(t *testing.T) {
+	s := testSummary(6000, 12)
+
+	tests := []struct {
+		name    string
+		want    float64
+		wantErr bool
+	}{
+		{"tpmC", 6000, false},
+		{"tps", 100, false},
+		{"trx", 1000, false},
+		{"failed", 4, false},
+		{"timedOut", 2, false},
+		{"retries", 7, false},
+		{"NewOrder.tps", 45, false},
+		{"NewOrder.trx", 450, false},
+		{"NewOrder.failed", 3, false},
+		{"NewOrder.timedOut", 1, false},
+		{"NewOrder.retries", 5, false},
+		{"NewOrder.min", 0.5, false},
+		{"NewOrder.p95", 12, false},
+		{"Trx", 0, true},
+		{"latency", 0, true},
+		{"Payment.p95", 0, true},
+		{"NewOrder.p99", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.metric(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("metric = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThresholdCheck(t *testing.T) {
+	baseline := testSummary(6000, 10)
+
+	tests := []struct {
+		name      string
+		threshold threshold
+		candidate *runSummary
+		want      bool
+	}{
+		{"drop within", threshold{"tpmC", -5}, testSummary(5760, 10), true},
+		{"drop beyond", threshold{"tpmC", -5}, testSummary(5640, 10), false},
+		{"growth passes a drop threshold", threshold{"tpmC", -5}, testSummary(9000, 10), true},
+		{"growth within", threshold{"NewOrder.p95", 10}, testSummary(6000, 10.5), true},
+		{"growth beyond", threshold{"NewOrder.p95", 10}, testSummary(6000, 11.5), false},
+		{"drop passes a growth threshold", threshold{"NewOrder.p95", 10}, testSummary(6000, 2), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.threshold.check(baseline, tt.candidate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("check = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (threshold{"NewOrder.p99", 10}).check(baseline, baseline); err == nil {
+		t.Error("check of a missing metric succeeded")
+	}
+}
+
+func TestCompareInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, summary string) string {
+		file := filepath.Join(dir, name)
+		data := `{"type":"interval","time":1,"duration":1,"trx":10}` + "\n" + summary + "\n"
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	// the default thresholds need tpmC and the New-Order p95
+	complete := write("complete.json", `{"type":"summary","duration":10,"trx":100,"tpmC":600,"transactions":{"NewOrder":{"trx":45,"latency":{"p95":12}}}}`)
+	interrupted := write("interrupted.json", `{"type":"summary","duration":4,"trx":40,"tpmC":600,"transactions":{"NewOrder":{"trx":18,"latency":{"p95":12}}},"interrupted":true}`)
+
+	for _, args := range [][]string{{complete, interrupted}, {interrupted, complete}} {
+		err := compareCmd.RunE(compareCmd, args)
+		if err == nil || !strings.Contains(err.Error(), "interrupted") {
+			t.Errorf("compare %v: err = %v, want the interrupted run refused", args, err)
+		}
+	}
+
+	if err := compareCmd.RunE(compareCmd, []string{complete, complete}); err != nil {
+		t.Errorf("compare of complete runs: %v", err)
+	}
+}
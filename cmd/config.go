@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// envPrefix is the prefix of the environment variables setting options,
+// e.g. GOTPCC_WAREHOUSES or GOTPCC_RUN_REPORT_FORMAT
+const envPrefix = "GOTPCC"
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+}
+
+var configDumpCmd = &cobra.Command{
+	Use:   "dump [COMMAND...]",
+	Short: "Print the effective configuration",
+	Long: `Print the options of every command, or of the given ones, as they result
+from the config file, the GOTPCC_* environment variables and the defaults. The
+output is a valid config file, the source of every value is in a comment.
+
+Options can be set for all commands at the top level of the config file or the
+environment (warehouses, GOTPCC_WAREHOUSES), or for a single command in its
+section (run.warehouses, GOTPCC_RUN_WAREHOUSES). Command line flags take
+precedence over the environment, which takes precedence over the config file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if used := viper.ConfigFileUsed(); used != "" {
+			fmt.Printf("# config file: %s\n", used)
+		}
+
+		dumpFlags(cmd.Root().PersistentFlags(), "", "")
+
+		for _, c := range cmd.Root().Commands() {
+			if !c.IsAvailableCommand() || c == configCmd {
+				continue
+			}
+			if len(args) > 0 && !contains(args, c.Name()) {
+				continue
+			}
+
+			fmt.Printf("%s:\n", c.Name())
+			dumpFlags(c.LocalNonPersistentFlags(), c.Name(), "  ")
+			dumpFlags(c.PersistentFlags(), c.Name(), "  ")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configDumpCmd)
+}
+
+func dumpFlags(flags *pflag.FlagSet, section string, indent string) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if skipConfig(f) {
+			return
+		}
+
+		value, source := f.Value.String(), "default"
+		if f.Changed {
+			source = "flag"
+		} else if v, s, ok := configValue(section, f.Name); ok {
+			value, source = v, s
+		}
+
+		if f.Value.Type() == "string" {
+			value = fmt.Sprintf("%q", value)
+		}
+
+		fmt.Printf("%s%s: %s # %s\n", indent, f.Name, value, source)
+	})
+}
+
+// applyConfig sets the flags of cmd that were not given on the command line
+// from the environment or the config file
+func applyConfig(cmd *cobra.Command) error {
+	section := commandSection(cmd)
+
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || skipConfig(f) {
+			return
+		}
+
+		value, source, ok := configValue(section, f.Name)
+		if !ok {
+			return
+		}
+
+		values, e := listValues(f, value, source)
+		if e != nil {
+			err = fmt.Errorf("invalid value %q for %s from %s: %v", value, f.Name, source, e)
+			return
+		}
+
+		// Changed is left alone, it keeps telling whether the flag was
+		// given on the command line
+		for _, v := range values {
+			if e := f.Value.Set(v); e != nil {
+				err = fmt.Errorf("invalid value %q for %s from %s: %v", v, f.Name, source, e)
+				return
+			}
+		}
+	})
+
+	return err
+}
+
+// listValues splits the value of a list flag into the values to set it to,
+// one per occurrence on the command line. A list in the config file gives one
+// value per item, items may contain commas. Any other value is comma
+// separated as by a string slice flag, with double quotes around items that
+// contain commas.
+func listValues(f *pflag.Flag, value string, source string) ([]string, error) {
+	typ := f.Value.Type()
+	if typ != "stringArray" && typ != "stringSlice" {
+		return []string{value}, nil
+	}
+
+	if list, ok := viper.Get(strings.TrimPrefix(source, "file ")).([]interface{}); ok && strings.HasPrefix(source, "file ") {
+		values := make([]string, 0, len(list))
+		for _, item := range list {
+			v := fmt.Sprint(item)
+			if typ == "stringSlice" {
+				// the flag splits what it is set to
+				var err error
+				if v, err = writeCSV([]string{v}); err != nil {
+					return nil, err
+				}
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+
+	if typ == "stringSlice" || value == "" {
+		return []string{value}, nil
+	}
+
+	return csv.NewReader(strings.NewReader(value)).Read()
+}
+
+func writeCSV(items []string) (string, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	if err := w.Write(items); err != nil {
+		return "", err
+	}
+	w.Flush()
+
+	return strings.TrimSuffix(b.String(), "\n"), w.Error()
+}
+
+// configValue looks a flag up in the environment and then in the config
+// file. The command section wins over the top level in both.
+func configValue(section string, name string) (string, string, bool) {
+	var keys []string
+	if section != "" {
+		keys = append(keys, section+"."+name)
+	}
+	keys = append(keys, name)
+
+	for _, key := range keys {
+		env := envPrefix + "_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+		if v, ok := os.LookupEnv(env); ok {
+			return v, "env " + env, true
+		}
+	}
+
+	for _, key := range keys {
+		if viper.IsSet(key) {
+			return configString(viper.Get(key)), "file " + key, true
+		}
+	}
+
+	return "", "", false
+}
+
+// configString turns a config file value into flag syntax, lists become
+// comma separated
+func configString(v interface{}) string {
+	if list, ok := v.([]interface{}); ok {
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	}
+
+	return fmt.Sprint(v)
+}
+
+// commandSection is the config file section of cmd, the name of the top
+// level command it belongs to
+func commandSection(cmd *cobra.Command) string {
+	for cmd.HasParent() && cmd.Parent().HasParent() {
+		cmd = cmd.Parent()
+	}
+
+	if !cmd.HasParent() {
+		return ""
+	}
+
+	return cmd.Name()
+}
+
+func skipConfig(f *pflag.Flag) bool {
+	return f.Name == "help" || f.Name == "config" || f.Deprecated != ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newListCommand() *cobra.Command {
+	root := &cobra.Command{Use: "root"}
+	cmd := &cobra.Command{Use: "run"}
+	root.AddCommand(cmd)
+
+	cmd.Flags().StringArray("replica-uri", nil, "")
+	cmd.Flags().StringSlice("threshold", nil, "")
+
+	return cmd
+}
+
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Unsetenv(key) })
+}
+
+func TestApplyConfigListsFromEnv(t *testing.T) {
+	setenv(t, "GOTPCC_RUN_REPLICA_URI", `a,"mongodb://b,c/"`)
+	setenv(t, "GOTPCC_RUN_THRESHOLD", "tpmC=-5,tps=-2")
+
+	cmd := newListCommand()
+	if err := applyConfig(cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	uris, _ := cmd.Flags().GetStringArray("replica-uri")
+	if want := []string{"a", "mongodb://b,c/"}; !reflect.DeepEqual(uris, want) {
+		t.Errorf("replica-uri = %q, want %q", uris, want)
+	}
+
+	thresholds, _ := cmd.Flags().GetStringSlice("threshold")
+	if want := []string{"tpmC=-5", "tps=-2"}; !reflect.DeepEqual(thresholds, want) {
+		t.Errorf("threshold = %q, want %q", thresholds, want)
+	}
+}
+
+func TestApplyConfigListsFromFile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+run:
+  replica-uri:
+    - a
+    - mongodb://b,c/
+  threshold:
+    - tpmC=-5
+    - a,b=+1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newListCommand()
+	if err := applyConfig(cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	uris, _ := cmd.Flags().GetStringArray("replica-uri")
+	if want := []string{"a", "mongodb://b,c/"}; !reflect.DeepEqual(uris, want) {
+		t.Errorf("replica-uri = %q, want %q", uris, want)
+	}
+
+	thresholds, _ := cmd.Flags().GetStringSlice("threshold")
+	if want := []string{"tpmC=-5", "a,b=+1"}; !reflect.DeepEqual(thresholds, want) {
+		t.Errorf("threshold = %q, want %q", thresholds, want)
+	}
+}
+
+func TestApplyConfigInvalidList(t *testing.T) {
+	setenv(t, "GOTPCC_RUN_REPLICA_URI", `a,b"c`)
+
+	if err := applyConfig(newListCommand()); err == nil {
+		t.Error("a malformed list was accepted")
+	}
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// addScaleFlags adds the options setting the cardinalities of the dataset
+// one by one, on top of --scalefactor
+func addScaleFlags(flags *pflag.FlagSet) {
+	flags.Int("items", -1, "Number of items, -1 derives it from --scalefactor")
+	flags.Int("districts", -1, "Districts per warehouse, at most 10, -1 for the TPC-C 10")
+	flags.Int("customers", -1, "Customers per district, -1 derives it from --scalefactor")
+	flags.Int("orders", -1, "Initial orders per district, -1 derives it from --scalefactor")
+	flags.Int("new-orders", -1, "Initial new orders per district, the latest of the orders, -1 derives it from --scalefactor")
+}
+
+// scaleOption is a cardinality with the option setting it
+type scaleOption struct {
+	flag  string
+	value func(s *tpcc.ScaleParameters) *int
+}
+
+var scaleOptions = []scaleOption{
+	{"items", func(s *tpcc.ScaleParameters) *int { return &s.Items }},
+	{"districts", func(s *tpcc.ScaleParameters) *int { return &s.DistrictsPerWarehouse }},
+	{"customers", func(s *tpcc.ScaleParameters) *int { return &s.CustomersPerDistrict }},
+	{"orders", func(s *tpcc.ScaleParameters) *int { return &s.OrdersPerDistrict }},
+	{"new-orders", func(s *tpcc.ScaleParameters) *int { return &s.NewOrdersPerDistrict }},
+}
+
+// scaleConfig sets the cardinalities of c from --scalefactor and the
+// options added by addScaleFlags
+func scaleConfig(flags *pflag.FlagSet, c *tpcc.Configuration) error {
+	s, err := tpcc.DefaultScaleParameters(c.ScaleFactor, c.WareHouses)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range scaleOptions {
+		if n, _ := flags.GetInt(o.flag); n >= 0 {
+			*o.value(s) = n
+		}
+	}
+
+	c.Scale = s
+	return s.Validate()
+}
+
+// datasetConfig replaces the cardinalities of c, set by scaleConfig, with
+// those stored by prepare. The ones given explicitly must match, and at most
+// the stored number of warehouses can be used. Datasets without metadata
+// are used as the options describe them.
+func datasetConfig(cmd *cobra.Command, flags *pflag.FlagSet, c *tpcc.Configuration) error {
+	w, err := tpcc.NewWorker(context.Background(), c, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	stored, err := w.LoadMetadata()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can not read the dataset metadata, using the options as given: %v\n", err)
+		return nil
+	}
+	if stored == nil {
+		fmt.Fprintln(os.Stderr, "The dataset has no metadata, using the options as given")
+		return nil
+	}
+
+	scaled := given(cmd, flags, "scalefactor")
+	for _, o := range scaleOptions {
+		n, _ := flags.GetInt(o.flag)
+		if n < 0 && !scaled {
+			continue
+		}
+
+		requested, actual := *o.value(c.Scale), *o.value(stored)
+		if requested != actual {
+			return fmt.Errorf("%s is %d with the given options but the dataset was prepared with %d", o.flag, requested, actual)
+		}
+	}
+
+	if !given(cmd, flags, "warehouses") {
+		c.WareHouses = stored.Warehouses
+	} else if c.WareHouses > stored.Warehouses {
+		return fmt.Errorf("%d warehouses requested but the dataset was prepared with %d", c.WareHouses, stored.Warehouses)
+	}
+
+	c.Scale = stored
+	return nil
+}
+
+// given tells whether an option was set on the command line, in the
+// environment or in the config file rather than left to its default
+func given(cmd *cobra.Command, flags *pflag.FlagSet, name string) bool {
+	if flags.Changed(name) {
+		return true
+	}
+
+	_, _, ok := configValue(commandSection(cmd), name)
+	return ok
+}
+
+// storageConfig is the storage profile with the table options of the storage
+// section of the config file over it, e.g.
+//
+//	storage:
+//	  all:
+//	    row_format: COMPRESSED
+//	  order_line:
+//	    key_block_size: 4
+func storageConfig(profile string) databases.Storage {
+	s := databases.Storage{
+		Profile: profile,
+		Tables:  make(map[string]databases.StorageOptions),
+	}
+
+	for key := range viper.GetStringMap("storage") {
+		options := databases.StorageOptions(viper.GetStringMapString("storage." + key))
+		if key == "all" {
+			s.All = options
+		} else {
+			s.Tables[strings.ToUpper(key)] = options
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+)
+
+// downtimeWindow is a period in which at least one worker had lost its
+// connection, the overlapping downtimes of the workers merged
+type downtimeWindow struct {
+	// Start is in seconds since the start of the measurement
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration"`
+	// Workers is the number of workers that lost their connection
+	Workers int `json:"workers"`
+	// Attempts is the number of connections opened to reconnect them
+	Attempts int `json:"attempts"`
+}
+
+type workerDowntime struct {
+	databases.Downtime
+	thread int
+}
+
+// downtimes collects the downtimes reported with the transactions
+type downtimes struct {
+	list []workerDowntime
+}
+
+func (d *downtimes) add(trx tpcc.Transaction) {
+	for _, dt := range trx.Downtimes {
+		d.list = append(d.list, workerDowntime{Downtime: dt, thread: trx.ThreadId})
+	}
+}
+
+// windows merges the downtimes into windows, start is the start of the
+// measurement
+func (d *downtimes) windows(start time.Time) []*downtimeWindow {
+	list := append([]workerDowntime(nil), d.list...)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Start.Before(list[j].Start)
+	})
+
+	var windows []*downtimeWindow
+	var end time.Time
+	var threads map[int]bool
+	for _, dt := range list {
+		if len(windows) == 0 || dt.Start.After(end) {
+			windows = append(windows, &downtimeWindow{Start: dt.Start.Sub(start).Seconds()})
+			end = dt.End
+			threads = make(map[int]bool)
+		}
+
+		w := windows[len(windows)-1]
+		if dt.End.After(end) {
+			end = dt.End
+		}
+		w.Duration = end.Sub(start).Seconds() - w.Start
+		w.Attempts += dt.Attempts
+		if !threads[dt.thread] {
+			threads[dt.thread] = true
+			w.Workers++
+		}
+	}
+
+	return windows
+}
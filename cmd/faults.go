@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"github.com/spf13/viper"
+)
+
+// loadFaults reads the faults to inject from a config file, the format is
+// given by its extension
+func loadFaults(path string) (*databases.Faults, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading faults: %w", err)
+	}
+
+	faults := &databases.Faults{}
+	if err := v.UnmarshalExact(faults); err != nil {
+		return nil, fmt.Errorf("reading faults from %s: %w", path, err)
+	}
+
+	if err := faults.Validate(); err != nil {
+		return nil, fmt.Errorf("faults of %s: %w", path, err)
+	}
+
+	return faults, nil
+}
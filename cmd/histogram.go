@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+)
+
+// Latencies are recorded in microseconds, from 1µs up to one hour
+// with 3 significant digits
+const (
+	histogramLowest  = 1
+	histogramHighest = int64(time.Hour / time.Microsecond)
+	histogramDigits  = 3
+)
+
+func newHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(histogramLowest, histogramHighest, histogramDigits)
+}
+
+// latencyStats keeps an interval and a cumulative histogram per transaction type
+type latencyStats struct {
+	start      time.Time
+	interval   map[tpcc.TransactionType]*hdrhistogram.Histogram
+	cumulative map[tpcc.TransactionType]*hdrhistogram.Histogram
+}
+
+func newLatencyStats(start time.Time) *latencyStats {
+	l := &latencyStats{
+		start:      start,
+		interval:   make(map[tpcc.TransactionType]*hdrhistogram.Histogram),
+		cumulative: make(map[tpcc.TransactionType]*hdrhistogram.Histogram),
+	}
+
+	for _, t := range tpcc.TransactionTypes {
+		l.interval[t] = newHistogram()
+		l.interval[t].SetTag(t.String())
+		l.interval[t].SetStartTimeMs(msec(start))
+		l.cumulative[t] = newHistogram()
+		l.cumulative[t].SetTag(t.String())
+		l.cumulative[t].SetStartTimeMs(msec(start))
+	}
+
+	return l
+}
+
+// record adds a latency given in milliseconds, as reported by the workers
+func (l *latencyStats) record(t tpcc.TransactionType, ms float64) {
+	recordLatency(l.interval[t], ms)
+	recordLatency(l.cumulative[t], ms)
+}
+
+func recordLatency(h *hdrhistogram.Histogram, ms float64) {
+	v := int64(ms * 1000)
+	if v < histogramLowest {
+		v = histogramLowest
+	}
+	if v > histogramHighest {
+		v = histogramHighest
+	}
+
+	h.RecordValue(v)
+}
+
+// closeInterval stamps the end of the current interval on the interval histograms
+func (l *latencyStats) closeInterval(end time.Time) {
+	for _, t := range tpcc.TransactionTypes {
+		l.interval[t].SetEndTimeMs(msec(end))
+		l.cumulative[t].SetEndTimeMs(msec(end))
+	}
+}
+
+// resetInterval starts a new interval
+func (l *latencyStats) resetInterval(start time.Time) {
+	for _, t := range tpcc.TransactionTypes {
+		l.interval[t].Reset()
+		l.interval[t].SetStartTimeMs(msec(start))
+	}
+}
+
+// resetCumulative starts the cumulative histograms over, for a measurement
+// that starts after the first intervals
+func (l *latencyStats) resetCumulative(start time.Time) {
+	l.start = start
+	for _, t := range tpcc.TransactionTypes {
+		l.cumulative[t].Reset()
+		l.cumulative[t].SetStartTimeMs(msec(start))
+	}
+}
+
+// latencySummary is a histogram reduced to the numbers we report, in milliseconds
+type latencySummary struct {
+	Count       int64
+	Min         float64
+	Mean        float64
+	Max         float64
+	Percentiles []float64
+}
+
+func summarize(h *hdrhistogram.Histogram, percentiles []float64) latencySummary {
+	s := latencySummary{
+		Count: h.TotalCount(),
+	}
+
+	if s.Count == 0 {
+		s.Percentiles = make([]float64, len(percentiles))
+		return s
+	}
+
+	s.Min = float64(h.Min()) / 1000
+	s.Mean = h.Mean() / 1000
+	s.Max = float64(h.Max()) / 1000
+	for _, p := range percentiles {
+		s.Percentiles = append(s.Percentiles, float64(h.ValueAtPercentile(p))/1000)
+	}
+
+	return s
+}
+
+// parsePercentiles parses a comma separated list such as "50,90,95,99,99.9"
+func parsePercentiles(list string) ([]float64, error) {
+	var percentiles []float64
+
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		p, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentile %q", item)
+		}
+
+		if p <= 0 || p > 100 {
+			return nil, fmt.Errorf("percentile %q out of range (0, 100]", item)
+		}
+
+		percentiles = append(percentiles, p)
+	}
+
+	if len(percentiles) == 0 {
+		return nil, fmt.Errorf("no percentiles given")
+	}
+
+	return percentiles, nil
+}
+
+func percentileName(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// hlogWriter writes interval histograms in the HdrHistogram log format (.hlog)
+// so they can be processed with the standard HdrHistogram tools
+type hlogWriter struct {
+	w    io.Writer
+	base time.Time
+}
+
+func newHlogWriter(w io.Writer, base time.Time) (*hlogWriter, error) {
+	lw := hdrhistogram.NewHistogramLogWriter(w)
+
+	if err := lw.OutputLogFormatVersion(); err != nil {
+		return nil, err
+	}
+	if err := lw.OutputComment("[Latencies in microseconds, interval max in milliseconds, tagged by transaction type]"); err != nil {
+		return nil, err
+	}
+	if err := lw.OutputStartTime(msec(base)); err != nil {
+		return nil, err
+	}
+	if err := lw.OutputBaseTime(msec(base)); err != nil {
+		return nil, err
+	}
+	if err := lw.OutputLegend(); err != nil {
+		return nil, err
+	}
+
+	return &hlogWriter{w: w, base: base}, nil
+}
+
+// write outputs one line per transaction type for the current interval.
+// The line layout is Tag=<type>,<start sec>,<length sec>,<max ms>,<payload>
+// with the start relative to the base time.
+func (hw *hlogWriter) write(l *latencyStats) error {
+	for _, t := range tpcc.TransactionTypes {
+		h := l.interval[t]
+
+		payload, err := h.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(hw.w, "Tag=%s,%.3f,%.3f,%.3f,%s\n",
+			h.Tag(),
+			float64(h.StartTimeMs()-msec(hw.base))/1000,
+			float64(h.EndTimeMs()-h.StartTimeMs())/1000,
+			float64(h.Max())/1000,
+			payload,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func msec(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+)
+
+// Index build strategies of prepare
+const (
+	// indexBuildBefore creates the secondary indexes on the empty tables
+	indexBuildBefore = "before"
+	// indexBuildAfter creates them one by one once the data is loaded
+	indexBuildAfter = "after"
+	// indexBuildConcurrent creates them online once the data is loaded, the
+	// tables in parallel
+	indexBuildConcurrent = "concurrent"
+)
+
+func parseIndexBuild(s string) (string, error) {
+	switch s {
+	case indexBuildBefore, indexBuildAfter, indexBuildConcurrent:
+		return s, nil
+	}
+
+	return "", fmt.Errorf("unknown index build %q, use %s|%s|%s", s, indexBuildBefore, indexBuildAfter, indexBuildConcurrent)
+}
+
+// splitIndexes separates the secondary indexes from the foreign keys
+func splitIndexes(all []databases.Index) ([]databases.Index, []databases.Index) {
+	var indexes, foreignKeys []databases.Index
+	for _, index := range all {
+		if index.ForeignKey {
+			foreignKeys = append(foreignKeys, index)
+		} else {
+			indexes = append(indexes, index)
+		}
+	}
+
+	return indexes, foreignKeys
+}
+
+// buildIndexes creates the indexes and prints how long each one took. With
+// more than one thread the tables are built in parallel, each on its own
+// connection, the indexes of a table one after the other.
+func buildIndexes(c *tpcc.Configuration, indexes []databases.Index, threads int, online bool) error {
+	var tables [][]databases.Index
+	position := make(map[string]int)
+	for _, index := range indexes {
+		p, ok := position[index.Table]
+		if !ok {
+			p = len(tables)
+			position[index.Table] = p
+			tables = append(tables, nil)
+		}
+		tables[p] = append(tables[p], index)
+	}
+
+	if threads > len(tables) {
+		threads = len(tables)
+	}
+
+	jobs := make(chan []databases.Index, len(tables))
+	for _, t := range tables {
+		jobs <- t
+	}
+	close(jobs)
+
+	var mu sync.Mutex
+	var firstErr error
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			w, err := tpcc.NewWorker(context.Background(), c, nil, nil, i)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+
+			for table := range jobs {
+				for _, index := range table {
+					start := time.Now()
+					err := w.CreateIndex(index, online)
+					d := time.Since(start)
+
+					mu.Lock()
+					if err != nil && firstErr == nil {
+						firstErr = fmt.Errorf("creating %s: %w", index, err)
+					}
+					failed := firstErr != nil
+					if err == nil {
+						fmt.Printf("%s created in %s\n", index, d.Round(time.Millisecond))
+					}
+					mu.Unlock()
+
+					if failed {
+						return
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return firstErr
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics are exposed to Prometheus during a run when --metrics-addr is set
+type metrics struct {
+	transactions *prometheus.CounterVec
+	retries      *prometheus.CounterVec
+	errors       *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		transactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "tpcc",
+			Name:      "transactions_total",
+			Help:      "Transactions executed, by transaction type and outcome (ok, failed, timeout).",
+		}, []string{"type", "outcome"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "tpcc",
+			Name:      "retries_total",
+			Help:      "Transactions retried after a conflict, by transaction type.",
+		}, []string{"type"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "tpcc",
+			Name:      "errors_total",
+			Help:      "Failed transactions by transaction type and error class.",
+		}, []string{"type", "class"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "tpcc",
+			Name:      "transaction_duration_seconds",
+			Help:      "Transaction latency, by transaction type.",
+			// 0.5ms up to ~16s
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}, []string{"type"}),
+	}
+
+	reg.MustRegister(m.transactions, m.retries, m.errors, m.latency)
+
+	return m
+}
+
+func (m *metrics) observe(trx tpcc.Transaction) {
+	t := trx.Type.String()
+
+	outcome := "ok"
+	switch {
+	case trx.TimedOut:
+		outcome = "timeout"
+	case trx.Failed:
+		outcome = "failed"
+	}
+
+	m.transactions.WithLabelValues(t, outcome).Inc()
+	m.latency.WithLabelValues(t).Observe(trx.Time / 1000)
+
+	if trx.Retries > 0 {
+		m.retries.WithLabelValues(t).Add(float64(trx.Retries))
+	}
+
+	if trx.Failed {
+		class := trx.Error
+		if class == databases.ClassNone {
+			class = databases.ClassOther
+		}
+		m.errors.WithLabelValues(t, string(class)).Inc()
+	}
+}
+
+// serveMetrics starts the /metrics endpoint on addr. The run labels are
+// attached to every metric so runs can be told apart on shared dashboards.
+func serveMetrics(addr string, labels prometheus.Labels) (*metrics, error) {
+	reg := prometheus.NewRegistry()
+	m := newMetrics(prometheus.WrapRegistererWith(labels, reg))
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+
+	go func() {
+		err := http.Serve(ln, mux)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "metrics endpoint stopped:", err)
+		}
+	}()
+
+	return m, nil
+}
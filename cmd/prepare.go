@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 	"github.com/spf13/cobra"
 	"github.com/Percona-Lab/go-tpcc/tpcc"
 )
@@ -22,6 +23,13 @@ var prepareCmd = &cobra.Command{
 
 		uri, _ := cmd.Root().PersistentFlags().GetString("uri")
 		trx,_ := cmd.Root().PersistentFlags().GetBool("trx")
+		verify, _ := cmd.PersistentFlags().GetBool("verify")
+		partitions, _ := cmd.PersistentFlags().GetInt("partitions")
+		partitionBy, _ := cmd.PersistentFlags().GetString("partition-by")
+		foreignKeys, _ := cmd.PersistentFlags().GetBool("foreign-keys")
+		indexProfile, _ := cmd.PersistentFlags().GetString("index-profile")
+		storageProfile, _ := cmd.PersistentFlags().GetString("storage-profile")
+		indexBuild_, _ := cmd.PersistentFlags().GetString("index-build")
 
 		wj := make(chan int, warehouses)
 		wr := make(chan int, warehouses)
@@ -45,6 +53,21 @@ var prepareCmd = &cobra.Command{
 			ScaleFactor:    scalefactor,
 			URI: uri,
 			Transactions: trx,
+			Partitions: partitions,
+			PartitionBy: partitionBy,
+			ForeignKeys: foreignKeys,
+			IndexProfile: indexProfile,
+			Storage: storageConfig(storageProfile),
+		}
+
+		err := scaleConfig(cmd.PersistentFlags(), &c)
+		if err != nil {
+			panic(err)
+		}
+
+		indexBuild, err := parseIndexBuild(indexBuild_)
+		if err != nil {
+			panic(err)
 		}
 
 		ddl, err := tpcc.NewWorker(context.Background(), &c, nil, nil, 0)
@@ -59,8 +82,15 @@ var prepareCmd = &cobra.Command{
 		}
 		fmt.Println("... done")
 
-		if err != nil {
-			panic(err)
+		indexes, constraints := splitIndexes(ddl.Indexes())
+
+		if indexBuild == indexBuildBefore {
+			fmt.Println("Creating indexes")
+			err = buildIndexes(&c, indexes, 1, false)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Println("... done")
 		}
 
 		for i:=0; i < threads; i++ {
@@ -93,16 +123,36 @@ var prepareCmd = &cobra.Command{
 			<- wr
 		}
 
-		fmt.Println("Creating indexes")
-		ddl.CreateIndexes()
+		if indexBuild != indexBuildBefore {
+			fmt.Println("Creating indexes")
+			if indexBuild == indexBuildConcurrent {
+				err = buildIndexes(&c, indexes, threads, true)
+			} else {
+				err = buildIndexes(&c, indexes, 1, false)
+			}
+			if err != nil {
+				panic(err)
+			}
+			fmt.Println("... done")
+		}
+
+		if len(constraints) > 0 {
+			fmt.Println("Creating foreign keys")
+			err = buildIndexes(&c, constraints, 1, false)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Println("... done")
+		}
 
+		err = ddl.SaveMetadata()
 		if err != nil {
 			panic(err)
 		}
 
-
-
-		fmt.Println("... done")
+		if verify && !verifyLoad(&c, threads) {
+			os.Exit(1)
+		}
 
 	},
 }
@@ -113,6 +163,14 @@ func init() {
 	prepareCmd.PersistentFlags().Int("threads", 8, "Amount of threads that will be used when preparing. min(threads, warehouses) will be used at most")
 	prepareCmd.PersistentFlags().Int("warehouses", 10, "Number of warehouses to generate the data")
 	prepareCmd.PersistentFlags().Float64("scalefactor", 1, "Scale-factor")
+	addScaleFlags(prepareCmd.PersistentFlags())
+	prepareCmd.PersistentFlags().Bool("verify", true, "Check the row counts after loading")
+	prepareCmd.PersistentFlags().Int("partitions", 0, "Partition the tables keyed by warehouse into this many partitions by warehouse id (mysql and postgresql)")
+	prepareCmd.PersistentFlags().String("partition-by", "hash", "Partitioning method with --partitions: hash|range")
+	prepareCmd.PersistentFlags().Bool("foreign-keys", true, "Create the foreign keys (mysql and postgresql), must be false for partitioned mysql tables")
+	prepareCmd.PersistentFlags().String("index-profile", "standard", "Secondary indexes to create: minimal|standard|covering")
+	prepareCmd.PersistentFlags().String("index-build", "after", "When to create the secondary indexes: before|after|concurrent (after loading, online and the tables in parallel)")
+	prepareCmd.PersistentFlags().String("storage-profile", "default", "Storage preset of the driver for the tables, the storage section of the config file overrides its table options")
 
 	prepareCmd.Root().MarkFlagRequired("uri")
 	prepareCmd.Root().MarkFlagRequired("db")
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+)
+
+// stage is one step of the load profile of a run
+type stage struct {
+	Threads  int
+	Duration time.Duration
+	// Ramp adds threads evenly over the stage up to Threads instead of
+	// switching to Threads at once
+	Ramp bool
+}
+
+func (s stage) String() string {
+	if s.Ramp {
+		return fmt.Sprintf("ramp-up to %d threads for %s", s.Threads, s.Duration)
+	}
+
+	return fmt.Sprintf("%d threads for %s", s.Threads, s.Duration)
+}
+
+// loadProfile builds the stages of a run. Without --ramp-up or --stages it
+// is a single stage of threads for ttime seconds.
+func loadProfile(threads int, ttime int, rampUp time.Duration, stages string) ([]stage, error) {
+	if stages != "" {
+		if rampUp > 0 {
+			return nil, fmt.Errorf("--ramp-up and --stages can not be used together")
+		}
+
+		return parseStages(stages)
+	}
+
+	if threads < 1 {
+		return nil, fmt.Errorf("threads must be at least 1, got %d", threads)
+	}
+
+	profile := []stage{{Threads: threads, Duration: time.Duration(ttime) * time.Second}}
+	if rampUp > 0 {
+		profile = append([]stage{{Threads: threads, Duration: rampUp, Ramp: true}}, profile...)
+	}
+
+	return profile, nil
+}
+
+// parseStages parses a step schedule such as "8@60s,16@60s,32@60s"
+func parseStages(list string) ([]stage, error) {
+	var profile []stage
+
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "@", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid stage %q, use THREADS@DURATION", item)
+		}
+
+		threads, err := strconv.Atoi(parts[0])
+		if err != nil || threads < 1 {
+			return nil, fmt.Errorf("invalid number of threads in stage %q", item)
+		}
+
+		d, err := time.ParseDuration(parts[1])
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration in stage %q", item)
+		}
+
+		profile = append(profile, stage{Threads: threads, Duration: d})
+	}
+
+	if len(profile) == 0 {
+		return nil, fmt.Errorf("no stages given")
+	}
+
+	return profile, nil
+}
+
+// pool starts and stops the workers of a run as the load profile asks for
+type pool struct {
+	mu   sync.Mutex
+	ctx  context.Context
+	conf tpcc.Configuration
+	c    chan tpcc.Transaction
+	// running counts the workers that have not returned yet
+	running sync.WaitGroup
+	// open counts the workers whose connections are not closed yet
+	open sync.WaitGroup
+	// stopped is set once the run is over, no workers are started after it
+	stopped bool
+	// failed receives the error of a worker that could not be started
+	failed chan error
+
+	workers []*tpcc.Worker
+	// nextId is the thread id of the next worker, ids are not reused
+	nextId int
+	// gen is bumped by every stage so a ramp-up still going stops
+	gen int
+}
+
+func newPool(ctx context.Context, conf tpcc.Configuration, c chan tpcc.Transaction) *pool {
+	return &pool{ctx: ctx, conf: conf, c: c, failed: make(chan error, 1)}
+}
+
+// enter switches the pool to the stage, in the background as connecting
+// new workers takes time
+func (p *pool) enter(s stage) {
+	p.mu.Lock()
+	p.gen++
+	gen := p.gen
+	p.mu.Unlock()
+
+	if s.Ramp {
+		go p.ramp(gen, s.Threads, s.Duration)
+		return
+	}
+
+	go p.resize(gen, s.Threads)
+}
+
+// resize starts or stops workers until n are running. It does nothing once
+// the run is over or a later stage was entered. A worker that can not be
+// started stops it, the error goes to failed. The pool is not locked while a
+// worker connects, so stop and the next stage do not wait for the database.
+func (p *pool) resize(gen int, n int) {
+	p.mu.Lock()
+	for p.current(gen) && len(p.workers) < n {
+		id := p.nextId
+		p.nextId++
+		p.mu.Unlock()
+
+		conf := p.conf
+		w, err := tpcc.NewWorker(p.ctx, &conf, &p.running, p.c, id)
+
+		p.mu.Lock()
+		if err != nil {
+			if p.current(gen) {
+				select {
+				case p.failed <- err:
+				default:
+				}
+			}
+			p.mu.Unlock()
+			return
+		}
+
+		if !p.current(gen) {
+			// the stage ended or the run stopped while the worker connected
+			p.mu.Unlock()
+			w.Close()
+			return
+		}
+
+		p.running.Add(1)
+		p.workers = append(p.workers, w)
+
+		// a worker removed by a later stage or by stop closes its connections
+		p.open.Add(1)
+		go func() {
+			defer p.open.Done()
+			w.Execute()
+			w.Close()
+		}()
+	}
+
+	for p.gen == gen && len(p.workers) > n {
+		last := len(p.workers) - 1
+		p.workers[last].Stop()
+		p.workers = p.workers[:last]
+	}
+	p.mu.Unlock()
+}
+
+// current reports whether workers are still to be started for the stage gen,
+// p.mu must be held
+func (p *pool) current(gen int) bool {
+	return p.gen == gen && !p.stopped && p.ctx.Err() == nil
+}
+
+// ramp adds workers evenly spaced over d until there are n
+func (p *pool) ramp(gen int, n int, d time.Duration) {
+	p.mu.Lock()
+	current := len(p.workers)
+	p.mu.Unlock()
+
+	if current >= n {
+		p.resize(gen, n)
+		return
+	}
+
+	step := d / time.Duration(n-current)
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+
+	for i := current + 1; i <= n; i++ {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		stale := p.gen != gen
+		p.mu.Unlock()
+		if stale {
+			return
+		}
+
+		p.resize(gen, i)
+	}
+}
+
+// stop asks every worker to return after its current transaction. The
+// returned channel is closed once they all did and closed their connections.
+func (p *pool) stop() <-chan struct{} {
+	p.mu.Lock()
+	p.gen++
+	p.stopped = true
+	for _, w := range p.workers {
+		w.Stop()
+	}
+	p.workers = nil
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.running.Wait()
+		p.open.Wait()
+		close(done)
+	}()
+
+	return done
+}
+
+// size is the number of running workers
+func (p *pool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.workers)
+}
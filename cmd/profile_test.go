@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"github.com/Percona-Lab/go-tpcc/databases/memory"
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+)
+
+// the connections of the blocking driver wait for release after telling
+// connecting, they are memory databases
+var (
+	connecting = make(chan struct{}, 16)
+	release    = make(chan struct{})
+)
+
+func init() {
+	databases.Register("blocking", func(options databases.Options) (databases.Database, error) {
+		connecting <- struct{}{}
+		<-release
+		return memory.NewMemory(options.DBName)
+	})
+}
+
+func newTestPool(t *testing.T, driver string) (*pool, chan tpcc.Transaction) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	name := t.Name()
+	t.Cleanup(func() { memory.Drop(name) })
+
+	c := make(chan tpcc.Transaction)
+	conf := tpcc.Configuration{DBDriver: driver, DBName: name, WareHouses: 1, ScaleFactor: 100}
+
+	return newPool(ctx, conf, c), c
+}
+
+// waitSize waits until the pool has n workers
+func waitSize(t *testing.T, p *pool, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.size() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("the pool has %d workers, want %d", p.size(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolResize(t *testing.T) {
+	p, c := newTestPool(t, "memory")
+
+	// the database is empty, the transactions fail right away
+	drained := make(chan struct{})
+	defer close(drained)
+	go func() {
+		for {
+			select {
+			case <-c:
+			case <-drained:
+				return
+			}
+		}
+	}()
+
+	p.enter(stage{Threads: 3})
+	waitSize(t, p, 3)
+
+	p.enter(stage{Threads: 1})
+	waitSize(t, p, 1)
+
+	select {
+	case <-p.stop():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the workers did not stop")
+	}
+
+	if n := p.size(); n != 0 {
+		t.Errorf("%d workers left after stop", n)
+	}
+}
+
+func TestPoolStopWhileConnecting(t *testing.T) {
+	p, c := newTestPool(t, "blocking")
+
+	p.enter(stage{Threads: 1})
+	<-connecting
+
+	stopped := make(chan struct{})
+	go func() {
+		<-p.stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop waited for the worker that is connecting")
+	}
+
+	// the worker that connected after the stop is closed, not started
+	release <- struct{}{}
+	select {
+	case trx := <-c:
+		t.Errorf("a worker started after the stop ran %v", trx.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if n := p.size(); n != 0 {
+		t.Errorf("%d workers after stop", n)
+	}
+}
@@ -0,0 +1,331 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+)
+
+type OutputType int
+
+const (
+	DefaultOutput = iota
+	CSVOutput
+	JSONOutput
+)
+
+func parseOutputType(format string) (OutputType, error) {
+	switch format {
+	case "default":
+		return DefaultOutput, nil
+	case "csv":
+		return CSVOutput, nil
+	case "json":
+		return JSONOutput, nil
+	}
+
+	return DefaultOutput, fmt.Errorf("unknown report format %q, use default|json|csv", format)
+}
+
+// reporter writes the interval and summary results in the selected format.
+// Only results are written to w, log messages go to stderr so w can be
+// redirected to a file with --output and parsed as is.
+type reporter struct {
+	w           io.Writer
+	output      OutputType
+	percentiles []float64
+	// openLoop adds the --rate backlog and queue time to the CSV and default output
+	openLoop bool
+	// staged adds the number of threads to the intervals of a load profile
+	staged bool
+	// routed adds the primary and replica latencies to the summaries
+	routed bool
+	// traced adds the latencies of the database calls to the summaries
+	traced bool
+	// stages are kept for the CSV stage table printed after the summary
+	stages []*runSummary
+}
+
+func newReporter(w io.Writer, output OutputType, percentiles []float64) *reporter {
+	return &reporter{w: w, output: output, percentiles: percentiles}
+}
+
+// header writes what comes before the first interval, the CSV header line
+func (r *reporter) header() error {
+	if r.output != CSVOutput {
+		return nil
+	}
+
+	columns := []string{"Time", "TPS"}
+	for _, t := range tpcc.TransactionTypes {
+		columns = append(columns, t.String(), t.String()+"Min", t.String()+"Mean", t.String()+"Max")
+		for _, p := range r.percentiles {
+			columns = append(columns, t.String()+strings.ToUpper(percentileName(p)))
+		}
+	}
+	columns = append(columns, "Failed", "TimedOut")
+	if r.openLoop {
+		columns = append(columns, "Backlog", "QueueTime")
+	}
+	if r.staged {
+		columns = append(columns, "Threads")
+	}
+
+	_, err := fmt.Fprintln(r.w, strings.Join(columns, ","))
+	return err
+}
+
+// warmup reports the warm-up period. CSV has no room for it, so it goes
+// to stderr there like the other log messages.
+func (r *reporter) warmup(s *runSummary) error {
+	line := fmt.Sprintf("[ warm-up %.0fs ] TPS: %.2f Trx: %d Failed: %d TimedOut: %d\n", s.Duration, s.TPS, s.Trx, s.Failed, s.TimedOut)
+
+	switch r.output {
+	case CSVOutput:
+		_, err := io.WriteString(os.Stderr, line)
+		return err
+	case JSONOutput:
+		return json.NewEncoder(r.w).Encode(s)
+	}
+
+	_, err := io.WriteString(r.w, line)
+	return err
+}
+
+func (r *reporter) interval(s *runSummary) error {
+	var b strings.Builder
+
+	switch r.output {
+	case CSVOutput:
+		fmt.Fprintf(&b, "%d,%.2f", s.Time, s.TPS)
+		for _, t := range tpcc.TransactionTypes {
+			ts := s.Transactions[t.String()]
+			fmt.Fprintf(&b, ",%d,%.2f,%.2f,%.2f", ts.Trx, ts.Latency["min"], ts.Latency["mean"], ts.Latency["max"])
+			for _, p := range r.percentiles {
+				fmt.Fprintf(&b, ",%.2f", ts.Latency[percentileName(p)])
+			}
+		}
+		fmt.Fprintf(&b, ",%d,%d", s.Failed, s.TimedOut)
+		if r.openLoop {
+			fmt.Fprintf(&b, ",%d,%.2f", s.Backlog, s.QueueTime)
+		}
+		if r.staged {
+			fmt.Fprintf(&b, ",%d", s.Threads)
+		}
+		b.WriteString("\n")
+	case JSONOutput:
+		return json.NewEncoder(r.w).Encode(s)
+	default:
+		fmt.Fprintf(&b, "[ %ds ] ", s.Time)
+		if r.staged {
+			fmt.Fprintf(&b, "Threads: %d ", s.Threads)
+		}
+		fmt.Fprintf(&b, "TPS: %.2f Failed: %d TimedOut: %d", s.TPS, s.Failed, s.TimedOut)
+		if r.openLoop {
+			fmt.Fprintf(&b, " Backlog: %d QueueTime: %.2f ms", s.Backlog, s.QueueTime)
+		}
+		b.WriteString("\n")
+		for _, t := range tpcc.TransactionTypes {
+			ts := s.Transactions[t.String()]
+			fmt.Fprintf(&b, "\t%s: %d (min %.2f mean %.2f max %.2f", t, ts.Trx, ts.Latency["min"], ts.Latency["mean"], ts.Latency["max"])
+			for _, p := range r.percentiles {
+				fmt.Fprintf(&b, " %s %.2f", percentileName(p), ts.Latency[percentileName(p)])
+			}
+			b.WriteString(" ms)\n")
+		}
+	}
+
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+func (r *reporter) summary(s *runSummary) error {
+	var b strings.Builder
+
+	switch r.output {
+	case CSVOutput:
+		columns := []string{"Type", "Duration", "Trx", "Failed", "TimedOut", "Retries", "Mix", "TPS", "tpmC", "Min", "Mean", "Max"}
+		for _, p := range r.percentiles {
+			columns = append(columns, strings.ToUpper(percentileName(p)))
+		}
+
+		b.WriteString("\n")
+		b.WriteString(strings.Join(columns, ","))
+		b.WriteString("\n")
+
+		for _, t := range tpcc.TransactionTypes {
+			ts := s.Transactions[t.String()]
+			fmt.Fprintf(&b, "%s,%.2f,%d,%d,%d,%d,%.2f,%.2f,,%.2f,%.2f,%.2f",
+				t, s.Duration, ts.Trx, ts.Failed, ts.TimedOut, ts.Retries, ts.Mix, float64(ts.Trx)/s.Duration,
+				ts.Latency["min"], ts.Latency["mean"], ts.Latency["max"])
+			for _, p := range r.percentiles {
+				fmt.Fprintf(&b, ",%.2f", ts.Latency[percentileName(p)])
+			}
+			b.WriteString("\n")
+		}
+
+		// the latency columns are left empty for the total
+		fmt.Fprintf(&b, "Total,%.2f,%d,%d,%d,%d,100.00,%.2f,%.2f%s\n",
+			s.Duration, s.Trx, s.Failed, s.TimedOut, s.Retries, s.TPS, s.TpmC, strings.Repeat(",", 3+len(r.percentiles)))
+
+		for _, route := range routes {
+			ts, ok := s.Routes[route]
+			if !ok {
+				continue
+			}
+
+			fmt.Fprintf(&b, "%s,%.2f,%d,%d,%d,%d,%.2f,%.2f,,%.2f,%.2f,%.2f",
+				route, s.Duration, ts.Trx, ts.Failed, ts.TimedOut, ts.Retries, ts.Mix, float64(ts.Trx)/s.Duration,
+				ts.Latency["min"], ts.Latency["mean"], ts.Latency["max"])
+			for _, p := range r.percentiles {
+				fmt.Fprintf(&b, ",%.2f", ts.Latency[percentileName(p)])
+			}
+			b.WriteString("\n")
+		}
+
+		if len(r.stages) > 0 {
+			r.writeStageTable(&b)
+		}
+
+		if r.traced {
+			r.writeStatementTable(&b, s)
+		}
+
+		if len(s.Downtimes) > 0 {
+			b.WriteString("\nDowntimeStart,Duration,Workers,Attempts\n")
+			for _, w := range s.Downtimes {
+				fmt.Fprintf(&b, "%.2f,%.2f,%d,%d\n", w.Start, w.Duration, w.Workers, w.Attempts)
+			}
+		}
+	case JSONOutput:
+		return json.NewEncoder(r.w).Encode(s)
+	default:
+		if s.Interrupted {
+			b.WriteString("Summary (interrupted)\n")
+		} else {
+			b.WriteString("Summary\n")
+		}
+		r.writeSummary(&b, s)
+	}
+
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+// stage reports the end of a load profile stage
+func (r *reporter) stage(s *runSummary, st stage) error {
+	var b strings.Builder
+
+	switch r.output {
+	case CSVOutput:
+		// printed as one table with the summary
+		r.stages = append(r.stages, s)
+		return nil
+	case JSONOutput:
+		return json.NewEncoder(r.w).Encode(s)
+	default:
+		fmt.Fprintf(&b, "Stage %d: %s\n", s.Stage, st)
+		r.writeSummary(&b, s)
+	}
+
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+func (r *reporter) writeSummary(b *strings.Builder, s *runSummary) {
+	fmt.Fprintf(b, "\tMeasurement interval: %.2fs\n", s.Duration)
+	fmt.Fprintf(b, "\tTransactions: %d (TPS: %.2f) Failed: %d TimedOut: %d Retries: %d\n", s.Trx, s.TPS, s.Failed, s.TimedOut, s.Retries)
+	fmt.Fprintf(b, "\ttpmC: %.2f\n", s.TpmC)
+	if r.openLoop {
+		fmt.Fprintf(b, "\tRate: %.2f Max backlog: %d Mean queue time: %.2f ms\n", s.Rate, s.Backlog, s.QueueTime)
+	}
+	if len(s.Downtimes) > 0 {
+		fmt.Fprintf(b, "\tDowntime: %.2fs in %d windows\n", s.Downtime, len(s.Downtimes))
+		for _, w := range s.Downtimes {
+			fmt.Fprintf(b, "\t\tat %.2fs for %.2fs: %d workers reconnected after %d attempts\n", w.Start, w.Duration, w.Workers, w.Attempts)
+		}
+	}
+
+	for _, t := range tpcc.TransactionTypes {
+		ts := s.Transactions[t.String()]
+		r.writeTypeSummary(b, t.String(), ts)
+
+		if r.traced {
+			fmt.Fprintf(b, "\t\tCalls per transaction: mean %.2f max %d\n", ts.Calls, ts.MaxCalls)
+			for _, ss := range ts.Statements {
+				fmt.Fprintf(b, "\t\t%s: %d (%.2f per trx) Failed: %d (min %.2f mean %.2f max %.2f",
+					ss.Method, ss.Calls, ss.PerTrx, ss.Failed, ss.Latency["min"], ss.Latency["mean"], ss.Latency["max"])
+				for _, p := range r.percentiles {
+					fmt.Fprintf(b, " %s %.2f", percentileName(p), ss.Latency[percentileName(p)])
+				}
+				b.WriteString(" ms)\n")
+			}
+		}
+	}
+
+	if len(s.Routes) > 0 {
+		b.WriteString("\tBy route:\n")
+		for _, route := range routes {
+			r.writeTypeSummary(b, "\t"+route, s.Routes[route])
+		}
+	}
+}
+
+func (r *reporter) writeTypeSummary(b *strings.Builder, name string, ts *typeSummary) {
+	fmt.Fprintf(b, "\t%s: %d (%.2f%%) Failed: %d TimedOut: %d Retries: %d (min %.2f mean %.2f max %.2f",
+		name, ts.Trx, ts.Mix, ts.Failed, ts.TimedOut, ts.Retries, ts.Latency["min"], ts.Latency["mean"], ts.Latency["max"])
+	for _, p := range r.percentiles {
+		fmt.Fprintf(b, " %s %.2f", percentileName(p), ts.Latency[percentileName(p)])
+	}
+	b.WriteString(" ms)\n")
+}
+
+// writeStageTable writes one row per stage with the New-Order latencies,
+// the data points of a scalability curve
+func (r *reporter) writeStageTable(b *strings.Builder) {
+	columns := []string{"Stage", "Threads", "Duration", "Trx", "Failed", "TimedOut", "TPS", "tpmC", "NewOrderMean"}
+	for _, p := range r.percentiles {
+		columns = append(columns, "NewOrder"+strings.ToUpper(percentileName(p)))
+	}
+
+	b.WriteString("\n")
+	b.WriteString(strings.Join(columns, ","))
+	b.WriteString("\n")
+
+	for _, s := range r.stages {
+		no := s.Transactions[tpcc.TransactionType(tpcc.NewOrderTrx).String()]
+		fmt.Fprintf(b, "%d,%d,%.2f,%d,%d,%d,%.2f,%.2f,%.2f",
+			s.Stage, s.Threads, s.Duration, s.Trx, s.Failed, s.TimedOut, s.TPS, s.TpmC, no.Latency["mean"])
+		for _, p := range r.percentiles {
+			fmt.Fprintf(b, ",%.2f", no.Latency[percentileName(p)])
+		}
+		b.WriteString("\n")
+	}
+}
+
+// writeStatementTable writes one row per method of every transaction type
+func (r *reporter) writeStatementTable(b *strings.Builder, s *runSummary) {
+	columns := []string{"Transaction", "Method", "Calls", "PerTrx", "Failed", "Min", "Mean", "Max"}
+	for _, p := range r.percentiles {
+		columns = append(columns, strings.ToUpper(percentileName(p)))
+	}
+
+	b.WriteString("\n")
+	b.WriteString(strings.Join(columns, ","))
+	b.WriteString("\n")
+
+	for _, t := range tpcc.TransactionTypes {
+		for _, ss := range s.Transactions[t.String()].Statements {
+			fmt.Fprintf(b, "%s,%s,%d,%.2f,%d,%.2f,%.2f,%.2f",
+				t, ss.Method, ss.Calls, ss.PerTrx, ss.Failed, ss.Latency["min"], ss.Latency["mean"], ss.Latency["max"])
+			for _, p := range r.percentiles {
+				fmt.Fprintf(b, ",%.2f", ss.Latency[percentileName(p)])
+			}
+			b.WriteString("\n")
+		}
+	}
+}
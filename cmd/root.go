@@ -3,7 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/Percona-Lab/go-tpcc/databases"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -13,14 +15,31 @@ var cfgFile string
 
 var rootCmd = &cobra.Command{
 	Use:   "go-tpcc",
-	Short: "TPC-C implementation for various databases. Currently only MongoDB is supported",
+	Short: "TPC-C implementation for various databases",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyConfig(cmd); err != nil {
+			return err
+		}
+
+		dbdriver, _ := cmd.Root().PersistentFlags().GetString("dbdriver")
+		for _, name := range databases.Drivers() {
+			if name == dbdriver {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("unknown db driver %q, available drivers: %s", dbdriver, strings.Join(databases.Drivers(), "|"))
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	// drivers are registered by the packages imported in main, so the list is only known here
+	rootCmd.PersistentFlags().Lookup("dbdriver").Usage = fmt.Sprintf("db driver to use (%s)", strings.Join(databases.Drivers(), "|"))
+
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -28,10 +47,10 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	//rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.mongo-tpcc.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file, YAML or TOML (default is $HOME/.mongo-tpcc.yaml)")
 	rootCmd.PersistentFlags().String("uri", "", "DSN")
 	rootCmd.PersistentFlags().String("db", "", "database name to use")
-	rootCmd.PersistentFlags().String("dbdriver", "mysql", "db driver to use (mongodb|mysql)")
+	rootCmd.PersistentFlags().String("dbdriver", "mysql", "db driver to use")
 	rootCmd.PersistentFlags().Bool("trx", false, "use trx?. false by default")
 }
 
@@ -44,7 +63,7 @@ func initConfig() {
 		// Find home directory.
 		home, err := homedir.Dir()
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 
@@ -53,11 +72,14 @@ func initConfig() {
 		viper.SetConfigName(".mongo-tpcc")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// GOTPCC_* environment variables are looked up by applyConfig
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	} else if cfgFile != "" {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
 }
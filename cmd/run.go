@@ -3,12 +3,16 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"github.com/Percona-Lab/go-tpcc/databases"
 	"github.com/Percona-Lab/go-tpcc/tpcc"
-	"math"
-	"sort"
+	"os"
+	"os/signal"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 )
 
@@ -22,66 +26,158 @@ var runCmd = &cobra.Command{
 		threads, _ := cmd.PersistentFlags().GetInt("threads")
 		scalefactor, _ := cmd.PersistentFlags().GetFloat64("scalefactor")
 		ri, _ := cmd.PersistentFlags().GetInt("report-interval")
-		time, _ := cmd.PersistentFlags().GetInt("time")
+		ttime, _ := cmd.PersistentFlags().GetInt("time")
 		dbname, _ := cmd.Root().PersistentFlags().GetString("db")
 		uri, _ := cmd.Root().PersistentFlags().GetString("uri")
 		trx,_ := cmd.Root().PersistentFlags().GetBool("trx")
 		rf_, _ := cmd.PersistentFlags().GetString("report-format")
 		perc, _ := cmd.PersistentFlags().GetInt("percentile")
+		percList, _ := cmd.PersistentFlags().GetString("percentiles")
+		hlogFile, _ := cmd.PersistentFlags().GetString("histogram-log")
+		metricsAddr, _ := cmd.PersistentFlags().GetString("metrics-addr")
 		percfail, _ := cmd.PersistentFlags().GetInt("percent-fail")
 		dbdriver, _ := cmd.Root().PersistentFlags().GetString("dbdriver")
+		queryTimeout, _ := cmd.PersistentFlags().GetDuration("query-timeout")
+		trxTimeout, _ := cmd.PersistentFlags().GetDuration("trx-timeout")
+		tagQueries, _ := cmd.PersistentFlags().GetBool("tag-queries")
+		replicaURIs, _ := cmd.PersistentFlags().GetStringArray("replica-uri")
+		readPreference, _ := cmd.PersistentFlags().GetString("read-preference")
+		maxStaleness, _ := cmd.PersistentFlags().GetDuration("max-staleness")
+		traceStatements, _ := cmd.PersistentFlags().GetBool("trace-statements")
+		faultsFile, _ := cmd.PersistentFlags().GetString("faults")
+		reconnect, _ := cmd.PersistentFlags().GetBool("reconnect")
+		reconnectBackoff, _ := cmd.PersistentFlags().GetDuration("reconnect-backoff")
+		reconnectMaxBackoff, _ := cmd.PersistentFlags().GetDuration("reconnect-max-backoff")
+		outFile, _ := cmd.PersistentFlags().GetString("output")
+		warmup, _ := cmd.PersistentFlags().GetDuration("warmup")
+		rampUp, _ := cmd.PersistentFlags().GetDuration("ramp-up")
+		stages, _ := cmd.PersistentFlags().GetString("stages")
+		shutdownTimeout, _ := cmd.PersistentFlags().GetDuration("shutdown-timeout")
+		rate, _ := cmd.PersistentFlags().GetFloat64("rate")
+		arrival, _ := cmd.PersistentFlags().GetString("arrival")
+
+
+		if cmd.PersistentFlags().Changed("percentile") {
+			percList = strconv.Itoa(perc)
+		}
 
+		percentiles, err := parsePercentiles(percList)
+		if err != nil {
+			panic(err)
+		}
 
-		if perc > 100 || perc < 0 {
-			panic("percentile not correct")
+		var hlog *hlogWriter
+		if hlogFile != "" {
+			f, err := os.Create(hlogFile)
+			if err != nil {
+				panic(err)
+			}
+			defer f.Close()
+
+			hlog, err = newHlogWriter(f, time.Now())
+			if err != nil {
+				panic(err)
+			}
 		}
 
-		var rf OutputType
-		switch rf_ {
-		case "json":
-			rf = JSONOutput
+		profile, err := loadProfile(threads, ttime, rampUp, stages)
+		if err != nil {
+			panic(err)
+		}
 
-		case "csv":
-			rf=CSVOutput
+		rf, err := parseOutputType(rf_)
+		if err != nil {
+			panic(err)
+		}
 
-		default:
-			rf=DefaultOutput
+		out := os.Stdout
+		if outFile != "" {
+			out, err = os.Create(outFile)
+			if err != nil {
+				panic(err)
+			}
+			defer out.Close()
+		}
+		r := newReporter(out, rf, percentiles)
+		r.staged = len(profile) > 1
+
+		var arrivals *tpcc.Arrivals
+		if rate > 0 {
+			arrivals, err = tpcc.NewArrivals(rate, arrival)
+			if err != nil {
+				panic(err)
+			}
+			r.openLoop = true
 		}
 
-		var t tpcc.Configuration
-		t.Threads = 1
 		ctx, cancel := context.WithCancel(context.Background())
 		wg := &sync.WaitGroup{}
 		c := make(chan tpcc.Transaction, 1024)
 
-		for i:=0; i<threads; i++ {
-			wg.Add(1)
-			go func(i int) {
-
-				conf := tpcc.Configuration{
-					DBDriver: 		dbdriver,
-					DBName:         dbname,
-					Threads:        threads,
-					WriteConcern:   0,
-					ReadConcern:    0,
-					ReportInterval: ri,
-					WareHouses:     warehouses,
-					ScaleFactor:    scalefactor,
-					URI: uri,
-					Transactions: trx,
-					PercentFail: percfail,
-				}
+		conf := tpcc.Configuration{
+			DBDriver: 		dbdriver,
+			DBName:         dbname,
+			Threads:        threads,
+			WriteConcern:   0,
+			ReadConcern:    0,
+			ReportInterval: ri,
+			WareHouses:     warehouses,
+			ScaleFactor:    scalefactor,
+			URI: uri,
+			Transactions: trx,
+			PercentFail: percfail,
+			QueryTimeout: queryTimeout,
+			TrxTimeout: trxTimeout,
+			TagQueries: tagQueries,
+			ReplicaURIs: replicaURIs,
+			ReadPreference: readPreference,
+			MaxStaleness: maxStaleness,
+			TraceStatements: traceStatements,
+			Arrivals: arrivals,
+		}
+		r.routed = conf.Replicas()
 
-				w, err := tpcc.NewWorker(ctx, &conf, wg, c, i)
-				if err != nil  {
-					panic(err)
-				}
-				w.Execute()
-			}(i)
+		if reconnect {
+			conf.Reconnect = &databases.Backoff{Initial: reconnectBackoff, Max: reconnectMaxBackoff}
+		}
+
+		if faultsFile != "" {
+			conf.Faults, err = loadFaults(faultsFile)
+			if err != nil {
+				panic(err)
+			}
+		}
+		r.traced = traceStatements
+
+		err = scaleConfig(cmd.PersistentFlags(), &conf)
+		if err == nil {
+			err = datasetConfig(cmd, cmd.PersistentFlags(), &conf)
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		var m *metrics
+		if metricsAddr != "" {
+			m, err = serveMetrics(metricsAddr, prometheus.Labels{
+				"driver":     dbdriver,
+				"warehouses": strconv.Itoa(conf.WareHouses),
+				"threads":    strconv.Itoa(threads),
+			})
+			if err != nil {
+				panic(err)
+			}
 		}
 
+		p := newPool(ctx, conf, c)
+
+		// the first SIGINT or SIGTERM ends the run early with the partial
+		// results, the default handling is back for a second one
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
 		wg.Add(1)
-		go stats(cancel, c, wg, time, ri, rf, float64(perc))
+		go stats(cancel, c, wg, interrupt, shutdownTimeout, p, profile, warmup, ri, r, percentiles, hlog, m, arrivals)
 		wg.Wait()
 	},
 }
@@ -91,169 +187,316 @@ func init() {
 
 	runCmd.PersistentFlags().Int("threads", 8, "Amount of threads that will be used when preparing. min(threads, warehouses) will be used at most")
 	runCmd.PersistentFlags().Int("report-interval", 1, "Report interval")
-	runCmd.PersistentFlags().Int("time", 10, "How long to run the test")
+	runCmd.PersistentFlags().Int("time", 10, "How long to run the test, warm-up excluded")
+	runCmd.PersistentFlags().Duration("ramp-up", 0, "Add the threads evenly over this duration before running them all for --time")
+	runCmd.PersistentFlags().String("stages", "", "Step schedule of THREADS@DURATION stages, e.g. 8@60s,16@60s,32@60s. Replaces --threads and --time")
+	runCmd.PersistentFlags().Float64("rate", 0, "Open-loop mode: start this many transactions per second in total, measuring latency from the intended start. 0 runs closed-loop")
+	runCmd.PersistentFlags().String("arrival", "poisson", "Arrival distribution with --rate: poisson|constant")
+	runCmd.PersistentFlags().Duration("warmup", 0, "Run this long before measuring, the warm-up transactions are reported separately")
 	runCmd.PersistentFlags().Int("warehouses", 10, "Number of warehouses to generate the data")
 	runCmd.PersistentFlags().Int("percentile", 95, "Percentile for latency reporting")
+	runCmd.PersistentFlags().MarkDeprecated("percentile", "use --percentiles instead")
+	runCmd.PersistentFlags().String("percentiles", "50,90,95,99,99.9", "Comma separated list of latency percentiles to report")
+	runCmd.PersistentFlags().String("metrics-addr", "", "Expose Prometheus metrics on this address (e.g. :9090) while running")
+	runCmd.PersistentFlags().String("histogram-log", "", "Write interval latency histograms to this file in the HdrHistogram log format (.hlog)")
 	runCmd.PersistentFlags().Int("percent-fail", 0, "How much % of New Order trxs should fail [0-100]")
+	runCmd.PersistentFlags().Duration("query-timeout", 0, "Cancel a single statement after this duration, 0 disables it")
+	runCmd.PersistentFlags().Duration("trx-timeout", 0, "Cancel a whole transaction after this duration, 0 disables it")
+	runCmd.PersistentFlags().Bool("tag-queries", false, "Tag every statement with the transaction, method and worker id")
+	runCmd.PersistentFlags().Bool("trace-statements", false, "Time every database call and report the latencies by transaction and method in the summary")
+	runCmd.PersistentFlags().Bool("reconnect", true, "Replace lost connections, the transaction running on one fails")
+	runCmd.PersistentFlags().Duration("reconnect-backoff", 100 * time.Millisecond, "Wait this long after the first failed reconnect, doubled after every further one")
+	runCmd.PersistentFlags().Duration("reconnect-max-backoff", 5 * time.Second, "Longest wait between two reconnects")
+	runCmd.PersistentFlags().String("faults", "", "Inject the faults described in this YAML or TOML file into the database calls, to test retries and error handling")
+	runCmd.PersistentFlags().StringArray("replica-uri", nil, "Run Order-Status and Stock-Level on this replica, repeat it for several replicas the workers take turns on")
+	runCmd.PersistentFlags().String("read-preference", "", "Run Order-Status and Stock-Level with this MongoDB read preference: primaryPreferred|secondary|secondaryPreferred|nearest")
+	runCmd.PersistentFlags().Duration("max-staleness", 0, "maxStalenessSeconds of --read-preference, at least 90s")
 
 
+	runCmd.PersistentFlags().Duration("shutdown-timeout", 10 * time.Second, "On SIGINT or SIGTERM wait this long for running transactions before aborting them")
+
 	runCmd.PersistentFlags().Float64("scalefactor", 1, "Scale-factor")
+	addScaleFlags(runCmd.PersistentFlags())
 	runCmd.PersistentFlags().String("report-format", "default", "default|json|csv")
+	runCmd.PersistentFlags().String("output", "", "Write the results to this file instead of stdout")
 
 	rootCmd.MarkFlagRequired("uri")
 	rootCmd.MarkFlagRequired("db")
 }
 
-type OutputType int
-const (
-	DefaultOutput = iota
-	CSVOutput
-	JSONOutput
-)
-
-func stats( cancel context.CancelFunc, c chan tpcc.Transaction,  wg *sync.WaitGroup, ttime int, ri int, output OutputType, percentile float64) {
+func stats( cancel context.CancelFunc, c chan tpcc.Transaction,  wg *sync.WaitGroup, interrupt chan os.Signal, shutdownTimeout time.Duration, p *pool, profile []stage, warmup time.Duration, ri int, r *reporter, percentiles []float64, hlog *hlogWriter, m *metrics, arrivals *tpcc.Arrivals) {
 	defer wg.Done()
-	ticker := time.NewTicker(time.Duration(ri) * time.Second)
-	timeout := time.After(time.Duration(ttime) * time.Second + 99 * time.Millisecond)
-	i:=ri
-	type Transactions struct {
-		StockLevelCnt int
-		DeliveryCnt int
-		OrderStatusCnt int
-		PaymentCnt int
-		NewOrderCnt int
-		Failed int
+
+	// a ramp-up starts from a single thread, also for the warm-up
+	first := profile[0]
+	if first.Ramp {
+		p.enter(stage{Threads: 1})
+	} else {
+		p.enter(first)
 	}
 
-	globalStats := make(map[int]*Transactions)
-	batchStats := make(map[int]*Transactions)
-	latencies := make(map[tpcc.TransactionType][]float64)
+	start := time.Now()
+	totals := newRunTotals()
+	interval := newRunTotals()
+	latencies := newLatencyStats(start)
+	maxBacklog := 0
+
+	current := 0
+	stageStart := start
+	stageTotals := newRunTotals()
+	stageLatencies := newLatencyStats(start)
+	routes := newRouteStats()
+	stageRoutes := newRouteStats()
+	statements := newStatementStats()
+	stageStatements := newStatementStats()
+	lost := &downtimes{}
+
+	record := func(v tpcc.Transaction) {
+		totals.add(v)
+		interval.add(v)
+		stageTotals.add(v)
+		latencies.record(v.Type, v.Time)
+		stageLatencies.record(v.Type, v.Time)
+		if r.routed {
+			routes.add(v)
+			stageRoutes.add(v)
+		}
+		if r.traced {
+			statements.add(v)
+			stageStatements.add(v)
+		}
+		lost.add(v)
 
+		if m != nil {
+			m.observe(v)
+		}
+	}
 
-	if output == CSVOutput {
-		fmt.Println("Time,TPS,StockLevel,StockLevelLatency,Delivery,DeliveryLatency,OrderStatus,OrderStatusLatency,Payment,PaymentLatency,NewOrder,NewOrderLatency,Failed")
+	reportStage := func(now time.Time) {
+		if len(profile) == 1 {
+			return
+		}
+
+		s := newRunSummary(stageRecord, now.Sub(stageStart), stageTotals, stageLatencies.cumulative, percentiles)
+		s.Stage = current + 1
+		s.Threads = profile[current].Threads
+		if r.routed {
+			s.Routes = stageRoutes.summaries(s.Trx, percentiles)
+		}
+		if r.traced {
+			stageStatements.apply(s, percentiles)
+		}
+		if err := r.stage(s, profile[current]); err != nil {
+			fmt.Fprintln(os.Stderr, "unable to write results:", err)
+		}
 	}
 
-	for {
-		select {
-			case <-timeout:
-				cancel()
-				time.Sleep(1 * time.Second)
-				return
-			case v:=<-c:
+	// startMeasurement starts the numbers of the whole run over, the ramp-up
+	// is left out of them like the warm-up
+	startMeasurement := func(now time.Time) {
+		start = now
+		totals = newRunTotals()
+		latencies.resetCumulative(now)
+		routes = newRouteStats()
+		statements = newStatementStats()
+		lost = &downtimes{}
+		maxBacklog = 0
+	}
 
-				_, exist := globalStats[v.ThreadId]
+	// finish reports the summary of the run, or what was completed of it
+	finish := func(interrupted bool) {
+		cancel()
+		if first.Ramp && current == 0 {
+			startMeasurement(time.Now())
+		}
+		s := newRunSummary(summaryRecord, time.Since(start), totals, latencies.cumulative, percentiles)
+		s.Interrupted = interrupted
+		if r.routed {
+			s.Routes = routes.summaries(s.Trx, percentiles)
+		}
+		if r.traced {
+			statements.apply(s, percentiles)
+		}
+		s.Downtimes = lost.windows(start)
+		for _, w := range s.Downtimes {
+			s.Downtime += w.Duration
+		}
+		if arrivals != nil {
+			s.Rate = arrivals.Rate()
+			s.Backlog = maxBacklog
+		}
+		if err := r.summary(s); err != nil {
+			fmt.Fprintln(os.Stderr, "unable to write results:", err)
+		}
+	}
 
-				if ! exist {
-					globalStats[v.ThreadId] = &Transactions{
-						StockLevelCnt:  0,
-						DeliveryCnt:    0,
-						OrderStatusCnt: 0,
-						PaymentCnt:     0,
-						NewOrderCnt:    0,
-					}
-				}
+	// shutdown lets the running transactions finish, up to shutdownTimeout,
+	// and counts them before the run context aborts the rest. reason says
+	// why the run ends early.
+	shutdown := func(reason string) {
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+		fmt.Fprintf(os.Stderr, "%s, waiting up to %s for running transactions, interrupt to exit now\n", reason, shutdownTimeout)
+
+		done := p.stop()
+		timeout := time.After(shutdownTimeout)
+		for {
+			select {
+			case v := <-c:
+				record(v)
+				continue
+			case <-done:
+			case <-timeout:
+			}
+			break
+		}
 
-				_, exist = batchStats[v.ThreadId]
+		reportStage(time.Now())
+		finish(true)
+	}
 
-				if ! exist {
-					batchStats[v.ThreadId] = &Transactions{
-						StockLevelCnt:  0,
-						DeliveryCnt:    0,
-						OrderStatusCnt: 0,
-						PaymentCnt:     0,
-						NewOrderCnt:    0,
-					}
-				}
+	if warmup > 0 {
+		if reason, interrupted := warmUp(c, interrupt, p.failed, warmup, r, percentiles, m); interrupted {
+			shutdown(reason)
+			return
+		}
 
-				if v.Failed {
-					batchStats[v.ThreadId].Failed++
-					globalStats[v.ThreadId].Failed++
-				}
+		start = time.Now()
+		stageStart = start
+		totals = newRunTotals()
+		interval = newRunTotals()
+		stageTotals = newRunTotals()
+		latencies = newLatencyStats(start)
+		stageLatencies = newLatencyStats(start)
+		routes = newRouteStats()
+		stageRoutes = newRouteStats()
+		statements = newStatementStats()
+		stageStatements = newStatementStats()
+		lost = &downtimes{}
+	}
 
-				switch v.Type {
-				case tpcc.StockLevelTrx:
-					batchStats[v.ThreadId].StockLevelCnt++
-					globalStats[v.ThreadId].StockLevelCnt++
-				case tpcc.DeliveryTrx:
-					batchStats[v.ThreadId].DeliveryCnt++
-					globalStats[v.ThreadId].DeliveryCnt++
-				case tpcc.OrderStatusTrx:
-					batchStats[v.ThreadId].OrderStatusCnt++
-					globalStats[v.ThreadId].OrderStatusCnt++
-				case tpcc.PaymentTrx:
-					batchStats[v.ThreadId].PaymentCnt++
-					globalStats[v.ThreadId].PaymentCnt++
-				case tpcc.NewOrderTrx:
-					batchStats[v.ThreadId].NewOrderCnt++
-					globalStats[v.ThreadId].NewOrderCnt++
-				}
+	ticker := time.NewTicker(time.Duration(ri) * time.Second)
+	i:=ri
 
-			latencies[v.Type] = append(latencies[v.Type], v.Time)
+	stageEnd := time.NewTimer(stageDuration(profile, current))
+	if first.Ramp {
+		p.enter(first)
+	}
 
+	if err := r.header(); err != nil {
+		fmt.Fprintln(os.Stderr, "unable to write results:", err)
+	}
 
-			case <-ticker.C:
-				sCnt := 0
-				dCnt := 0
-				oCnt := 0
-				pCnt := 0
-				nCnt := 0
-				failed := 0
+	for {
+		select {
+			case sig := <-interrupt:
+				shutdown(interruptReason(sig))
+				return
+			case err := <-p.failed:
+				shutdown(failedReason(err))
+				return
+			case now := <-stageEnd.C:
+				reportStage(now)
+				if first.Ramp && current == 0 {
+					startMeasurement(now)
+				}
 
-				for _, value := range batchStats {
-					sCnt += value.StockLevelCnt
-					dCnt += value.DeliveryCnt
-					oCnt += value.OrderStatusCnt
-					pCnt += value.PaymentCnt
-					nCnt += value.NewOrderCnt
-					failed += value.Failed
+				current++
+				if current < len(profile) {
+					stageStart = now
+					stageTotals = newRunTotals()
+					stageLatencies = newLatencyStats(now)
+					stageRoutes = newRouteStats()
+					stageStatements = newStatementStats()
+					stageEnd.Reset(stageDuration(profile, current))
+					p.enter(profile[current])
+					continue
 				}
-				batchStats = make(map[int]*Transactions)
-				var format string
-				switch output {
-				case CSVOutput:
-					format = "%d,%.2f,%d,%.2f,%d,%.2f,%d,%.2f,%d,%.2f,%d,%.2f,%d\n"
-				case JSONOutput:
-					format = "{\"time\": %d, \"tps\": %.2f, \"StockLevel\": { \"Trx\": %d, \"LatencyPercentile\": %.2f}, " +
-						"\"Delivery\": { \"Trx\": %d, \"LatencyPercentile\": %.2f}, " +
-						"\"OrderStatus\": { \"Trx\": %d, \"LatencyPercentile\":%.2f}, " +
-						"\"Payment\": { \"Trx\": %d, \"LatencyPercentile\": %.2f}, " +
-						"\"NewOrder\": { \"Trx\": %d, \"LatencyPercentile\": %.2f}," +
-						"\"Failed\": %d}\n"
-				default:
-					format = "[ %ds ] TPS: %.2f StockLevel: %d (%.2f ms) Delivery: %d (%.2f ms) OrderStatus: %d (%.2f ms) Payment: %d (%.2f ms) NewOrder: %d (%.2f ms) Failed: %d\n"
+
+				finish(false)
+				time.Sleep(1 * time.Second)
+				return
+			case v:=<-c:
+				record(v)
+
+			case now := <-ticker.C:
+				latencies.closeInterval(now)
+
+				s := newRunSummary(intervalRecord, time.Duration(ri) * time.Second, interval, latencies.interval, percentiles)
+				s.Time = i
+				s.Threads = p.size()
+				if arrivals != nil {
+					s.Rate = arrivals.Rate()
+					s.Backlog = arrivals.Backlog()
+					if s.Backlog > maxBacklog {
+						maxBacklog = s.Backlog
+					}
+				}
+				if err := r.interval(s); err != nil {
+					fmt.Fprintln(os.Stderr, "unable to write results:", err)
 				}
 
-				fmt.Printf(
-					format,
-					i,
-					float64(sCnt+dCnt+oCnt+pCnt+nCnt)/float64(ri),
-					sCnt,
-					float64(perc(latencies[tpcc.StockLevelTrx], percentile)),
-					dCnt,
-					float64(perc(latencies[tpcc.DeliveryTrx], percentile)),
-					oCnt,
-					float64(perc(latencies[tpcc.OrderStatusTrx], percentile)),
-					pCnt,
-					float64(perc(latencies[tpcc.PaymentTrx], percentile)),
-					nCnt,
-					float64(perc(latencies[tpcc.NewOrderTrx], percentile)),
-					failed,
-				)
+				if hlog != nil {
+					err := hlog.write(latencies)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, "unable to write histogram log:", err)
+					}
+				}
 
 				i += ri
-				latencies = make(map[tpcc.TransactionType][]float64)
-		default:
+				interval = newRunTotals()
+				latencies.resetInterval(now)
 		}
 	}
 }
 
-func perc(a []float64, p float64) float64 {
-	p = p/100
-	if len(a) == 0 {
-		return 0
+// stageDuration is how long the stage runs. The last one gets a little
+// extra so the final report interval is not cut off.
+func stageDuration(profile []stage, i int) time.Duration {
+	if i == len(profile)-1 {
+		return profile[i].Duration + 99 * time.Millisecond
 	}
-	sort.Float64s(a)
-	idx := int( math.Round(float64(len(a))*p) )
-	return a[idx-1]
-}
\ No newline at end of file
+
+	return profile[i].Duration
+}
+
+// warmUp consumes the transactions of the warm-up period and reports them
+// as a single record, apart from the measurement. It returns early with the
+// reason when the run is interrupted or a worker can not be started.
+func warmUp(c chan tpcc.Transaction, interrupt chan os.Signal, failed chan error, d time.Duration, r *reporter, percentiles []float64, m *metrics) (string, bool) {
+	start := time.Now()
+	totals := newRunTotals()
+	latencies := newLatencyStats(start)
+	done := time.After(d)
+
+	for {
+		select {
+		case <-done:
+			s := newRunSummary(warmupRecord, time.Since(start), totals, latencies.cumulative, percentiles)
+			if err := r.warmup(s); err != nil {
+				fmt.Fprintln(os.Stderr, "unable to write results:", err)
+			}
+			return "", false
+		case sig := <-interrupt:
+			return interruptReason(sig), true
+		case err := <-failed:
+			return failedReason(err), true
+		case v := <-c:
+			totals.add(v)
+			latencies.record(v.Type, v.Time)
+
+			// the live metrics include the warm-up
+			if m != nil {
+				m.observe(v)
+			}
+		}
+	}
+}
+
+// interruptReason and failedReason say why a run ends early
+func interruptReason(sig os.Signal) string {
+	return fmt.Sprintf("%s received", sig)
+}
+
+func failedReason(err error) string {
+	return fmt.Sprintf("unable to start a worker: %v", err)
+}
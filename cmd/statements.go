@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+)
+
+// statementStats are the latencies of the database calls by transaction type
+// and method, with --trace-statements
+type statementStats struct {
+	types map[tpcc.TransactionType]*typeStatements
+}
+
+type typeStatements struct {
+	trx      int
+	calls    int
+	maxCalls int
+	// methods are kept in the order they were first called
+	methods []string
+	totals  map[string]*typeTotals
+	latency map[string]*hdrhistogram.Histogram
+}
+
+func newStatementStats() *statementStats {
+	s := &statementStats{types: make(map[tpcc.TransactionType]*typeStatements)}
+	for _, t := range tpcc.TransactionTypes {
+		s.types[t] = &typeStatements{
+			totals:  make(map[string]*typeTotals),
+			latency: make(map[string]*hdrhistogram.Histogram),
+		}
+	}
+
+	return s
+}
+
+func (s *statementStats) add(trx tpcc.Transaction) {
+	ts := s.types[trx.Type]
+
+	ts.trx++
+	ts.calls += len(trx.Calls)
+	if len(trx.Calls) > ts.maxCalls {
+		ts.maxCalls = len(trx.Calls)
+	}
+
+	for _, call := range trx.Calls {
+		totals, ok := ts.totals[call.Method]
+		if !ok {
+			totals = &typeTotals{}
+			ts.totals[call.Method] = totals
+			ts.latency[call.Method] = newHistogram()
+			ts.methods = append(ts.methods, call.Method)
+		}
+
+		totals.Count++
+		if call.Failed {
+			totals.Failed++
+		}
+		recordLatency(ts.latency[call.Method], call.Time)
+	}
+}
+
+// statementSummary is the report of one method of a transaction type
+type statementSummary struct {
+	Method string `json:"method"`
+	Calls  int    `json:"calls"`
+	Failed int    `json:"failed"`
+	// PerTrx is the mean number of calls per transaction
+	PerTrx float64 `json:"perTrx"`
+	// Latency holds min, mean, max and the requested percentiles in milliseconds
+	Latency map[string]float64 `json:"latency"`
+}
+
+// apply adds the calls per transaction and the methods to the transaction
+// types of rs
+func (s *statementStats) apply(rs *runSummary, percentiles []float64) {
+	for _, t := range tpcc.TransactionTypes {
+		ts := s.types[t]
+		summary := rs.Transactions[t.String()]
+
+		if ts.trx > 0 {
+			summary.Calls = float64(ts.calls) / float64(ts.trx)
+		}
+		summary.MaxCalls = ts.maxCalls
+
+		for _, method := range ts.methods {
+			ss := &statementSummary{
+				Method:  method,
+				Calls:   ts.totals[method].Count,
+				Failed:  ts.totals[method].Failed,
+				Latency: latencyMap(ts.latency[method], percentiles),
+			}
+			if ts.trx > 0 {
+				ss.PerTrx = float64(ss.Calls) / float64(ts.trx)
+			}
+
+			summary.Statements = append(summary.Statements, ss)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+)
+
+// typeTotals are the cumulative counters of one transaction type
+type typeTotals struct {
+	Count      int
+	Failed     int
+	TimedOut   int
+	RolledBack int
+	Retries    int
+	// QueueTime is the sum of the open-loop queue times in milliseconds
+	QueueTime float64
+}
+
+type runTotals map[tpcc.TransactionType]*typeTotals
+
+func newRunTotals() runTotals {
+	r := make(runTotals)
+	for _, t := range tpcc.TransactionTypes {
+		r[t] = &typeTotals{}
+	}
+
+	return r
+}
+
+func (r runTotals) add(trx tpcc.Transaction) {
+	t := r[trx.Type]
+
+	t.Count++
+	t.Retries += trx.Retries
+	t.QueueTime += trx.QueueTime
+	if trx.Failed {
+		t.Failed++
+	}
+	if trx.TimedOut {
+		t.TimedOut++
+	}
+	if trx.Error == databases.ClassRollback {
+		t.RolledBack++
+	}
+}
+
+// runSummary is the report of one interval, or of the whole run at the end.
+// It is what gets written as one NDJSON record with --report-format json.
+type runSummary struct {
+	// Type is "warmup", "interval", "stage" or "summary"
+	Type string `json:"type"`
+	// Stage is the 1-based number of the load profile stage, stages only
+	Stage int `json:"stage,omitempty"`
+	// Threads is the number of workers at the end of an interval, or those
+	// the stage runs with
+	Threads int `json:"threads,omitempty"`
+	// Time is the end of the interval in seconds since the start, intervals only
+	Time int `json:"time,omitempty"`
+	// Duration is the measurement interval in seconds
+	Duration float64 `json:"duration"`
+	Trx      int     `json:"trx"`
+	TPS      float64 `json:"tps"`
+	TpmC     float64 `json:"tpmC"`
+	Failed   int     `json:"failed"`
+	TimedOut int     `json:"timedOut"`
+	Retries  int     `json:"retries"`
+	// Rate is the target rate of an open-loop run
+	Rate float64 `json:"rate,omitempty"`
+	// Backlog is the number of due open-loop transactions not started yet
+	// at the end of an interval, the summary has the largest one seen
+	Backlog int `json:"backlog,omitempty"`
+	// QueueTime is the mean time in milliseconds open-loop transactions
+	// waited for a free worker
+	QueueTime    float64                 `json:"queueTime,omitempty"`
+	Transactions map[string]*typeSummary `json:"transactions"`
+	// Routes splits the transactions by where they ran, primary or replica,
+	// when the read-only transactions go to replicas. Summaries and stages
+	// only.
+	Routes map[string]*typeSummary `json:"routes,omitempty"`
+	// Interrupted is set when the run was ended early by a signal
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Downtime is the total of the Downtimes in seconds, the periods in
+	// which connections were lost. Summaries only.
+	Downtime  float64           `json:"downtime,omitempty"`
+	Downtimes []*downtimeWindow `json:"downtimes,omitempty"`
+}
+
+const (
+	warmupRecord   = "warmup"
+	intervalRecord = "interval"
+	stageRecord    = "stage"
+	summaryRecord  = "summary"
+)
+
+type typeSummary struct {
+	Trx      int `json:"trx"`
+	Failed   int `json:"failed"`
+	TimedOut int `json:"timedOut"`
+	Retries  int `json:"retries"`
+	// Mix is the share of all transactions in percent
+	Mix float64 `json:"mix"`
+	// Latency holds min, mean, max and the requested percentiles in milliseconds
+	Latency map[string]float64 `json:"latency"`
+	// Calls is the mean number of database calls per transaction, MaxCalls
+	// the most a transaction made and Statements their latencies by method.
+	// With --trace-statements, in summaries and stages only.
+	Calls      float64             `json:"calls,omitempty"`
+	MaxCalls   int                 `json:"maxCalls,omitempty"`
+	Statements []*statementSummary `json:"statements,omitempty"`
+}
+
+func newRunSummary(kind string, d time.Duration, totals runTotals, histograms map[tpcc.TransactionType]*hdrhistogram.Histogram, percentiles []float64) *runSummary {
+	s := &runSummary{
+		Type:         kind,
+		Duration:     d.Seconds(),
+		Transactions: make(map[string]*typeSummary),
+	}
+
+	queueTime := 0.0
+	for _, t := range tpcc.TransactionTypes {
+		s.Trx += totals[t].Count
+		s.Failed += totals[t].Failed
+		s.TimedOut += totals[t].TimedOut
+		s.Retries += totals[t].Retries
+		queueTime += totals[t].QueueTime
+	}
+
+	if s.Trx > 0 {
+		s.QueueTime = queueTime / float64(s.Trx)
+	}
+
+	for _, t := range tpcc.TransactionTypes {
+		s.Transactions[t.String()] = newTypeSummary(totals[t], histograms[t], s.Trx, percentiles)
+	}
+
+	if d > 0 {
+		s.TPS = float64(s.Trx) / d.Seconds()
+
+		// tpmC counts completed New-Order transactions, the expected
+		// rollbacks included
+		no := totals[tpcc.NewOrderTrx]
+		s.TpmC = float64(no.Count-no.Failed+no.RolledBack) / d.Minutes()
+	}
+
+	return s
+}
+
+// newTypeSummary summarizes the transactions counted in t, out of trx in total
+func newTypeSummary(t *typeTotals, h *hdrhistogram.Histogram, trx int, percentiles []float64) *typeSummary {
+	ts := &typeSummary{
+		Trx:      t.Count,
+		Failed:   t.Failed,
+		TimedOut: t.TimedOut,
+		Retries:  t.Retries,
+		Latency:  latencyMap(h, percentiles),
+	}
+
+	if trx > 0 {
+		ts.Mix = float64(ts.Trx) * 100 / float64(trx)
+	}
+
+	return ts
+}
+
+// latencyMap reports a histogram as min, mean, max and the percentiles
+func latencyMap(h *hdrhistogram.Histogram, percentiles []float64) map[string]float64 {
+	lat := summarize(h, percentiles)
+
+	m := map[string]float64{
+		"min":  lat.Min,
+		"mean": lat.Mean,
+		"max":  lat.Max,
+	}
+	for k, p := range percentiles {
+		m[percentileName(p)] = lat.Percentiles[k]
+	}
+
+	return m
+}
+
+// Routes of the transactions
+const (
+	routePrimary = "primary"
+	routeReplica = "replica"
+)
+
+var routes = []string{routePrimary, routeReplica}
+
+// routeStats are the totals and cumulative latencies of the transactions by
+// route, all types together
+type routeStats struct {
+	totals    map[string]*typeTotals
+	latencies map[string]*hdrhistogram.Histogram
+}
+
+func newRouteStats() *routeStats {
+	r := &routeStats{
+		totals:    make(map[string]*typeTotals),
+		latencies: make(map[string]*hdrhistogram.Histogram),
+	}
+	for _, route := range routes {
+		r.totals[route] = &typeTotals{}
+		r.latencies[route] = newHistogram()
+	}
+
+	return r
+}
+
+func (r *routeStats) add(trx tpcc.Transaction) {
+	route := routePrimary
+	if trx.Replica {
+		route = routeReplica
+	}
+
+	t := r.totals[route]
+	t.Count++
+	t.Retries += trx.Retries
+	if trx.Failed {
+		t.Failed++
+	}
+	if trx.TimedOut {
+		t.TimedOut++
+	}
+
+	recordLatency(r.latencies[route], trx.Time)
+}
+
+func (r *routeStats) summaries(trx int, percentiles []float64) map[string]*typeSummary {
+	s := make(map[string]*typeSummary)
+	for _, route := range routes {
+		s[route] = newTypeSummary(r.totals[route], r.latencies[route], trx, percentiles)
+	}
+
+	return s
+}
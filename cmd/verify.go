@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Percona-Lab/go-tpcc/tpcc"
+	"github.com/spf13/cobra"
+)
+
+var verifyLoadCmd = &cobra.Command{
+	Use:   "verify-load",
+	Short: "Check the row counts of the TPC-C dataset",
+	Long: `Count the rows of every table per warehouse and compare them with the
+cardinalities prepare stored with the dataset. For datasets without them the
+options describe the dataset.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		warehouses, _ := cmd.Flags().GetInt("warehouses")
+		threads, _ := cmd.Flags().GetInt("threads")
+		scalefactor, _ := cmd.Flags().GetFloat64("scalefactor")
+		dbname, _ := cmd.Root().PersistentFlags().GetString("db")
+		dbdriver, _ := cmd.Root().PersistentFlags().GetString("dbdriver")
+		uri, _ := cmd.Root().PersistentFlags().GetString("uri")
+
+		if dbname == "" || uri == "" {
+			panic("empty")
+		}
+
+		c := tpcc.Configuration{
+			DBDriver:    dbdriver,
+			DBName:      dbname,
+			URI:         uri,
+			WareHouses:  warehouses,
+			ScaleFactor: scalefactor,
+		}
+
+		err := scaleConfig(cmd.Flags(), &c)
+		if err == nil {
+			err = datasetConfig(cmd, cmd.Flags(), &c)
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		if !verifyLoad(&c, threads) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyLoadCmd)
+
+	verifyLoadCmd.Flags().Int("threads", 8, "Number of warehouses checked in parallel")
+	verifyLoadCmd.Flags().Int("warehouses", 10, "Number of warehouses the data was generated for")
+	verifyLoadCmd.Flags().Float64("scalefactor", 1, "Scale-factor the data was generated with")
+	addScaleFlags(verifyLoadCmd.Flags())
+}
+
+// verifyLoad compares the row counts with the expected cardinalities and
+// prints the mismatches. It reports whether the dataset is complete.
+func verifyLoad(c *tpcc.Configuration, threads int) bool {
+	fmt.Println("Verifying row counts")
+
+	w, err := tpcc.NewWorker(context.Background(), c, nil, nil, 0)
+	if err != nil {
+		panic(err)
+	}
+
+	mismatches, err := w.VerifyTables()
+	if err != nil {
+		panic(err)
+	}
+
+	var mu sync.Mutex
+	wg := &sync.WaitGroup{}
+	wj := make(chan int, c.WareHouses)
+	for i := 1; i <= c.WareHouses; i++ {
+		wj <- i
+	}
+	close(wj)
+
+	if threads > c.WareHouses {
+		threads = c.WareHouses
+	}
+
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			w, err := tpcc.NewWorker(context.Background(), c, nil, nil, i)
+			if err != nil {
+				panic(err)
+			}
+
+			for wId := range wj {
+				m, err := w.VerifyWarehouse(wId)
+				if err != nil {
+					panic(err)
+				}
+
+				mu.Lock()
+				mismatches = append(mismatches, m...)
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, m := range mismatches {
+		fmt.Fprintln(os.Stderr, m)
+	}
+
+	if len(mismatches) > 0 {
+		fmt.Printf("... %d mismatches\n", len(mismatches))
+		return false
+	}
+
+	fmt.Println("... done")
+	return true
+}
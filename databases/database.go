@@ -1,65 +1,186 @@
 package databases
 
 import (
-	"github.com/Percona-Lab/go-tpcc/databases/mongodb"
-	"github.com/Percona-Lab/go-tpcc/databases/mysql"
-	"github.com/Percona-Lab/go-tpcc/databases/postgresql"
+	"context"
+	"fmt"
 	"github.com/Percona-Lab/go-tpcc/tpcc/models"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
+// MetadataTable keeps the parameters the dataset was generated with as
+// key/value rows
+const MetadataTable = "TPCC_METADATA"
+
+// Tables lists the TPC-C tables, the referencing ones before those they
+// reference so they can be dropped in this order
+var Tables = []string{"ORDER_LINE", "NEW_ORDER", "HISTORY", "ORDERS", "CUSTOMER", "DISTRICT", "STOCK", "ITEM", "WAREHOUSE", MetadataTable}
+
+// WarehouseColumns maps the tables to the column holding their warehouse id,
+// ITEM is the only table not split by warehouse
+var WarehouseColumns = map[string]string{
+	"WAREHOUSE":  "W_ID",
+	"DISTRICT":   "D_W_ID",
+	"CUSTOMER":   "C_W_ID",
+	"HISTORY":    "H_W_ID",
+	"ORDERS":     "O_W_ID",
+	"NEW_ORDER":  "NO_W_ID",
+	"ORDER_LINE": "OL_W_ID",
+	"STOCK":      "S_W_ID",
+}
+
+// CountQuery builds the SQL query of CountRows
+func CountQuery(table string, warehouseId int) (string, []interface{}, error) {
+	query := "SELECT COUNT(*) FROM " + table
+	if warehouseId == 0 {
+		return query, nil, nil
+	}
+
+	column, ok := WarehouseColumns[table]
+	if !ok {
+		return "", nil, fmt.Errorf("table %s is not split by warehouse", table)
+	}
+
+	return query + " WHERE " + column + " = ?", []interface{}{warehouseId}, nil
+}
+
 type Database interface {
-	StartTrx() error
-	CommitTrx() error
-	RollbackTrx() error
-	CreateSchema() error
-	CreateIndexes() error
-	InsertOne(tableName string, d interface{}) error
-	InsertBatch(tableName string, d []interface{}) error
-	IncrementDistrictOrderId(warehouseId int, districtId int) error
-	GetNewOrder(warehouseId int, districtId int) (*models.NewOrder, error)
-	DeleteNewOrder(orderId int, warehouseId int, districtId int) error
-	GetCustomer(customerId int, warehouseId int, districtId int) (*models.Customer, error)
-	GetCustomerIdOrder(orderId int, warehouseId int, districtId int) (int, error)
-	UpdateOrders(orderId int, warehouseId int, districtId int, oCarrierId int, deliveryDate time.Time) error
-	SumOLAmount(orderId int, warehouseId int, districtId int) (float64, error)
-	UpdateCustomer(customerId int, warehouseId int, districtId int, sumOlTotal float64) error
-	GetNextOrderId(warehouseId int, districtId int) (int, error)
-	GetStockCount(orderIdLt int, orderIdGt int, threshold int, warehouseId int, districtId int) (int64, error)
-	GetCustomerById(customerId int, warehouseId int, districtId int) (*models.Customer, error)
-	GetCustomerByName(name string, warehouseId int, districtId int) (*models.Customer, error)
-	GetLastOrder(customerId int, warehouseId int, districtId int) (*models.Order, error)
-	GetOrderLines(orderId int, warehouseId int, districtId int) (*[]models.OrderLine, error)
-	GetWarehouse(warehouseId int) (*models.Warehouse, error)
-	UpdateWarehouseBalance(warehouseId int, amount float64) error
-	GetDistrict(warehouseId int, districtId int) (*models.District, error)
-	UpdateDistrictBalance(warehouseId int, districtId int, amount float64) error
-	InsertHistory(warehouseId int, districtId int, date time.Time, amount float64, data string) error
-	UpdateCredit(customerId int, warehouseId int, districtId int, balance float64, data string) error
-	CreateOrder(orderId int, customerId int, warehouseId int, districtId int, oCarrierId int, oOlCnt int, allLocal int, orderEntryDate time.Time, orderLine []models.OrderLine) error
-	GetItems(itemIds []int) (*[]models.Item, error)
-	UpdateStock(stockId int, warehouseId int, quantity int, ytd int, ordercnt int, remotecnt int) error
-	GetStockInfo(districtId int, iIds []int, iWids []int, allLocal int) (*[]models.Stock, error)
+	StartTrx(ctx context.Context) error
+	CommitTrx(ctx context.Context) error
+	RollbackTrx(ctx context.Context) error
+	CreateSchema(ctx context.Context) error
+	// Indexes lists the secondary indexes and foreign keys of the index
+	// profile in the order they are created. CreateIndex creates one of them,
+	// online if the database can build it without blocking writes.
+	Indexes() []Index
+	CreateIndex(ctx context.Context, index Index, online bool) error
+	// DropSchema drops every TPC-C table, TruncateSchema only deletes their rows
+	DropSchema(ctx context.Context) error
+	TruncateSchema(ctx context.Context) error
+	// CountRows counts the rows of a table in one warehouse, or in all of them
+	// when warehouseId is 0. Order lines embedded in orders count as rows.
+	CountRows(ctx context.Context, table string, warehouseId int) (int64, error)
+	// SumOrderLineCounts sums O_OL_CNT over the orders of a warehouse, which is
+	// the number of order lines they should have
+	SumOrderLineCounts(ctx context.Context, warehouseId int) (int64, error)
+	// SaveMetadata stores the parameters of the dataset, replacing the values
+	// of keys already stored. LoadMetadata returns them all.
+	SaveMetadata(ctx context.Context, metadata map[string]string) error
+	LoadMetadata(ctx context.Context) (map[string]string, error)
+	InsertOne(ctx context.Context, tableName string, d interface{}) error
+	InsertBatch(ctx context.Context, tableName string, d []interface{}) error
+	IncrementDistrictOrderId(ctx context.Context, warehouseId int, districtId int) error
+	GetNewOrder(ctx context.Context, warehouseId int, districtId int) (*models.NewOrder, error)
+	DeleteNewOrder(ctx context.Context, orderId int, warehouseId int, districtId int) error
+	GetCustomer(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error)
+	GetCustomerIdOrder(ctx context.Context, orderId int, warehouseId int, districtId int) (int, error)
+	UpdateOrders(ctx context.Context, orderId int, warehouseId int, districtId int, oCarrierId int, deliveryDate time.Time) error
+	SumOLAmount(ctx context.Context, orderId int, warehouseId int, districtId int) (float64, error)
+	UpdateCustomer(ctx context.Context, customerId int, warehouseId int, districtId int, sumOlTotal float64) error
+	GetNextOrderId(ctx context.Context, warehouseId int, districtId int) (int, error)
+	GetStockCount(ctx context.Context, orderIdLt int, orderIdGt int, threshold int, warehouseId int, districtId int) (int64, error)
+	GetCustomerById(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error)
+	GetCustomerByName(ctx context.Context, name string, warehouseId int, districtId int) (*models.Customer, error)
+	GetLastOrder(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Order, error)
+	GetOrderLines(ctx context.Context, orderId int, warehouseId int, districtId int) (*[]models.OrderLine, error)
+	GetWarehouse(ctx context.Context, warehouseId int) (*models.Warehouse, error)
+	UpdateWarehouseBalance(ctx context.Context, warehouseId int, amount float64) error
+	GetDistrict(ctx context.Context, warehouseId int, districtId int) (*models.District, error)
+	UpdateDistrictBalance(ctx context.Context, warehouseId int, districtId int, amount float64) error
+	InsertHistory(ctx context.Context, warehouseId int, districtId int, date time.Time, amount float64, data string) error
+	UpdateCredit(ctx context.Context, customerId int, warehouseId int, districtId int, balance float64, data string) error
+	CreateOrder(ctx context.Context, orderId int, customerId int, warehouseId int, districtId int, oCarrierId int, oOlCnt int, allLocal int, orderEntryDate time.Time, orderLine []models.OrderLine) error
+	GetItems(ctx context.Context, itemIds []int) (*[]models.Item, error)
+	UpdateStock(ctx context.Context, stockId int, warehouseId int, quantity int, ytd int, ordercnt int, remotecnt int) error
+	GetStockInfo(ctx context.Context, districtId int, iIds []int, iWids []int, allLocal int) (*[]models.Stock, error)
+	// Classify maps an error returned by the driver to an ErrorClass
+	Classify(err error) ErrorClass
+	// Close closes the connection, the database is not used afterwards
+	Close(ctx context.Context) error
+}
+
+// Options are passed to the driver factory when a new connection is opened
+type Options struct {
+	URI          string
+	DBName       string
+	Transactions bool
+	// FindAndModify is only used by the MongoDB driver
+	FindAndModify bool
+	// Partitions is used by CreateSchema of the SQL drivers
+	Partitions Partitioning
+	// ForeignKeys and IndexProfile are used by Indexes, foreign keys only by
+	// the SQL drivers
+	ForeignKeys  bool
+	IndexProfile string
+	// Storage is used by CreateSchema
+	Storage Storage
+	// ApplicationName names the connection on the server where supported,
+	// empty keeps the default
+	ApplicationName string
+	// ReadPreference and MaxStaleness route the reads of the MongoDB driver,
+	// empty reads from the primary
+	ReadPreference string
+	MaxStaleness   time.Duration
 }
 
-func NewDatabase(driver, uri, dbname, username, password string, transactions bool, findandmodify bool) (Database, error) {
-	var d Database
-	var err error
-	
-	switch driver {
-	case "mongodb":
-		d, err = mongodb.NewMongoDb(uri, dbname, transactions, findandmodify)
-	case "mysql":
-		d, err = mysql.NewMySQL(uri, dbname, transactions)
-	case "postgresql":
-		d, err = postgresql.NewPostgreSQL(uri, dbname, transactions)
-	default:
-		panic("Unknown database driver")
+// Factory opens a new connection to the database
+type Factory func(options Options) (Database, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Factory)
+)
+
+// Register makes a database driver available under the given name.
+// It is meant to be called from the init function of the driver package and
+// panics if the name is registered twice or the factory is nil.
+func Register(name string, factory Factory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if factory == nil {
+		panic("databases: Register factory is nil")
+	}
+
+	if _, dup := drivers[name]; dup {
+		panic("databases: Register called twice for driver " + name)
+	}
+
+	drivers[name] = factory
+}
+
+// Drivers returns the sorted names of the registered drivers
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	var list []string
+	for name := range drivers {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+func NewDatabase(driver string, options Options) (Database, error) {
+	driversMu.RLock()
+	factory, ok := drivers[driver]
+	driversMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown database driver %q (available: %s)", driver, strings.Join(Drivers(), "|"))
+	}
+
+	if err := options.Partitions.Validate(); err != nil {
+		return nil, err
 	}
 
-	if err != nil {
+	if err := ValidateIndexProfile(options.IndexProfile); err != nil {
 		return nil, err
 	}
 
-	return d, nil
+	return factory(options)
 }
@@ -0,0 +1,44 @@
+package databases
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// ErrorClass groups driver errors for reporting and to decide whether a
+// failed transaction is worth retrying
+type ErrorClass string
+
+const (
+	ClassNone ErrorClass = ""
+	// ClassConflict covers deadlocks, lock wait timeouts, serialization
+	// failures and write conflicts. These are the only retryable errors.
+	ClassConflict   ErrorClass = "conflict"
+	ClassNotFound   ErrorClass = "not_found"
+	ClassTimeout    ErrorClass = "timeout"
+	ClassCanceled   ErrorClass = "canceled"
+	ClassConnection ErrorClass = "connection"
+	// ClassRollback is an expected rollback, e.g. the 1% of New-Order
+	// transactions with an unused item number
+	ClassRollback ErrorClass = "rollback"
+	ClassOther    ErrorClass = "other"
+)
+
+// Retryable reports whether a transaction that failed with this class of
+// error should be run again
+func (c ErrorClass) Retryable() bool {
+	return c == ClassConflict
+}
+
+// IsConnectionError reports network errors and connections closed by the
+// server, which the drivers classify as ClassConnection. Network timeouts
+// are left to the timeout checks of the drivers.
+func IsConnectionError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return !netErr.Timeout()
+	}
+
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,299 @@
+package databases
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+// FaultRule selects the calls a fault applies to
+type FaultRule struct {
+	// Probability of the fault per call, between 0 and 1
+	Probability float64
+	// Methods are the Database methods it applies to, all when empty
+	Methods []string
+}
+
+// LatencyFault delays calls by a random duration between Min and Max
+type LatencyFault struct {
+	FaultRule `mapstructure:",squash"`
+	Min       time.Duration
+	Max       time.Duration
+}
+
+// ErrorFault fails calls with an error of Class, ClassOther by default
+type ErrorFault struct {
+	FaultRule `mapstructure:",squash"`
+	Class     ErrorClass
+}
+
+// DropFault drops the connection: the call and every call for Duration
+// after it fail with a connection error, the open transaction is lost
+type DropFault struct {
+	FaultRule `mapstructure:",squash"`
+	Duration  time.Duration
+}
+
+// Faults configures the faults injected by InjectFaults
+type Faults struct {
+	// Seed makes the faults reproducible, 0 seeds from the clock
+	Seed    int64
+	Latency LatencyFault
+	// Errors fail calls of single methods
+	Errors []ErrorFault
+	// Conflict fails calls with a simulated deadlock or serialization
+	// failure, which the executor retries
+	Conflict FaultRule
+	// Commit fails CommitTrx, with a conflict unless Class is set
+	Commit ErrorFault
+	Drop   DropFault
+}
+
+// Validate checks the probabilities, methods and classes of f
+func (f *Faults) Validate() error {
+	check := func(name string, r FaultRule) error {
+		if r.Probability < 0 || r.Probability > 1 {
+			return fmt.Errorf("%s: probability must be between 0 and 1, got %v", name, r.Probability)
+		}
+
+		for _, method := range r.Methods {
+			if _, ok := reflect.TypeOf((*Database)(nil)).Elem().MethodByName(method); !ok {
+				return fmt.Errorf("%s: unknown method %q", name, method)
+			}
+		}
+
+		return nil
+	}
+
+	checkClass := func(name string, c ErrorClass) error {
+		switch c {
+		case ClassNone, ClassConflict, ClassNotFound, ClassTimeout, ClassCanceled, ClassConnection, ClassRollback, ClassOther:
+			return nil
+		}
+
+		return fmt.Errorf("%s: unknown error class %q", name, c)
+	}
+
+	if err := check("latency", f.Latency.FaultRule); err != nil {
+		return err
+	}
+	if f.Latency.Min < 0 || f.Latency.Max < f.Latency.Min {
+		return fmt.Errorf("latency: need 0 <= min <= max, got %s and %s", f.Latency.Min, f.Latency.Max)
+	}
+
+	for i, e := range f.Errors {
+		name := fmt.Sprintf("errors[%d]", i)
+		if err := check(name, e.FaultRule); err != nil {
+			return err
+		}
+		if err := checkClass(name, e.Class); err != nil {
+			return err
+		}
+	}
+
+	if err := check("conflict", f.Conflict); err != nil {
+		return err
+	}
+
+	if err := check("commit", f.Commit.FaultRule); err != nil {
+		return err
+	}
+	if err := checkClass("commit", f.Commit.Class); err != nil {
+		return err
+	}
+
+	if err := check("drop", f.Drop.FaultRule); err != nil {
+		return err
+	}
+	if f.Drop.Duration < 0 {
+		return fmt.Errorf("drop: duration must not be negative, got %s", f.Drop.Duration)
+	}
+
+	return nil
+}
+
+// FaultError is an error injected by InjectFaults
+type FaultError struct {
+	Method string
+	Fault  string
+	Class  ErrorClass
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("injected %s in %s", e.Fault, e.Method)
+}
+
+// InjectFaults returns a Database that injects faults into the calls to db.
+// It works with any driver and is not safe for concurrent use, like the
+// drivers themselves.
+func InjectFaults(db Database, faults Faults) (Database, error) {
+	fi, err := NewFaultInjector(faults)
+	if err != nil {
+		return nil, err
+	}
+
+	return fi.Wrap(db), nil
+}
+
+// FaultInjector injects faults into the connections of one worker, a
+// dropped connection stays down for the new connections. It is not safe for
+// concurrent use.
+type FaultInjector struct {
+	faults Faults
+	rand   *rand.Rand
+	// downUntil is the end of a dropped connection
+	downUntil time.Time
+}
+
+func NewFaultInjector(faults Faults) (*FaultInjector, error) {
+	if err := faults.Validate(); err != nil {
+		return nil, err
+	}
+
+	seed := faults.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &FaultInjector{
+		faults: faults,
+		rand:   rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// Wrap returns a Database injecting faults into the calls to db. A failed
+// CommitTrx or RollbackTrx rolls the transaction of db back, as the server
+// would.
+func (fi *FaultInjector) Wrap(db Database) Database {
+	c := &faultyConnection{fi: fi, db: db}
+	return Intercept(db, c.intercept)
+}
+
+// Open returns open failing while the connection is dropped, the
+// connections it opens are wrapped
+func (fi *FaultInjector) Open(open func() (Database, error)) func() (Database, error) {
+	return func() (Database, error) {
+		if fi.down() {
+			return nil, &FaultError{Method: "Open", Fault: "dropped connection", Class: ClassConnection}
+		}
+
+		db, err := open()
+		if err != nil {
+			return nil, err
+		}
+
+		return fi.Wrap(db), nil
+	}
+}
+
+func (fi *FaultInjector) down() bool {
+	return time.Now().Before(fi.downUntil)
+}
+
+type faultyConnection struct {
+	fi *FaultInjector
+	db Database
+	// inTrx is set while db has an open transaction
+	inTrx bool
+}
+
+func (c *faultyConnection) intercept(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	fi := c.fi
+
+	if fi.down() {
+		return &FaultError{Method: method, Fault: "dropped connection", Class: ClassConnection}
+	}
+
+	if fi.hit(method, fi.faults.Drop.FaultRule) {
+		fi.downUntil = time.Now().Add(fi.faults.Drop.Duration)
+		c.abort(ctx)
+		return &FaultError{Method: method, Fault: "dropped connection", Class: ClassConnection}
+	}
+
+	if fi.hit(method, fi.faults.Latency.FaultRule) {
+		d := fi.faults.Latency.Min
+		if spread := fi.faults.Latency.Max - fi.faults.Latency.Min; spread > 0 {
+			d += time.Duration(fi.rand.Int63n(int64(spread) + 1))
+		}
+
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+
+	if fault := fi.fault(method); fault != nil {
+		// a failed commit or rollback ends the transaction all the same
+		if method == "CommitTrx" || method == "RollbackTrx" {
+			c.abort(ctx)
+		}
+		return fault
+	}
+
+	err := call(ctx)
+
+	switch method {
+	case "StartTrx":
+		c.inTrx = err == nil
+	case "CommitTrx", "RollbackTrx":
+		c.inTrx = false
+	}
+
+	return err
+}
+
+// abort rolls back the open transaction, as the server does when the
+// connection is lost or the commit fails, so the driver can start a new one
+func (c *faultyConnection) abort(ctx context.Context) {
+	if !c.inTrx {
+		return
+	}
+
+	c.db.RollbackTrx(ctx)
+	c.inTrx = false
+}
+
+// fault picks the error injected into a call, if any
+func (fi *FaultInjector) fault(method string) *FaultError {
+	for _, e := range fi.faults.Errors {
+		if fi.hit(method, e.FaultRule) {
+			class := e.Class
+			if class == ClassNone {
+				class = ClassOther
+			}
+			return &FaultError{Method: method, Fault: "error", Class: class}
+		}
+	}
+
+	if fi.hit(method, fi.faults.Conflict) {
+		return &FaultError{Method: method, Fault: "conflict", Class: ClassConflict}
+	}
+
+	if method == "CommitTrx" && fi.hit(method, fi.faults.Commit.FaultRule) {
+		class := fi.faults.Commit.Class
+		if class == ClassNone {
+			class = ClassConflict
+		}
+		return &FaultError{Method: method, Fault: "commit failure", Class: class}
+	}
+
+	return nil
+}
+
+// hit decides whether the fault of rule r happens on this call
+func (fi *FaultInjector) hit(method string, r FaultRule) bool {
+	if r.Probability <= 0 {
+		return false
+	}
+
+	if len(r.Methods) > 0 && !containsString(r.Methods, method) {
+		return false
+	}
+
+	return fi.rand.Float64() < r.Probability
+}
@@ -0,0 +1,97 @@
+package databases
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Index profiles select the secondary indexes returned by Indexes
+const (
+	// IndexMinimal creates none, only the primary keys are there
+	IndexMinimal = "minimal"
+	// IndexStandard creates the indexes looking up customers by last name
+	// and orders by customer, and those backing the foreign keys
+	IndexStandard = "standard"
+	// IndexCovering extends the standard indexes so the queries of the
+	// transactions are answered from the index alone
+	IndexCovering = "covering"
+)
+
+// ValidateIndexProfile checks the name of an index profile, empty stands for
+// IndexStandard
+func ValidateIndexProfile(profile string) error {
+	switch profile {
+	case "", IndexMinimal, IndexStandard, IndexCovering:
+		return nil
+	}
+
+	return fmt.Errorf("unknown index profile %q, use %s|%s|%s", profile, IndexMinimal, IndexStandard, IndexCovering)
+}
+
+// Index is a secondary index or a foreign key of the schema
+type Index struct {
+	Table string
+	Name  string
+	// ForeignKey is set for foreign key constraints. They are created after
+	// the indexes and the data, the loader does not insert in their order.
+	ForeignKey bool
+	// Definition is up to the driver, the statement of the SQL drivers
+	Definition interface{}
+}
+
+func (i Index) String() string {
+	return i.Table + "." + i.Name
+}
+
+var (
+	createIndex   = regexp.MustCompile(`(?i)^\s*CREATE INDEX (\w+)\s+ON\s+(\w+)`)
+	addForeignKey = regexp.MustCompile(`(?i)^\s*ALTER TABLE (\w+) ADD CONSTRAINT (\w+) FOREIGN KEY`)
+)
+
+// The statements shared by the SQL drivers, which build the covering
+// indexes their own way
+var (
+	// SQLStandardIndexes look up customers by last name and orders by customer
+	SQLStandardIndexes = []string{
+		"CREATE INDEX idx_customer on CUSTOMER (C_W_ID,C_D_ID,C_LAST,C_FIRST)",
+		"CREATE INDEX idx_orders  ON ORDERS  (O_W_ID,O_D_ID,O_C_ID,O_ID)",
+	}
+
+	// SQLForeignKeyIndexes are the indexes on the referencing columns of the
+	// foreign keys that are not a prefix of the primary key
+	SQLForeignKeyIndexes = []string{
+		"CREATE INDEX fkey_stock_2 ON STOCK (S_I_ID)",
+		"CREATE INDEX fkey_order_line_2 ON ORDER_LINE (OL_SUPPLY_W_ID,OL_I_ID)",
+		"CREATE INDEX fkey_history_1 ON HISTORY (H_C_W_ID,H_C_D_ID,H_C_ID)",
+		"CREATE INDEX fkey_history_2 ON HISTORY (H_W_ID,H_D_ID)",
+	}
+
+	// SQLForeignKeys are the foreign keys of the schema
+	SQLForeignKeys = []string{
+		"ALTER TABLE NEW_ORDER ADD CONSTRAINT fkey_new_orders_1 FOREIGN KEY(NO_W_ID,NO_D_ID,NO_O_ID) REFERENCES ORDERS(O_W_ID,O_D_ID,O_ID)",
+		"ALTER TABLE ORDERS ADD CONSTRAINT fkey_orders_1 FOREIGN KEY(O_W_ID,O_D_ID,O_C_ID) REFERENCES CUSTOMER(C_W_ID,C_D_ID,C_ID)",
+		"ALTER TABLE CUSTOMER ADD CONSTRAINT fkey_customer_1 FOREIGN KEY(C_W_ID,C_D_ID) REFERENCES DISTRICT(D_W_ID,D_ID)",
+		"ALTER TABLE HISTORY ADD CONSTRAINT fkey_history_1 FOREIGN KEY(H_C_W_ID,H_C_D_ID,H_C_ID) REFERENCES CUSTOMER(C_W_ID,C_D_ID,C_ID)",
+		"ALTER TABLE HISTORY ADD CONSTRAINT fkey_history_2 FOREIGN KEY(H_W_ID,H_D_ID) REFERENCES DISTRICT(D_W_ID,D_ID)",
+		"ALTER TABLE DISTRICT ADD CONSTRAINT fkey_district_1 FOREIGN KEY(D_W_ID) REFERENCES WAREHOUSE(W_ID)",
+		"ALTER TABLE ORDER_LINE ADD CONSTRAINT fkey_order_line_1 FOREIGN KEY(OL_W_ID,OL_D_ID,OL_O_ID) REFERENCES ORDERS(O_W_ID,O_D_ID,O_ID)",
+		"ALTER TABLE ORDER_LINE ADD CONSTRAINT fkey_order_line_2 FOREIGN KEY(OL_SUPPLY_W_ID,OL_I_ID) REFERENCES STOCK(S_W_ID,S_I_ID)",
+		"ALTER TABLE STOCK ADD CONSTRAINT fkey_stock_1 FOREIGN KEY(S_W_ID) REFERENCES WAREHOUSE(W_ID)",
+		"ALTER TABLE STOCK ADD CONSTRAINT fkey_stock_2 FOREIGN KEY(S_I_ID) REFERENCES ITEM(I_ID)",
+	}
+)
+
+// SQLIndex describes the index or foreign key created by a CREATE INDEX or
+// ALTER TABLE ADD CONSTRAINT statement
+func SQLIndex(query string) Index {
+	if m := addForeignKey.FindStringSubmatch(query); m != nil {
+		return Index{Table: m[1], Name: m[2], ForeignKey: true, Definition: query}
+	}
+
+	i := Index{Definition: query}
+	if m := createIndex.FindStringSubmatch(query); m != nil {
+		i.Table, i.Name = m[2], m[1]
+	}
+
+	return i
+}
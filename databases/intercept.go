@@ -0,0 +1,354 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Percona-Lab/go-tpcc/tpcc/models"
+)
+
+// Interceptor is called around every Database method. method is the name of
+// the interface method and call runs it against the wrapped database, so the
+// interceptor can change the context, measure the call or replace its error.
+type Interceptor func(ctx context.Context, method string, call func(ctx context.Context) error) error
+
+// Intercept returns a Database that passes every call to db through i
+func Intercept(db Database, i Interceptor) Database {
+	return &intercepted{next: db, i: i}
+}
+
+// QueryTimeout returns an interceptor limiting every statement to d.
+// StartTrx is left alone, since the drivers keep its context for the whole
+// transaction and the transaction itself is limited by the caller.
+func QueryTimeout(d time.Duration) Interceptor {
+	return func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		if method == "StartTrx" {
+			return call(ctx)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+
+		err := call(ctx)
+		if err != nil && ctx.Err() == context.DeadlineExceeded && !errors.Is(err, context.DeadlineExceeded) {
+			// drivers do not always wrap the context error
+			err = fmt.Errorf("%s: %v: %w", method, err, context.DeadlineExceeded)
+		}
+
+		return err
+	}
+}
+
+type intercepted struct {
+	next Database
+	i    Interceptor
+}
+
+func (db *intercepted) Classify(err error) ErrorClass {
+	// injected errors and those of a reconnect are unknown to the driver
+	var fault *FaultError
+	if errors.As(err, &fault) {
+		return fault.Class
+	}
+
+	var reconnectErr *ReconnectError
+	if errors.As(err, &reconnectErr) {
+		return ClassConnection
+	}
+
+	return db.next.Classify(err)
+}
+
+func (db *intercepted) StartTrx(ctx context.Context) error {
+	return db.i(ctx, "StartTrx", func(ctx context.Context) error {
+		return db.next.StartTrx(ctx)
+	})
+}
+
+func (db *intercepted) CommitTrx(ctx context.Context) error {
+	return db.i(ctx, "CommitTrx", func(ctx context.Context) error {
+		return db.next.CommitTrx(ctx)
+	})
+}
+
+func (db *intercepted) RollbackTrx(ctx context.Context) error {
+	return db.i(ctx, "RollbackTrx", func(ctx context.Context) error {
+		return db.next.RollbackTrx(ctx)
+	})
+}
+
+func (db *intercepted) CreateSchema(ctx context.Context) error {
+	return db.i(ctx, "CreateSchema", func(ctx context.Context) error {
+		return db.next.CreateSchema(ctx)
+	})
+}
+
+func (db *intercepted) Indexes() []Index {
+	return db.next.Indexes()
+}
+
+func (db *intercepted) Close(ctx context.Context) error {
+	return db.next.Close(ctx)
+}
+
+func (db *intercepted) CreateIndex(ctx context.Context, index Index, online bool) error {
+	return db.i(ctx, "CreateIndex", func(ctx context.Context) error {
+		return db.next.CreateIndex(ctx, index, online)
+	})
+}
+
+func (db *intercepted) DropSchema(ctx context.Context) error {
+	return db.i(ctx, "DropSchema", func(ctx context.Context) error {
+		return db.next.DropSchema(ctx)
+	})
+}
+
+func (db *intercepted) TruncateSchema(ctx context.Context) error {
+	return db.i(ctx, "TruncateSchema", func(ctx context.Context) error {
+		return db.next.TruncateSchema(ctx)
+	})
+}
+
+func (db *intercepted) CountRows(ctx context.Context, table string, warehouseId int) (n int64, err error) {
+	err = db.i(ctx, "CountRows", func(ctx context.Context) error {
+		n, err = db.next.CountRows(ctx, table, warehouseId)
+		return err
+	})
+	return n, err
+}
+
+func (db *intercepted) SumOrderLineCounts(ctx context.Context, warehouseId int) (n int64, err error) {
+	err = db.i(ctx, "SumOrderLineCounts", func(ctx context.Context) error {
+		n, err = db.next.SumOrderLineCounts(ctx, warehouseId)
+		return err
+	})
+	return n, err
+}
+
+func (db *intercepted) SaveMetadata(ctx context.Context, metadata map[string]string) error {
+	return db.i(ctx, "SaveMetadata", func(ctx context.Context) error {
+		return db.next.SaveMetadata(ctx, metadata)
+	})
+}
+
+func (db *intercepted) LoadMetadata(ctx context.Context) (metadata map[string]string, err error) {
+	err = db.i(ctx, "LoadMetadata", func(ctx context.Context) error {
+		metadata, err = db.next.LoadMetadata(ctx)
+		return err
+	})
+	return metadata, err
+}
+
+func (db *intercepted) InsertOne(ctx context.Context, tableName string, d interface{}) error {
+	return db.i(ctx, "InsertOne", func(ctx context.Context) error {
+		return db.next.InsertOne(ctx, tableName, d)
+	})
+}
+
+func (db *intercepted) InsertBatch(ctx context.Context, tableName string, d []interface{}) error {
+	return db.i(ctx, "InsertBatch", func(ctx context.Context) error {
+		return db.next.InsertBatch(ctx, tableName, d)
+	})
+}
+
+func (db *intercepted) IncrementDistrictOrderId(ctx context.Context, warehouseId int, districtId int) error {
+	return db.i(ctx, "IncrementDistrictOrderId", func(ctx context.Context) error {
+		return db.next.IncrementDistrictOrderId(ctx, warehouseId, districtId)
+	})
+}
+
+func (db *intercepted) GetNewOrder(ctx context.Context, warehouseId int, districtId int) (*models.NewOrder, error) {
+	var r *models.NewOrder
+	err := db.i(ctx, "GetNewOrder", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetNewOrder(ctx, warehouseId, districtId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) DeleteNewOrder(ctx context.Context, orderId int, warehouseId int, districtId int) error {
+	return db.i(ctx, "DeleteNewOrder", func(ctx context.Context) error {
+		return db.next.DeleteNewOrder(ctx, orderId, warehouseId, districtId)
+	})
+}
+
+func (db *intercepted) GetCustomer(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error) {
+	var r *models.Customer
+	err := db.i(ctx, "GetCustomer", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetCustomer(ctx, customerId, warehouseId, districtId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) GetCustomerIdOrder(ctx context.Context, orderId int, warehouseId int, districtId int) (int, error) {
+	var r int
+	err := db.i(ctx, "GetCustomerIdOrder", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetCustomerIdOrder(ctx, orderId, warehouseId, districtId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) UpdateOrders(ctx context.Context, orderId int, warehouseId int, districtId int, oCarrierId int, deliveryDate time.Time) error {
+	return db.i(ctx, "UpdateOrders", func(ctx context.Context) error {
+		return db.next.UpdateOrders(ctx, orderId, warehouseId, districtId, oCarrierId, deliveryDate)
+	})
+}
+
+func (db *intercepted) SumOLAmount(ctx context.Context, orderId int, warehouseId int, districtId int) (float64, error) {
+	var r float64
+	err := db.i(ctx, "SumOLAmount", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.SumOLAmount(ctx, orderId, warehouseId, districtId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) UpdateCustomer(ctx context.Context, customerId int, warehouseId int, districtId int, sumOlTotal float64) error {
+	return db.i(ctx, "UpdateCustomer", func(ctx context.Context) error {
+		return db.next.UpdateCustomer(ctx, customerId, warehouseId, districtId, sumOlTotal)
+	})
+}
+
+func (db *intercepted) GetNextOrderId(ctx context.Context, warehouseId int, districtId int) (int, error) {
+	var r int
+	err := db.i(ctx, "GetNextOrderId", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetNextOrderId(ctx, warehouseId, districtId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) GetStockCount(ctx context.Context, orderIdLt int, orderIdGt int, threshold int, warehouseId int, districtId int) (int64, error) {
+	var r int64
+	err := db.i(ctx, "GetStockCount", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetStockCount(ctx, orderIdLt, orderIdGt, threshold, warehouseId, districtId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) GetCustomerById(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error) {
+	var r *models.Customer
+	err := db.i(ctx, "GetCustomerById", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetCustomerById(ctx, customerId, warehouseId, districtId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) GetCustomerByName(ctx context.Context, name string, warehouseId int, districtId int) (*models.Customer, error) {
+	var r *models.Customer
+	err := db.i(ctx, "GetCustomerByName", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetCustomerByName(ctx, name, warehouseId, districtId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) GetLastOrder(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Order, error) {
+	var r *models.Order
+	err := db.i(ctx, "GetLastOrder", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetLastOrder(ctx, customerId, warehouseId, districtId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) GetOrderLines(ctx context.Context, orderId int, warehouseId int, districtId int) (*[]models.OrderLine, error) {
+	var r *[]models.OrderLine
+	err := db.i(ctx, "GetOrderLines", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetOrderLines(ctx, orderId, warehouseId, districtId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) GetWarehouse(ctx context.Context, warehouseId int) (*models.Warehouse, error) {
+	var r *models.Warehouse
+	err := db.i(ctx, "GetWarehouse", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetWarehouse(ctx, warehouseId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) UpdateWarehouseBalance(ctx context.Context, warehouseId int, amount float64) error {
+	return db.i(ctx, "UpdateWarehouseBalance", func(ctx context.Context) error {
+		return db.next.UpdateWarehouseBalance(ctx, warehouseId, amount)
+	})
+}
+
+func (db *intercepted) GetDistrict(ctx context.Context, warehouseId int, districtId int) (*models.District, error) {
+	var r *models.District
+	err := db.i(ctx, "GetDistrict", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetDistrict(ctx, warehouseId, districtId)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) UpdateDistrictBalance(ctx context.Context, warehouseId int, districtId int, amount float64) error {
+	return db.i(ctx, "UpdateDistrictBalance", func(ctx context.Context) error {
+		return db.next.UpdateDistrictBalance(ctx, warehouseId, districtId, amount)
+	})
+}
+
+func (db *intercepted) InsertHistory(ctx context.Context, warehouseId int, districtId int, date time.Time, amount float64, data string) error {
+	return db.i(ctx, "InsertHistory", func(ctx context.Context) error {
+		return db.next.InsertHistory(ctx, warehouseId, districtId, date, amount, data)
+	})
+}
+
+func (db *intercepted) UpdateCredit(ctx context.Context, customerId int, warehouseId int, districtId int, balance float64, data string) error {
+	return db.i(ctx, "UpdateCredit", func(ctx context.Context) error {
+		return db.next.UpdateCredit(ctx, customerId, warehouseId, districtId, balance, data)
+	})
+}
+
+func (db *intercepted) CreateOrder(ctx context.Context, orderId int, customerId int, warehouseId int, districtId int, oCarrierId int, oOlCnt int, allLocal int, orderEntryDate time.Time, orderLine []models.OrderLine) error {
+	return db.i(ctx, "CreateOrder", func(ctx context.Context) error {
+		return db.next.CreateOrder(ctx, orderId, customerId, warehouseId, districtId, oCarrierId, oOlCnt, allLocal, orderEntryDate, orderLine)
+	})
+}
+
+func (db *intercepted) GetItems(ctx context.Context, itemIds []int) (*[]models.Item, error) {
+	var r *[]models.Item
+	err := db.i(ctx, "GetItems", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetItems(ctx, itemIds)
+		return err
+	})
+	return r, err
+}
+
+func (db *intercepted) UpdateStock(ctx context.Context, stockId int, warehouseId int, quantity int, ytd int, ordercnt int, remotecnt int) error {
+	return db.i(ctx, "UpdateStock", func(ctx context.Context) error {
+		return db.next.UpdateStock(ctx, stockId, warehouseId, quantity, ytd, ordercnt, remotecnt)
+	})
+}
+
+func (db *intercepted) GetStockInfo(ctx context.Context, districtId int, iIds []int, iWids []int, allLocal int) (*[]models.Stock, error) {
+	var r *[]models.Stock
+	err := db.i(ctx, "GetStockInfo", func(ctx context.Context) error {
+		var err error
+		r, err = db.next.GetStockInfo(ctx, districtId, iIds, iWids, allLocal)
+		return err
+	})
+	return r, err
+}
@@ -0,0 +1,1045 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"github.com/Percona-Lab/go-tpcc/tpcc/models"
+)
+
+// ErrNotFound is returned when a lookup does not match any row, the same way
+// sql.ErrNoRows or mongo.ErrNoDocuments are returned by the other drivers.
+var ErrNotFound = errors.New("memory: no rows found")
+
+type dKey struct{ w, d int }
+type cKey struct{ w, d, c int }
+type oKey struct{ w, d, o int }
+type sKey struct{ w, i int }
+
+// store holds the tables of one database. It is shared by every connection
+// opened with the same database name.
+type store struct {
+	mu         sync.Mutex
+	warehouses map[int]models.Warehouse
+	districts  map[dKey]models.District
+	customers  map[cKey]models.Customer
+	history    []models.History
+	orders     map[oKey]models.Order
+	newOrders  map[oKey]models.NewOrder
+	orderLines map[oKey][]models.OrderLine
+	items      map[int]models.Item
+	stock      map[sKey]models.Stock
+	metadata   map[string]string
+}
+
+func newStore() *store {
+	s := &store{}
+	s.reset()
+
+	return s
+}
+
+// reset empties every table, s.mu must be held unless s is new
+func (s *store) reset() {
+	s.warehouses = make(map[int]models.Warehouse)
+	s.districts = make(map[dKey]models.District)
+	s.customers = make(map[cKey]models.Customer)
+	s.history = nil
+	s.orders = make(map[oKey]models.Order)
+	s.newOrders = make(map[oKey]models.NewOrder)
+	s.orderLines = make(map[oKey][]models.OrderLine)
+	s.items = make(map[int]models.Item)
+	s.stock = make(map[sKey]models.Stock)
+	s.metadata = make(map[string]string)
+}
+
+var (
+	storesMu sync.Mutex
+	stores   = make(map[string]*store)
+)
+
+// Memory is a reference implementation of the TPC-C data access layer over Go maps.
+// Transactions are serializable: StartTrx takes the database lock and keeps it
+// until CommitTrx or RollbackTrx, and every change made in between is recorded
+// so that RollbackTrx can restore the state seen at StartTrx.
+type Memory struct {
+	s    *store
+	isTx bool
+	undo []func()
+}
+
+func init() {
+	databases.Register("memory", func(options databases.Options) (databases.Database, error) {
+		if options.Partitions.Enabled() {
+			return nil, fmt.Errorf("the memory driver does not support partitioning")
+		}
+
+		if options.ReadPreference != "" {
+			return nil, fmt.Errorf("the memory driver has no read preference")
+		}
+
+		if !options.Storage.Empty() {
+			return nil, fmt.Errorf("the memory driver has no storage options")
+		}
+
+		_, err := options.Storage.Resolve(map[string]databases.Storage{databases.DefaultStorage: {}})
+		if err != nil {
+			return nil, err
+		}
+
+		return NewMemory(options.DBName)
+	})
+}
+
+func NewMemory(dbname string) (*Memory, error) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	s, ok := stores[dbname]
+	if !ok {
+		s = newStore()
+		stores[dbname] = s
+	}
+
+	return &Memory{
+		s: s,
+	}, nil
+}
+
+// Drop forgets the database with the given name. Connections that are already open keep
+// working on the old data.
+func Drop(dbname string) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	delete(stores, dbname)
+}
+
+// lock serializes the access to the store. Inside of a transaction the lock is already held.
+func (db *Memory) lock() func() {
+	if db.isTx {
+		return func() {}
+	}
+
+	db.s.mu.Lock()
+	return db.s.mu.Unlock
+}
+
+// record remembers how to undo a change made inside of a transaction
+func (db *Memory) record(fn func()) {
+	if db.isTx {
+		db.undo = append(db.undo, fn)
+	}
+}
+
+func (db *Memory) StartTrx(ctx context.Context) error {
+	if db.isTx {
+		return fmt.Errorf("transaction already started")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	db.s.mu.Lock()
+	db.isTx = true
+	db.undo = nil
+	return nil
+}
+
+func (db *Memory) CommitTrx(ctx context.Context) error {
+	if !db.isTx {
+		return fmt.Errorf("no transaction started")
+	}
+
+	db.undo = nil
+	db.isTx = false
+	db.s.mu.Unlock()
+	return nil
+}
+
+func (db *Memory) RollbackTrx(ctx context.Context) error {
+	if !db.isTx {
+		return fmt.Errorf("no transaction started")
+	}
+
+	for i := len(db.undo) - 1; i >= 0; i-- {
+		db.undo[i]()
+	}
+
+	db.undo = nil
+	db.isTx = false
+	db.s.mu.Unlock()
+	return nil
+}
+
+func (db *Memory) CreateSchema(ctx context.Context) error {
+	return nil
+}
+
+// Indexes is empty, the maps are the indexes
+func (db *Memory) Indexes() []databases.Index {
+	return nil
+}
+
+func (db *Memory) CreateIndex(ctx context.Context, index databases.Index, online bool) error {
+	return fmt.Errorf("unknown index %s", index)
+}
+
+// DropSchema empties the tables, there is no schema to drop
+func (db *Memory) DropSchema(ctx context.Context) error {
+	return db.TruncateSchema(ctx)
+}
+
+func (db *Memory) TruncateSchema(ctx context.Context) error {
+	defer db.lock()()
+
+	db.s.reset()
+	return nil
+}
+
+func (db *Memory) putWarehouse(w models.Warehouse) {
+	k := w.W_ID
+	old, ok := db.s.warehouses[k]
+	db.record(func() {
+		if ok {
+			db.s.warehouses[k] = old
+		} else {
+			delete(db.s.warehouses, k)
+		}
+	})
+	db.s.warehouses[k] = w
+}
+
+func (db *Memory) putDistrict(d models.District) {
+	k := dKey{d.D_W_ID, d.D_ID}
+	old, ok := db.s.districts[k]
+	db.record(func() {
+		if ok {
+			db.s.districts[k] = old
+		} else {
+			delete(db.s.districts, k)
+		}
+	})
+	db.s.districts[k] = d
+}
+
+func (db *Memory) putCustomer(c models.Customer) {
+	k := cKey{c.C_W_ID, c.C_D_ID, c.C_ID}
+	old, ok := db.s.customers[k]
+	db.record(func() {
+		if ok {
+			db.s.customers[k] = old
+		} else {
+			delete(db.s.customers, k)
+		}
+	})
+	db.s.customers[k] = c
+}
+
+func (db *Memory) putOrder(o models.Order) {
+	k := oKey{o.O_W_ID, o.O_D_ID, o.O_ID}
+	old, ok := db.s.orders[k]
+	db.record(func() {
+		if ok {
+			db.s.orders[k] = old
+		} else {
+			delete(db.s.orders, k)
+		}
+	})
+	o.ORDER_LINE = nil
+	db.s.orders[k] = o
+}
+
+func (db *Memory) putNewOrder(no models.NewOrder) {
+	k := oKey{no.NO_W_ID, no.NO_D_ID, no.NO_O_ID}
+	old, ok := db.s.newOrders[k]
+	db.record(func() {
+		if ok {
+			db.s.newOrders[k] = old
+		} else {
+			delete(db.s.newOrders, k)
+		}
+	})
+	db.s.newOrders[k] = no
+}
+
+func (db *Memory) deleteNewOrder(k oKey) {
+	old := db.s.newOrders[k]
+	db.record(func() {
+		db.s.newOrders[k] = old
+	})
+	delete(db.s.newOrders, k)
+}
+
+func (db *Memory) putOrderLines(k oKey, ol []models.OrderLine) {
+	old, ok := db.s.orderLines[k]
+	db.record(func() {
+		if ok {
+			db.s.orderLines[k] = old
+		} else {
+			delete(db.s.orderLines, k)
+		}
+	})
+	db.s.orderLines[k] = ol
+}
+
+func (db *Memory) putItem(i models.Item) {
+	k := i.I_ID
+	old, ok := db.s.items[k]
+	db.record(func() {
+		if ok {
+			db.s.items[k] = old
+		} else {
+			delete(db.s.items, k)
+		}
+	})
+	db.s.items[k] = i
+}
+
+func (db *Memory) putStock(s models.Stock) {
+	k := sKey{s.S_W_ID, s.S_I_ID}
+	old, ok := db.s.stock[k]
+	db.record(func() {
+		if ok {
+			db.s.stock[k] = old
+		} else {
+			delete(db.s.stock, k)
+		}
+	})
+	db.s.stock[k] = s
+}
+
+func (db *Memory) appendHistory(h models.History) {
+	n := len(db.s.history)
+	db.record(func() {
+		db.s.history = db.s.history[:n]
+	})
+	db.s.history = append(db.s.history, h)
+}
+
+// appendOrderLine copies the order lines, so that the undo log keeps the old slice intact
+func (db *Memory) appendOrderLine(ol models.OrderLine) {
+	k := oKey{ol.OL_W_ID, ol.OL_D_ID, ol.OL_O_ID}
+	lines := append([]models.OrderLine(nil), db.s.orderLines[k]...)
+	db.putOrderLines(k, append(lines, ol))
+}
+
+func (db *Memory) insert(tableName string, d interface{}) error {
+	switch v := d.(type) {
+	case models.Warehouse:
+		if _, ok := db.s.warehouses[v.W_ID]; ok {
+			return fmt.Errorf("duplicate key in %s", tableName)
+		}
+		db.putWarehouse(v)
+	case models.District:
+		if _, ok := db.s.districts[dKey{v.D_W_ID, v.D_ID}]; ok {
+			return fmt.Errorf("duplicate key in %s", tableName)
+		}
+		db.putDistrict(v)
+	case models.Customer:
+		if _, ok := db.s.customers[cKey{v.C_W_ID, v.C_D_ID, v.C_ID}]; ok {
+			return fmt.Errorf("duplicate key in %s", tableName)
+		}
+		db.putCustomer(v)
+	case models.History:
+		db.appendHistory(v)
+	case models.Order:
+		if _, ok := db.s.orders[oKey{v.O_W_ID, v.O_D_ID, v.O_ID}]; ok {
+			return fmt.Errorf("duplicate key in %s", tableName)
+		}
+		db.putOrder(v)
+		for _, ol := range v.ORDER_LINE {
+			db.appendOrderLine(ol)
+		}
+	case models.NewOrder:
+		if _, ok := db.s.newOrders[oKey{v.NO_W_ID, v.NO_D_ID, v.NO_O_ID}]; ok {
+			return fmt.Errorf("duplicate key in %s", tableName)
+		}
+		db.putNewOrder(v)
+	case models.OrderLine:
+		db.appendOrderLine(v)
+	case models.Item:
+		if _, ok := db.s.items[v.I_ID]; ok {
+			return fmt.Errorf("duplicate key in %s", tableName)
+		}
+		db.putItem(v)
+	case models.Stock:
+		if _, ok := db.s.stock[sKey{v.S_W_ID, v.S_I_ID}]; ok {
+			return fmt.Errorf("duplicate key in %s", tableName)
+		}
+		db.putStock(v)
+	default:
+		return fmt.Errorf("unsupported type %T for %s", d, tableName)
+	}
+
+	return nil
+}
+
+func (db *Memory) InsertOne(ctx context.Context, tableName string, d interface{}) error {
+	defer db.lock()()
+
+	return db.insert(tableName, d)
+}
+
+func (db *Memory) InsertBatch(ctx context.Context, tableName string, d []interface{}) error {
+	defer db.lock()()
+
+	for _, item := range d {
+		err := db.insert(tableName, item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *Memory) IncrementDistrictOrderId(ctx context.Context, warehouseId int, districtId int) error {
+	defer db.lock()()
+
+	d, ok := db.s.districts[dKey{warehouseId, districtId}]
+	if !ok {
+		return fmt.Errorf("unable to match district")
+	}
+
+	d.D_NEXT_O_ID++
+	db.putDistrict(d)
+
+	return nil
+}
+
+func (db *Memory) GetNewOrder(ctx context.Context, warehouseId int, districtId int) (*models.NewOrder, error) {
+	defer db.lock()()
+
+	var no *models.NewOrder
+	for k, v := range db.s.newOrders {
+		if k.w != warehouseId || k.d != districtId {
+			continue
+		}
+
+		if no == nil || v.NO_O_ID < no.NO_O_ID {
+			v := v
+			no = &v
+		}
+	}
+
+	if no == nil {
+		return nil, ErrNotFound
+	}
+
+	return no, nil
+}
+
+func (db *Memory) DeleteNewOrder(ctx context.Context, orderId int, warehouseId int, districtId int) error {
+	defer db.lock()()
+
+	k := oKey{warehouseId, districtId, orderId}
+	if _, ok := db.s.newOrders[k]; !ok {
+		return fmt.Errorf("unable to match new order for delete")
+	}
+
+	db.deleteNewOrder(k)
+
+	return nil
+}
+
+func (db *Memory) GetCustomer(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error) {
+	defer db.lock()()
+
+	c, ok := db.s.customers[cKey{warehouseId, districtId, customerId}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &c, nil
+}
+
+func (db *Memory) GetCustomerIdOrder(ctx context.Context, orderId int, warehouseId int, districtId int) (int, error) {
+	defer db.lock()()
+
+	o, ok := db.s.orders[oKey{warehouseId, districtId, orderId}]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return o.O_C_ID, nil
+}
+
+func (db *Memory) UpdateOrders(ctx context.Context, orderId int, warehouseId int, districtId int, oCarrierId int, deliveryDate time.Time) error {
+	defer db.lock()()
+
+	k := oKey{warehouseId, districtId, orderId}
+	o, ok := db.s.orders[k]
+	if !ok {
+		return fmt.Errorf("unable to match order")
+	}
+
+	o.O_CARRIER_ID = oCarrierId
+	db.putOrder(o)
+
+	lines := append([]models.OrderLine(nil), db.s.orderLines[k]...)
+	for i := range lines {
+		lines[i].OL_DELIVERY_D = deliveryDate
+	}
+	db.putOrderLines(k, lines)
+
+	return nil
+}
+
+func (db *Memory) SumOLAmount(ctx context.Context, orderId int, warehouseId int, districtId int) (float64, error) {
+	defer db.lock()()
+
+	lines, ok := db.s.orderLines[oKey{warehouseId, districtId, orderId}]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	var sum float64
+	for _, ol := range lines {
+		sum += ol.OL_AMOUNT
+	}
+
+	return sum, nil
+}
+
+func (db *Memory) UpdateCustomer(ctx context.Context, customerId int, warehouseId int, districtId int, sumOlTotal float64) error {
+	defer db.lock()()
+
+	c, ok := db.s.customers[cKey{warehouseId, districtId, customerId}]
+	if !ok {
+		return fmt.Errorf("unable to match customer")
+	}
+
+	c.C_BALANCE += sumOlTotal
+	db.putCustomer(c)
+
+	return nil
+}
+
+func (db *Memory) GetNextOrderId(ctx context.Context, warehouseId int, districtId int) (int, error) {
+	defer db.lock()()
+
+	d, ok := db.s.districts[dKey{warehouseId, districtId}]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return d.D_NEXT_O_ID, nil
+}
+
+func (db *Memory) GetStockCount(ctx context.Context, orderIdLt int, orderIdGt int, threshold int, warehouseId int, districtId int) (int64, error) {
+	defer db.lock()()
+
+	seen := make(map[int]bool)
+	for k, lines := range db.s.orderLines {
+		if k.w != warehouseId || k.d != districtId || k.o >= orderIdLt || k.o < orderIdGt {
+			continue
+		}
+
+		for _, ol := range lines {
+			s, ok := db.s.stock[sKey{warehouseId, ol.OL_I_ID}]
+			if ok && s.S_QUANTITY < threshold {
+				seen[ol.OL_I_ID] = true
+			}
+		}
+	}
+
+	return int64(len(seen)), nil
+}
+
+func (db *Memory) GetCustomerById(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error) {
+	return db.GetCustomer(ctx, customerId, warehouseId, districtId)
+}
+
+func (db *Memory) GetCustomerByName(ctx context.Context, name string, warehouseId int, districtId int) (*models.Customer, error) {
+	defer db.lock()()
+
+	var customers []models.Customer
+	for k, c := range db.s.customers {
+		if k.w == warehouseId && k.d == districtId && c.C_LAST == name {
+			customers = append(customers, c)
+		}
+	}
+
+	if len(customers) < 1 {
+		return nil, fmt.Errorf("no customers found with given name: %s: %w", name, ErrNotFound)
+	}
+
+	sort.Slice(customers, func(i, j int) bool {
+		if customers[i].C_FIRST == customers[j].C_FIRST {
+			return customers[i].C_ID < customers[j].C_ID
+		}
+		return customers[i].C_FIRST < customers[j].C_FIRST
+	})
+
+	return &customers[(len(customers)-1)/2], nil
+}
+
+func (db *Memory) GetLastOrder(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Order, error) {
+	defer db.lock()()
+
+	var order *models.Order
+	for k, o := range db.s.orders {
+		if k.w != warehouseId || k.d != districtId || o.O_C_ID != customerId {
+			continue
+		}
+
+		if order == nil || o.O_ID > order.O_ID {
+			o := o
+			order = &o
+		}
+	}
+
+	if order == nil {
+		return nil, ErrNotFound
+	}
+
+	return order, nil
+}
+
+func (db *Memory) GetOrderLines(ctx context.Context, orderId int, warehouseId int, districtId int) (*[]models.OrderLine, error) {
+	defer db.lock()()
+
+	ol := append([]models.OrderLine(nil), db.s.orderLines[oKey{warehouseId, districtId, orderId}]...)
+	sort.Slice(ol, func(i, j int) bool {
+		return ol[i].OL_NUMBER < ol[j].OL_NUMBER
+	})
+
+	return &ol, nil
+}
+
+func (db *Memory) GetWarehouse(ctx context.Context, warehouseId int) (*models.Warehouse, error) {
+	defer db.lock()()
+
+	w, ok := db.s.warehouses[warehouseId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &w, nil
+}
+
+func (db *Memory) UpdateWarehouseBalance(ctx context.Context, warehouseId int, amount float64) error {
+	defer db.lock()()
+
+	w, ok := db.s.warehouses[warehouseId]
+	if !ok {
+		return fmt.Errorf("unable to match warehouse")
+	}
+
+	w.W_YTD += amount
+	db.putWarehouse(w)
+
+	return nil
+}
+
+func (db *Memory) GetDistrict(ctx context.Context, warehouseId int, districtId int) (*models.District, error) {
+	defer db.lock()()
+
+	d, ok := db.s.districts[dKey{warehouseId, districtId}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &d, nil
+}
+
+func (db *Memory) UpdateDistrictBalance(ctx context.Context, warehouseId int, districtId int, amount float64) error {
+	defer db.lock()()
+
+	d, ok := db.s.districts[dKey{warehouseId, districtId}]
+	if !ok {
+		return fmt.Errorf("unable to match district")
+	}
+
+	d.D_YTD += amount
+	db.putDistrict(d)
+
+	return nil
+}
+
+// InsertHistory mirrors the SQL drivers, which do not know the customer and store H_C_ID = 1
+func (db *Memory) InsertHistory(ctx context.Context, warehouseId int, districtId int, date time.Time, amount float64, data string) error {
+	defer db.lock()()
+
+	db.appendHistory(models.History{
+		H_C_ID:   1,
+		H_C_D_ID: districtId,
+		H_C_W_ID: warehouseId,
+		H_D_ID:   districtId,
+		H_W_ID:   warehouseId,
+		H_DATE:   date,
+		H_AMOUNT: amount,
+		H_DATA:   data,
+	})
+
+	return nil
+}
+
+func (db *Memory) UpdateCredit(ctx context.Context, customerId int, warehouseId int, districtId int, balance float64, data string) error {
+	defer db.lock()()
+
+	c, ok := db.s.customers[cKey{warehouseId, districtId, customerId}]
+	if !ok {
+		return fmt.Errorf("no customers matched")
+	}
+
+	c.C_BALANCE -= balance
+	c.C_YTD_PAYMENT += balance
+	c.C_PAYMENT_CNT++
+	if len(data) > 0 {
+		c.C_DATA = data
+	}
+	db.putCustomer(c)
+
+	return nil
+}
+
+func (db *Memory) CreateOrder(
+	ctx context.Context,
+	orderId int,
+	customerId int,
+	warehouseId int,
+	districtId int,
+	oCarrierId int,
+	oOlCnt int,
+	allLocal int,
+	orderEntryDate time.Time,
+	orderLine []models.OrderLine,
+) error {
+	defer db.lock()()
+
+	k := oKey{warehouseId, districtId, orderId}
+	if _, ok := db.s.orders[k]; ok {
+		return fmt.Errorf("duplicate key in ORDERS")
+	}
+
+	if _, ok := db.s.newOrders[k]; ok {
+		return fmt.Errorf("duplicate key in NEW_ORDER")
+	}
+
+	db.putOrder(models.Order{
+		O_ID:         orderId,
+		O_C_ID:       customerId,
+		O_D_ID:       districtId,
+		O_W_ID:       warehouseId,
+		O_ENTRY_D:    orderEntryDate,
+		O_CARRIER_ID: oCarrierId,
+		O_OL_CNT:     oOlCnt,
+		O_ALL_LOCAL:  allLocal,
+	})
+
+	db.putNewOrder(models.NewOrder{
+		NO_O_ID: orderId,
+		NO_D_ID: districtId,
+		NO_W_ID: warehouseId,
+	})
+
+	// like the SQL drivers, OL_DELIVERY_D stays unset until the delivery
+	var lines []models.OrderLine
+	for _, o := range orderLine {
+		lines = append(lines, models.OrderLine{
+			OL_O_ID:        o.OL_O_ID,
+			OL_D_ID:        districtId,
+			OL_W_ID:        warehouseId,
+			OL_NUMBER:      o.OL_NUMBER,
+			OL_I_ID:        o.OL_I_ID,
+			OL_SUPPLY_W_ID: o.OL_SUPPLY_W_ID,
+			OL_QUANTITY:    o.OL_QUANTITY,
+			OL_AMOUNT:      o.OL_AMOUNT,
+			OL_DIST_INFO:   o.OL_DIST_INFO,
+		})
+	}
+	db.putOrderLines(k, lines)
+
+	return nil
+}
+
+// GetItems returns every existing item once, like SELECT ... WHERE I_ID IN (...) does
+func (db *Memory) GetItems(ctx context.Context, itemIds []int) (*[]models.Item, error) {
+	defer db.lock()()
+
+	seen := make(map[int]bool)
+	var items []models.Item
+	for _, id := range itemIds {
+		item, ok := db.s.items[id]
+		if !ok || seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		items = append(items, item)
+	}
+
+	return &items, nil
+}
+
+func (db *Memory) UpdateStock(ctx context.Context, stockId int, warehouseId int, quantity int, ytd int, ordercnt int, remotecnt int) error {
+	defer db.lock()()
+
+	s, ok := db.s.stock[sKey{warehouseId, stockId}]
+	if !ok {
+		return fmt.Errorf("unable to match stock")
+	}
+
+	s.S_QUANTITY = quantity
+	s.S_YTD = ytd
+	s.S_ORDER_CNT = ordercnt
+	s.S_REMOTE_CNT = remotecnt
+	db.putStock(s)
+
+	return nil
+}
+
+func (db *Memory) GetStockInfo(ctx context.Context, districtId int, iIds []int, iWids []int, allLocal int) (*[]models.Stock, error) {
+	defer db.lock()()
+
+	seen := make(map[sKey]bool)
+	var stocks []models.Stock
+	for i, id := range iIds {
+		k := sKey{iWids[i], id}
+		if allLocal == 1 {
+			k.w = iWids[0]
+		}
+
+		s, ok := db.s.stock[k]
+		if !ok || seen[k] {
+			continue
+		}
+
+		seen[k] = true
+		stocks = append(stocks, s)
+	}
+
+	return &stocks, nil
+}
+
+// Snapshot is a copy of all tables, with rows sorted by their primary key.
+type Snapshot struct {
+	Warehouses []models.Warehouse
+	Districts  []models.District
+	Customers  []models.Customer
+	History    []models.History
+	Orders     []models.Order
+	NewOrders  []models.NewOrder
+	OrderLines []models.OrderLine
+	Items      []models.Item
+	Stock      []models.Stock
+}
+
+// Snapshot returns the committed state of the database, it can be compared against the state of
+// another driver after a single-threaded deterministic run.
+func (db *Memory) Snapshot() *Snapshot {
+	defer db.lock()()
+
+	var s Snapshot
+
+	for _, w := range db.s.warehouses {
+		s.Warehouses = append(s.Warehouses, w)
+	}
+	sort.Slice(s.Warehouses, func(i, j int) bool {
+		return s.Warehouses[i].W_ID < s.Warehouses[j].W_ID
+	})
+
+	for _, d := range db.s.districts {
+		s.Districts = append(s.Districts, d)
+	}
+	sort.Slice(s.Districts, func(i, j int) bool {
+		a, b := s.Districts[i], s.Districts[j]
+		return less(a.D_W_ID, b.D_W_ID, a.D_ID, b.D_ID)
+	})
+
+	for _, c := range db.s.customers {
+		s.Customers = append(s.Customers, c)
+	}
+	sort.Slice(s.Customers, func(i, j int) bool {
+		a, b := s.Customers[i], s.Customers[j]
+		return less(a.C_W_ID, b.C_W_ID, a.C_D_ID, b.C_D_ID, a.C_ID, b.C_ID)
+	})
+
+	s.History = append(s.History, db.s.history...)
+
+	for _, o := range db.s.orders {
+		s.Orders = append(s.Orders, o)
+	}
+	sort.Slice(s.Orders, func(i, j int) bool {
+		a, b := s.Orders[i], s.Orders[j]
+		return less(a.O_W_ID, b.O_W_ID, a.O_D_ID, b.O_D_ID, a.O_ID, b.O_ID)
+	})
+
+	for _, no := range db.s.newOrders {
+		s.NewOrders = append(s.NewOrders, no)
+	}
+	sort.Slice(s.NewOrders, func(i, j int) bool {
+		a, b := s.NewOrders[i], s.NewOrders[j]
+		return less(a.NO_W_ID, b.NO_W_ID, a.NO_D_ID, b.NO_D_ID, a.NO_O_ID, b.NO_O_ID)
+	})
+
+	for _, lines := range db.s.orderLines {
+		s.OrderLines = append(s.OrderLines, lines...)
+	}
+	sort.Slice(s.OrderLines, func(i, j int) bool {
+		a, b := s.OrderLines[i], s.OrderLines[j]
+		return less(a.OL_W_ID, b.OL_W_ID, a.OL_D_ID, b.OL_D_ID, a.OL_O_ID, b.OL_O_ID, a.OL_NUMBER, b.OL_NUMBER)
+	})
+
+	for _, i := range db.s.items {
+		s.Items = append(s.Items, i)
+	}
+	sort.Slice(s.Items, func(i, j int) bool {
+		return s.Items[i].I_ID < s.Items[j].I_ID
+	})
+
+	for _, st := range db.s.stock {
+		s.Stock = append(s.Stock, st)
+	}
+	sort.Slice(s.Stock, func(i, j int) bool {
+		a, b := s.Stock[i], s.Stock[j]
+		return less(a.S_W_ID, b.S_W_ID, a.S_I_ID, b.S_I_ID)
+	})
+
+	return &s
+}
+
+// less compares keys given as pairs of (a, b) values, the first pair being the most significant
+func less(pairs ...int) bool {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i] != pairs[i+1] {
+			return pairs[i] < pairs[i+1]
+		}
+	}
+
+	return false
+}
+
+// Close leaves the data to the other connections of the database
+func (db *Memory) Close(ctx context.Context) error {
+	return nil
+}
+
+func (db *Memory) Classify(err error) databases.ErrorClass {
+	switch {
+	case err == nil:
+		return databases.ClassNone
+	case errors.Is(err, ErrNotFound):
+		return databases.ClassNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return databases.ClassTimeout
+	case errors.Is(err, context.Canceled):
+		return databases.ClassCanceled
+	}
+
+	return databases.ClassOther
+}
+
+func (db *Memory) CountRows(ctx context.Context, table string, warehouseId int) (int64, error) {
+	defer db.lock()()
+
+	if warehouseId > 0 && table == "ITEM" {
+		return 0, fmt.Errorf("table %s is not split by warehouse", table)
+	}
+
+	in := func(w int) bool {
+		return warehouseId == 0 || w == warehouseId
+	}
+
+	var n int64
+	switch table {
+	case "WAREHOUSE":
+		for k := range db.s.warehouses {
+			if in(k) {
+				n++
+			}
+		}
+	case "DISTRICT":
+		for k := range db.s.districts {
+			if in(k.w) {
+				n++
+			}
+		}
+	case "CUSTOMER":
+		for k := range db.s.customers {
+			if in(k.w) {
+				n++
+			}
+		}
+	case "HISTORY":
+		for _, h := range db.s.history {
+			if in(h.H_W_ID) {
+				n++
+			}
+		}
+	case "ORDERS":
+		for k := range db.s.orders {
+			if in(k.w) {
+				n++
+			}
+		}
+	case "NEW_ORDER":
+		for k := range db.s.newOrders {
+			if in(k.w) {
+				n++
+			}
+		}
+	case "ORDER_LINE":
+		for k, lines := range db.s.orderLines {
+			if in(k.w) {
+				n += int64(len(lines))
+			}
+		}
+	case "ITEM":
+		n = int64(len(db.s.items))
+	case "STOCK":
+		for k := range db.s.stock {
+			if in(k.w) {
+				n++
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unknown table %s", table)
+	}
+
+	return n, nil
+}
+
+func (db *Memory) SumOrderLineCounts(ctx context.Context, warehouseId int) (int64, error) {
+	defer db.lock()()
+
+	var n int64
+	for k, o := range db.s.orders {
+		if k.w == warehouseId {
+			n += int64(o.O_OL_CNT)
+		}
+	}
+
+	return n, nil
+}
+
+// SaveMetadata is not undone by RollbackTrx, it is only called outside of
+// transactions
+func (db *Memory) SaveMetadata(ctx context.Context, metadata map[string]string) error {
+	defer db.lock()()
+
+	for key, value := range metadata {
+		db.s.metadata[key] = value
+	}
+
+	return nil
+}
+
+func (db *Memory) LoadMetadata(ctx context.Context) (map[string]string, error) {
+	defer db.lock()()
+
+	metadata := make(map[string]string, len(db.s.metadata))
+	for key, value := range db.s.metadata {
+		metadata[key] = value
+	}
+
+	return metadata, nil
+}
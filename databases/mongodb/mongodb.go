@@ -2,13 +2,19 @@ package mongodb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+	"github.com/Percona-Lab/go-tpcc/databases"
 	"github.com/Percona-Lab/go-tpcc/tpcc/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
 	"go.mongodb.org/mongo-driver/x/bsonx"
 )
 
@@ -17,12 +23,73 @@ type MongoDB struct {
 	C *mongo.Database
 	Aggregate bool
 	findAndModify bool
+	indexProfile string
+	storage databases.Storage
 	transactions bool
-	ctx mongo.SessionContext
+	sess mongo.Session
 }
 
-func NewMongoDb(uri string, dbname string, transactions bool, findandmodify bool) (*MongoDB, error){
-	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+func init() {
+	databases.Register("mongodb", func(options databases.Options) (databases.Database, error) {
+		if options.Partitions.Enabled() {
+			return nil, fmt.Errorf("the mongodb driver does not support partitioning")
+		}
+
+		rp, err := readPreference(options.ReadPreference, options.MaxStaleness)
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := NewMongoDb(options.URI, options.DBName, options.Transactions, options.FindAndModify, options.ApplicationName, rp)
+		if err != nil {
+			return nil, err
+		}
+		db.indexProfile = options.IndexProfile
+
+		db.storage, err = options.Storage.Resolve(storagePresets)
+		if err == nil {
+			err = db.storage.Check("config_string", "clustered")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return db, nil
+	})
+}
+
+// readPreference builds the read preference of the reads, nil for mode ""
+func readPreference(mode string, maxStaleness time.Duration) (*readpref.ReadPref, error) {
+	if mode == "" {
+		if maxStaleness > 0 {
+			return nil, fmt.Errorf("max staleness needs a read preference")
+		}
+		return nil, nil
+	}
+
+	m, err := readpref.ModeFromString(mode)
+	if err != nil {
+		return nil, fmt.Errorf("unknown read preference %q, use primary|primaryPreferred|secondary|secondaryPreferred|nearest", mode)
+	}
+
+	var opts []readpref.Option
+	if maxStaleness > 0 {
+		opts = append(opts, readpref.WithMaxStaleness(maxStaleness))
+	}
+
+	return readpref.New(m, opts...)
+}
+
+func NewMongoDb(uri string, dbname string, transactions bool, findandmodify bool, appName string, readPreference *readpref.ReadPref) (*MongoDB, error){
+	clientOptions := options.Client().ApplyURI(uri)
+	if appName != "" {
+		clientOptions.SetAppName(appName)
+	}
+	if readPreference != nil {
+		clientOptions.SetReadPreference(readPreference)
+	}
+
+	client, err := mongo.NewClient(clientOptions)
 
 	if err != nil {
 		return nil, err
@@ -54,200 +121,193 @@ func NewMongoDb(uri string, dbname string, transactions bool, findandmodify bool
 		Aggregate: false,
 		transactions: transactions,
 		findAndModify: findandmodify,
-		ctx: mongo.NewSessionContext(context.Background(), session),
+		sess: session,
 	}, nil
 }
 
-func (db *MongoDB) CreateSchema() error {
-	return nil
+// withSession binds the driver session to the call context, so operations
+// join the running transaction and are still interrupted by ctx
+func (db *MongoDB) withSession(ctx context.Context) mongo.SessionContext {
+	return mongo.NewSessionContext(ctx, db.sess)
 }
 
-func (db *MongoDB) StartTrx() error {
-	sess :=  mongo.SessionFromContext(db.ctx)
-	err := sess.StartTransaction()
-	if err != nil {
-		return err
+// storagePresets are the storage profiles of MongoDB, config_string is the
+// WiredTiger configString of the collections
+var storagePresets = map[string]databases.Storage{
+	databases.DefaultStorage: {},
+	"zlib":                   {All: databases.StorageOptions{"config_string": "block_compressor=zlib"}},
+	"zstd":                   {All: databases.StorageOptions{"config_string": "block_compressor=zstd"}},
+	// clustered by _id, needs MongoDB 5.3
+	"clustered": {All: databases.StorageOptions{"clustered": "true"}},
+}
+
+// CreateSchema creates the collections with storage options, the others are
+// created by the first insert
+func (db *MongoDB) CreateSchema(ctx context.Context) error {
+	for _, collection := range databases.Tables {
+		storage := db.storage.For(collection)
+		if len(storage) == 0 {
+			continue
+		}
+
+		command := bson.D{{"create", collection}}
+		if configString, ok := storage["config_string"]; ok {
+			command = append(command, bson.E{"storageEngine", bson.D{{"wiredTiger", bson.D{{"configString", configString}}}}})
+		}
+		if v, ok := storage["clustered"]; ok {
+			clustered, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid clustered %q for %s", v, collection)
+			}
+			if clustered {
+				command = append(command, bson.E{"clusteredIndex", bson.D{{"key", bson.D{{"_id", 1}}}, {"unique", true}}})
+			}
+		}
+
+		err := db.C.RunCommand(ctx, command).Err()
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (db *MongoDB) CommitTrx() error {
-	sess :=  mongo.SessionFromContext(db.ctx)
-	err := sess.CommitTransaction(db.ctx)
-	if err != nil {
-		return err
+func (db *MongoDB) DropSchema(ctx context.Context) error {
+	for _, collection := range databases.Tables {
+		err := db.C.Collection(collection).Drop(ctx)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (db *MongoDB) RollbackTrx() error {
-	sess :=  mongo.SessionFromContext(db.ctx)
-	err := sess.AbortTransaction(db.ctx)
-	if err != nil {
-		return err
+// TruncateSchema deletes the documents and keeps the collections with their indexes
+func (db *MongoDB) TruncateSchema(ctx context.Context) error {
+	for _, collection := range databases.Tables {
+		_, err := db.C.Collection(collection).DeleteMany(ctx, bson.D{})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (db *MongoDB) CreateIndexes() error {
-	ascending := bsonx.Int32(1)
-	descending := bsonx.Int32(-1)
-
-	_, err := db.C.Collection("ITEM").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
-		{
-			Keys: bsonx.Doc{
-				{"W_ID", ascending},
-				{"W_TAX", ascending},
-			},
-		},
-	})
-
+func (db *MongoDB) StartTrx(ctx context.Context) error {
+	sess := db.sess
+	err := sess.StartTransaction()
 	if err != nil {
 		return err
 	}
 
-	_, err = db.C.Collection("WAREHOUSE").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
-		{
-			Keys: bsonx.Doc{
-				{"I_W_ID", ascending},
-				{"I_ID", ascending},
-			},
-		},
-	})
+	return nil
+}
 
+func (db *MongoDB) CommitTrx(ctx context.Context) error {
+	sess := db.sess
+	err := sess.CommitTransaction(db.withSession(ctx))
 	if err != nil {
 		return err
 	}
 
-	_, err = db.C.Collection("DISTRICT").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
-		{
-			Keys: bsonx.Doc{
-				{"D_W_ID", ascending},
-				{"D_ID", ascending},
-				{"D_NEXT_O_ID", ascending},
-				{"D_TAX", ascending},
-			},
-		},
-	})
+	return nil
+}
 
+func (db *MongoDB) RollbackTrx(ctx context.Context) error {
+	sess := db.sess
+	err := sess.AbortTransaction(db.withSession(ctx))
 	if err != nil {
 		return err
 	}
 
-	_, err = db.C.Collection("CUSTOMER").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
-		{
-			Keys: bsonx.Doc{
-				{"C_W_ID", ascending},
-				{"C_D_ID", ascending},
-				{"C_ID", ascending},
-			},
-		},
-		{
-			Keys: bsonx.Doc {
-				{"C_W_ID", ascending},
-				{"C_D_ID", ascending},
-				{"C_LAST", ascending},
-			},
-		},
-	})
-
-	if err != nil {
-		return err
-	}
+	return nil
+}
 
-	_, err = db.C.Collection("STOCK").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
-		{
-			Keys: bsonx.Doc{
-				{"S_W_ID", ascending},
-				{"S_I_ID", ascending},
-				{"S_QUANTITY", ascending},
-			},
-		},
-		{
-			Keys: bsonx.Doc{
-				{"S_I_ID", ascending},
-			},
-		},
-	})
+// indexes returns the keys of the indexes of every collection for the index
+// profile. The minimal profile has the equivalents of the SQL primary keys,
+// MongoDB only has _id.
+func indexes(profile string) map[string][]bsonx.Doc {
+	ascending := bsonx.Int32(1)
+	descending := bsonx.Int32(-1)
 
-	if err != nil {
-		return err
+	keys := map[string][]bsonx.Doc{
+		"WAREHOUSE": {{{"W_ID", ascending}}},
+		"ITEM":      {{{"I_ID", ascending}}},
+		"DISTRICT":  {{{"D_W_ID", ascending}, {"D_ID", ascending}}},
+		"CUSTOMER":  {{{"C_W_ID", ascending}, {"C_D_ID", ascending}, {"C_ID", ascending}}},
+		"STOCK":     {{{"S_W_ID", ascending}, {"S_I_ID", ascending}}},
+		"ORDERS":    {{{"O_W_ID", ascending}, {"O_D_ID", ascending}, {"O_ID", ascending}}},
+		"NEW_ORDER": {{{"NO_W_ID", ascending}, {"NO_D_ID", ascending}, {"NO_O_ID", ascending}}},
+		// only used by the normalized schema, the order lines are embedded
+		// in the orders otherwise
+		"ORDER_LINE": {{{"OL_W_ID", ascending}, {"OL_D_ID", ascending}, {"OL_O_ID", ascending}, {"OL_NUMBER", ascending}}},
+	}
+
+	switch profile {
+	case databases.IndexMinimal:
+	case databases.IndexCovering:
+		keys["CUSTOMER"] = append(keys["CUSTOMER"], bsonx.Doc{
+			{"C_W_ID", ascending}, {"C_D_ID", ascending}, {"C_LAST", ascending}, {"C_FIRST", ascending},
+			{"C_ID", ascending}, {"C_MIDDLE", ascending}, {"C_BALANCE", ascending},
+		})
+		keys["ORDERS"] = append(keys["ORDERS"], bsonx.Doc{
+			{"O_W_ID", ascending}, {"O_D_ID", ascending}, {"O_C_ID", ascending}, {"O_ID", descending},
+			{"O_CARRIER_ID", ascending}, {"O_ENTRY_D", ascending},
+		})
+		keys["DISTRICT"][0] = append(keys["DISTRICT"][0], bsonx.Elem{"D_NEXT_O_ID", ascending})
+		keys["STOCK"][0] = append(keys["STOCK"][0], bsonx.Elem{"S_QUANTITY", ascending})
+	default:
+		keys["CUSTOMER"] = append(keys["CUSTOMER"], bsonx.Doc{
+			{"C_W_ID", ascending}, {"C_D_ID", ascending}, {"C_LAST", ascending}, {"C_FIRST", ascending},
+		})
+		keys["ORDERS"] = append(keys["ORDERS"], bsonx.Doc{
+			{"O_W_ID", ascending}, {"O_D_ID", ascending}, {"O_C_ID", ascending}, {"O_ID", descending},
+		})
 	}
 
-	_, err = db.C.Collection("ORDERS").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
-		{
-			Keys: bsonx.Doc{
-				{"O_W_ID", ascending},
-				{"O_D_ID", ascending},
-				{"O_ID", ascending},
-				{"O_C_ID", ascending},
-			},
-		},
-		{
-			Keys: bsonx.Doc{
-				{"O_C_ID", ascending},
-				{"O_D_ID", ascending},
-				{"O_W_ID", ascending},
-				{"O_ID", descending},
-				{"O_CARRIER_ID", ascending},
-				{"O_ENTRY_ID", ascending},
-			},
-		},
-	})
+	return keys
+}
 
-	if err != nil {
-		return err
+// Indexes has the keys of every index as Definition, the names are those
+// MongoDB gives them
+func (db *MongoDB) Indexes() []databases.Index {
+	keys := indexes(db.indexProfile)
+
+	var list []databases.Index
+	for _, collection := range databases.Tables {
+		for _, k := range keys[collection] {
+			var name []string
+			for _, e := range k {
+				name = append(name, fmt.Sprintf("%s_%d", e.Key, e.Value.Int32()))
+			}
+
+			list = append(list, databases.Index{
+				Table:      collection,
+				Name:       strings.Join(name, "_"),
+				Definition: k,
+			})
+		}
 	}
 
+	return list
+}
 
-	_, err = db.C.Collection("NEW_ORDER").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
-		{
-			Keys: bsonx.Doc{
-				{"NO_W_ID", ascending},
-				{"NO_D_ID", ascending},
-				{"NO_O_ID", ascending},
-			},
-		},
-	})
-
-	if err != nil {
-		return err
-	}
-
-	_, err = db.C.Collection("ORDER_LINE").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
-		{
-			Keys: bsonx.Doc{
-				{"OL_O_ID", ascending},
-				{"OL_D_ID", ascending},
-				{"OL_W_ID", ascending},
-				{"OL_NUMBER", ascending},
-			},
-		},
-		{
-			Keys: bsonx.Doc{
-				{"OL_O_ID", ascending},
-				{"OL_D_ID", ascending},
-				{"OL_W_ID", ascending},
-				{"OL_I_ID", descending},
-				{"OL_AMOUNT", ascending},
-
-			},
-		},
+// CreateIndex ignores online, index builds do not block writes since
+// MongoDB 4.2
+func (db *MongoDB) CreateIndex(ctx context.Context, index databases.Index, online bool) error {
+	_, err := db.C.Collection(index.Table).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: index.Definition.(bsonx.Doc),
 	})
 
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return err
 }
 
-func (db *MongoDB) InsertOne(tableName string, d interface{}) error {
+func (db *MongoDB) InsertOne(ctx context.Context, tableName string, d interface{}) error {
 	collection := db.C.Collection(tableName)
-	_, err := collection.InsertOne(db.ctx, d)
+	_, err := collection.InsertOne(db.withSession(ctx), d)
 	if err != nil {
 		return err
 	}
@@ -255,9 +315,9 @@ func (db *MongoDB) InsertOne(tableName string, d interface{}) error {
 	return nil
 }
 
-func (db *MongoDB) InsertBatch(tableName string, d []interface{}) error {
+func (db *MongoDB) InsertBatch(ctx context.Context, tableName string, d []interface{}) error {
 	collection := db.C.Collection(tableName)
-	_, err := collection.InsertMany(db.ctx, d)
+	_, err := collection.InsertMany(db.withSession(ctx), d)
 	if err != nil {
 		return err
 	}
@@ -266,7 +326,7 @@ func (db *MongoDB) InsertBatch(tableName string, d []interface{}) error {
 }
 
 // Get District using warehouseId and districtId and return pointer to models.District or error instead.
-func (db *MongoDB) IncrementDistrictOrderId(warehouseId int, districtId int) error {
+func (db *MongoDB) IncrementDistrictOrderId(ctx context.Context, warehouseId int, districtId int) error {
 	filter := bson.D{
 		{"D_ID", districtId},
 		{"D_W_ID", warehouseId},
@@ -278,7 +338,7 @@ func (db *MongoDB) IncrementDistrictOrderId(warehouseId int, districtId int) err
 		}},
 	}
 
-	u, err := db.C.Collection("DISTRICT").UpdateOne(db.ctx, filter, update, nil)
+	u, err := db.C.Collection("DISTRICT").UpdateOne(db.withSession(ctx), filter, update, nil)
 
 	if err != nil {
 		return err
@@ -293,7 +353,7 @@ func (db *MongoDB) IncrementDistrictOrderId(warehouseId int, districtId int) err
 
 
 // It also deletes new order, as MongoDB can do that findAndModify is set to 0
-func (db *MongoDB) GetNewOrder(warehouseId int, districtId int) (*models.NewOrder, error) {
+func (db *MongoDB) GetNewOrder(ctx context.Context, warehouseId int, districtId int) (*models.NewOrder, error) {
 	var NewOrder models.NewOrder
 	var err error
 
@@ -313,7 +373,7 @@ func (db *MongoDB) GetNewOrder(warehouseId int, districtId int) (*models.NewOrde
 
 	if db.findAndModify {
 		err = db.C.Collection("NEW_ORDER").FindOneAndDelete(
-			db.ctx,
+			db.withSession(ctx),
 			filter,
 			options.FindOneAndDelete().SetSort(newOrderSort).SetProjection(newOrderProjection),
 		).Decode(&NewOrder)
@@ -323,16 +383,16 @@ func (db *MongoDB) GetNewOrder(warehouseId int, districtId int) (*models.NewOrde
 		}
 	} else {
 		err = db.C.Collection("NEW_ORDER").FindOne(
-			db.ctx,
+			db.withSession(ctx),
 			filter,
-			options.FindOne().SetProjection(newOrderProjection).SetSort(newOrderSort),
+			findOneOptions(ctx, "").SetProjection(newOrderProjection).SetSort(newOrderSort),
 		).Decode(&NewOrder)
 	}
 
 	return &NewOrder, nil
 }
 
-func (db *MongoDB) DeleteNewOrder(orderId int, warehouseId int, districtId int) error {
+func (db *MongoDB) DeleteNewOrder(ctx context.Context, orderId int, warehouseId int, districtId int) error {
 	var err error
 
 	filter := bson.D{
@@ -345,7 +405,7 @@ func (db *MongoDB) DeleteNewOrder(orderId int, warehouseId int, districtId int)
 		return nil
 	}
 
-	r,err := db.C.Collection("NEW_ORDER").DeleteOne(db.ctx, filter, nil)
+	r,err := db.C.Collection("NEW_ORDER").DeleteOne(db.withSession(ctx), filter, nil)
 
 	if err != nil {
 		return err
@@ -358,16 +418,16 @@ func (db *MongoDB) DeleteNewOrder(orderId int, warehouseId int, districtId int)
 	return nil
 }
 
-func (db *MongoDB) GetCustomer(customerId int, warehouseId int, districtId int) (*models.Customer, error) {
+func (db *MongoDB) GetCustomer(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error) {
 	var err error
 
 	var c models.Customer
 
-	err = db.C.Collection("CUSTOMER").FindOne(db.ctx, bson.D{
+	err = db.C.Collection("CUSTOMER").FindOne(db.withSession(ctx), bson.D{
 		{"C_ID", customerId},
 		{"C_D_ID", districtId},
 		{"C_W_ID", warehouseId},
-	}).Decode(&c)
+	}, findOneOptions(ctx, "")).Decode(&c)
 
 	if err != nil {
 		return nil, err
@@ -377,7 +437,7 @@ func (db *MongoDB) GetCustomer(customerId int, warehouseId int, districtId int)
 }
 
 // GetCId
-func (db *MongoDB) GetCustomerIdOrder (orderId int, warehouseId int, districtId int) (int, error) {
+func (db *MongoDB) GetCustomerIdOrder(ctx context.Context, orderId int, warehouseId int, districtId int) (int, error) {
 	var err error
 
 	filter := bson.D{
@@ -388,9 +448,9 @@ func (db *MongoDB) GetCustomerIdOrder (orderId int, warehouseId int, districtId
 
 	var doc bson.M
 	err = db.C.Collection("ORDERS").FindOne(
-		db.ctx,
+		db.withSession(ctx),
 		filter,
-		options.FindOne().SetProjection(bson.D{
+		findOneOptions(ctx, "").SetProjection(bson.D{
 			{"_id", 0},
 			{"O_C_ID", 1},
 		})).Decode(&doc)
@@ -402,7 +462,7 @@ func (db *MongoDB) GetCustomerIdOrder (orderId int, warehouseId int, districtId
 	return int(doc["O_C_ID"].(int32)), nil
 }
 
-func (db *MongoDB) UpdateOrders(orderId int, warehouseId int, districtId int, oCarrierId int, deliveryDate time.Time) error {
+func (db *MongoDB) UpdateOrders(ctx context.Context, orderId int, warehouseId int, districtId int, oCarrierId int, deliveryDate time.Time) error {
 	var err error
 
 	filter := bson.D{
@@ -411,7 +471,7 @@ func (db *MongoDB) UpdateOrders(orderId int, warehouseId int, districtId int, oC
 		{"O_W_ID", warehouseId},
 	}
 
-	r,err := db.C.Collection("ORDERS").UpdateOne(db.ctx,
+	r,err := db.C.Collection("ORDERS").UpdateOne(db.withSession(ctx),
 		filter,
 		bson.D{
 			{"$set", bson.D{
@@ -432,7 +492,7 @@ func (db *MongoDB) UpdateOrders(orderId int, warehouseId int, districtId int, oC
 }
 
 
-func (db *MongoDB) SumOLAmount(orderId int, warehouseId int, districtId int) (float64, error) {
+func (db *MongoDB) SumOLAmount(ctx context.Context, orderId int, warehouseId int, districtId int) (float64, error) {
 	var err error
 
 	match := bson.D{
@@ -456,13 +516,13 @@ func (db *MongoDB) SumOLAmount(orderId int, warehouseId int, districtId int) (fl
 		}},
 	}
 
-	cursor, err := db.C.Collection("ORDERS").Aggregate(db.ctx,mongo.Pipeline{match, unwind, group})
-	defer cursor.Close(db.ctx)
+	cursor, err := db.C.Collection("ORDERS").Aggregate(db.withSession(ctx),mongo.Pipeline{match, unwind, group}, aggregateOptions(ctx, ""))
 	if err != nil {
 		return 0, err
 	}
+	defer cursor.Close(db.withSession(ctx))
 
-	cursor.Next(db.ctx)
+	cursor.Next(db.withSession(ctx))
 
 	var agg bson.M
 	err = cursor.Decode(&agg)
@@ -474,10 +534,10 @@ func (db *MongoDB) SumOLAmount(orderId int, warehouseId int, districtId int) (fl
 
 }
 
-func (db *MongoDB) UpdateCustomer(customerId int, warehouseId int, districtId int, sumOlTotal float64) error {
+func (db *MongoDB) UpdateCustomer(ctx context.Context, customerId int, warehouseId int, districtId int, sumOlTotal float64) error {
 	var err error
 
-	r, err := db.C.Collection("CUSTOMER").UpdateOne(db.ctx,
+	r, err := db.C.Collection("CUSTOMER").UpdateOne(db.withSession(ctx),
 		bson.D{
 			{"C_ID", customerId},
 			{"C_D_ID", districtId},
@@ -503,7 +563,7 @@ func (db *MongoDB) UpdateCustomer(customerId int, warehouseId int, districtId in
 }
 
 
-func (db *MongoDB) GetNextOrderId(warehouseId int, districtId int) (int, error) {
+func (db *MongoDB) GetNextOrderId(ctx context.Context, warehouseId int, districtId int) (int, error) {
 
 
 	var oid bson.M
@@ -513,9 +573,9 @@ func (db *MongoDB) GetNextOrderId(warehouseId int, districtId int) (int, error)
 	}
 
 	err := db.C.Collection("DISTRICT").FindOne(
-		db.ctx,
+		db.withSession(ctx),
 		query,
-		options.FindOne().SetProjection(bson.D{
+		findOneOptions(ctx, "").SetProjection(bson.D{
 			{"_id", 0},
 			{"D_NEXT_O_ID", 1},
 		}).SetComment("STOCK_LEVEL")).Decode(&oid)
@@ -527,9 +587,9 @@ func (db *MongoDB) GetNextOrderId(warehouseId int, districtId int) (int, error)
 	return int(oid["D_NEXT_O_ID"].(int32)), nil
 }
 
-func (db *MongoDB) GetStockCount(orderIdLt int, orderIdGt int, threshold int, warehouseId int, districtId int) (int64, error) {
+func (db *MongoDB) GetStockCount(ctx context.Context, orderIdLt int, orderIdGt int, threshold int, warehouseId int, districtId int) (int64, error) {
 
-	cursor, err := db.C.Collection("ORDERS").Find(db.ctx,
+	cursor, err := db.C.Collection("ORDERS").Find(db.withSession(ctx),
 		bson.D{
 			{"O_W_ID", warehouseId},
 			{"O_D_ID", districtId},
@@ -537,18 +597,18 @@ func (db *MongoDB) GetStockCount(orderIdLt int, orderIdGt int, threshold int, wa
 				{"$lt", orderIdLt},
 				{"$gte", orderIdGt},
 			}},
-		}, options.Find().SetProjection(bson.D{
+		}, findOptions(ctx, "STOCK_LEVEL").SetProjection(bson.D{
 			{"ORDER_LINE.OL_I_ID", 1},
-		}).SetComment("STOCK_LEVEL"))
+		}))
 
 	if err != nil {
 		return 0, err
 	}
 
-	defer cursor.Close(db.ctx)
+	defer cursor.Close(db.withSession(ctx))
 	var orderIds []int32
 
-	for cursor.Next(db.ctx) {
+	for cursor.Next(db.withSession(ctx)) {
 		var order bson.M
 		if err = cursor.Decode(&order); err != nil {
 			return 0, err
@@ -559,7 +619,7 @@ func (db *MongoDB) GetStockCount(orderIdLt int, orderIdGt int, threshold int, wa
 		}
 	}
 
-	c, err := db.C.Collection("STOCK").CountDocuments(db.ctx, bson.D{
+	c, err := db.C.Collection("STOCK").CountDocuments(db.withSession(ctx), bson.D{
 		{"S_W_ID", warehouseId},
 		{"S_I_ID", bson.D{
 			{"$in", orderIds},
@@ -576,7 +636,7 @@ func (db *MongoDB) GetStockCount(orderIdLt int, orderIdGt int, threshold int, wa
 	return c, nil
 }
 
-func (db *MongoDB) GetCustomerById(customerId int, warehouseId int, districtId int) (*models.Customer, error) {
+func (db *MongoDB) GetCustomerById(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error) {
 
 	var err error
 	var customer models.Customer
@@ -590,11 +650,11 @@ func (db *MongoDB) GetCustomerById(customerId int, warehouseId int, districtId i
 		{"C_BALANCE", 1},
 	}
 
-	err = db.C.Collection("CUSTOMER").FindOne(db.ctx, bson.D{
+	err = db.C.Collection("CUSTOMER").FindOne(db.withSession(ctx), bson.D{
 		{"C_W_ID", warehouseId},
 		{"C_D_ID", districtId},
 		{"C_ID", customerId},
-	}, options.FindOne().SetComment("ORDER_STATUS").SetProjection(projection)).Decode(&customer)
+	}, findOneOptions(ctx, "ORDER_STATUS").SetProjection(projection)).Decode(&customer)
 
 	if err != nil {
 		return nil, err
@@ -603,7 +663,7 @@ func (db *MongoDB) GetCustomerById(customerId int, warehouseId int, districtId i
 	return &customer, nil
 }
 
-func (db *MongoDB) GetCustomerByName(name string, warehouseId int, districtId int) (*models.Customer, error) {
+func (db *MongoDB) GetCustomerByName(ctx context.Context, name string, warehouseId int, districtId int) (*models.Customer, error) {
 
 	var customer models.Customer
 
@@ -616,20 +676,20 @@ func (db *MongoDB) GetCustomerByName(name string, warehouseId int, districtId in
 		{"C_BALANCE", 1},
 	}
 
-	cursor, err := db.C.Collection("CUSTOMER").Find(db.ctx, bson.D{
+	cursor, err := db.C.Collection("CUSTOMER").Find(db.withSession(ctx), bson.D{
 		{"C_W_ID", warehouseId},
 		{"C_D_ID", districtId},
 		{"C_LAST", name},
-	}, options.Find().SetProjection(projection))
-
-	defer cursor.Close(db.ctx)
+	}, findOptions(ctx, "").SetProjection(projection))
 
 	if err != nil {
 		return nil, err
 	}
 
+	defer cursor.Close(db.withSession(ctx))
+
 	var customers []models.Customer
-	err = cursor.All(db.ctx, &customers)
+	err = cursor.All(db.withSession(ctx), &customers)
 
 	if err != nil {
 		return nil, err
@@ -645,7 +705,7 @@ func (db *MongoDB) GetCustomerByName(name string, warehouseId int, districtId in
 	return &customer, nil
 }
 
-func (db *MongoDB) GetLastOrder(customerId int, warehouseId int, districtId int) (*models.Order, error) {
+func (db *MongoDB) GetLastOrder(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Order, error) {
 	var err error
 	var order models.Order
 
@@ -657,12 +717,12 @@ func (db *MongoDB) GetLastOrder(customerId int, warehouseId int, districtId int)
 
 	sort := bson.D{{"O_ID", 1}}
 
-	err = db.C.Collection("ORDERS").FindOne(db.ctx, bson.D{
+	err = db.C.Collection("ORDERS").FindOne(db.withSession(ctx), bson.D{
 		{"O_W_ID", warehouseId},
 		{"O_D_ID", districtId},
 		{"O_C_ID", customerId},
 	},
-		options.FindOne().SetProjection(projection).SetSort(sort)).Decode(&order)
+		findOneOptions(ctx, "").SetProjection(projection).SetSort(sort)).Decode(&order)
 
 	if err != nil {
 		return nil, err
@@ -671,7 +731,7 @@ func (db *MongoDB) GetLastOrder(customerId int, warehouseId int, districtId int)
 	return &order, nil
 }
 
-func (db *MongoDB) GetOrderLines(orderId int, warehouseId int, districtId int) (*[]models.OrderLine, error) {
+func (db *MongoDB) GetOrderLines(ctx context.Context, orderId int, warehouseId int, districtId int) (*[]models.OrderLine, error) {
 	var err error
 	var order models.Order
 
@@ -679,12 +739,12 @@ func (db *MongoDB) GetOrderLines(orderId int, warehouseId int, districtId int) (
 		{"ORDER_LINE", 1},
 	}
 
-	err = db.C.Collection("ORDERS").FindOne(db.ctx, bson.D{
+	err = db.C.Collection("ORDERS").FindOne(db.withSession(ctx), bson.D{
 		{"O_W_ID", warehouseId},
 		{"O_D_ID", districtId},
 		{"O_ID", orderId},
 	},
-		options.FindOne().SetProjection(projection)).Decode(&order)
+		findOneOptions(ctx, "").SetProjection(projection)).Decode(&order)
 
 	if err != nil {
 		return nil, err
@@ -693,7 +753,7 @@ func (db *MongoDB) GetOrderLines(orderId int, warehouseId int, districtId int) (
 	return &order.ORDER_LINE, nil
 }
 
-func (db *MongoDB) GetWarehouse(warehouseId int) (*models.Warehouse, error) {
+func (db *MongoDB) GetWarehouse(ctx context.Context, warehouseId int) (*models.Warehouse, error) {
 
 	var err error
 
@@ -708,10 +768,10 @@ func (db *MongoDB) GetWarehouse(warehouseId int) (*models.Warehouse, error) {
 
 	var warehouse models.Warehouse
 
-	err = db.C.Collection("WAREHOUSE").FindOne(db.ctx, bson.D{
+	err = db.C.Collection("WAREHOUSE").FindOne(db.withSession(ctx), bson.D{
 		{"W_ID", warehouseId},
 	},
-		options.FindOne().SetProjection(warehouseProjection),
+		findOneOptions(ctx, "").SetProjection(warehouseProjection),
 	).Decode(&warehouse)
 
 	if err != nil {
@@ -721,9 +781,9 @@ func (db *MongoDB) GetWarehouse(warehouseId int) (*models.Warehouse, error) {
 	return &warehouse, nil
 }
 
-func (db *MongoDB) UpdateWarehouseBalance(warehouseId int, amount float64) error {
+func (db *MongoDB) UpdateWarehouseBalance(ctx context.Context, warehouseId int, amount float64) error {
 
-	r, err := db.C.Collection("WAREHOUSE").UpdateOne(db.ctx, bson.D{
+	r, err := db.C.Collection("WAREHOUSE").UpdateOne(db.withSession(ctx), bson.D{
 		{"W_ID", warehouseId},
 	},
 		bson.D{
@@ -746,15 +806,15 @@ func (db *MongoDB) UpdateWarehouseBalance(warehouseId int, amount float64) error
 
 
 
-func (db *MongoDB) GetDistrict(warehouseId int, districtId int) (*models.District, error) {
+func (db *MongoDB) GetDistrict(ctx context.Context, warehouseId int, districtId int) (*models.District, error) {
 	var err error
 
 	var district models.District
 
-	err = db.C.Collection("DISTRICT").FindOne(db.ctx, bson.D{
+	err = db.C.Collection("DISTRICT").FindOne(db.withSession(ctx), bson.D{
 		{"D_ID", districtId},
 		{"D_W_ID", warehouseId},
-	}).Decode(&district)
+	}, findOneOptions(ctx, "")).Decode(&district)
 
 	if err != nil {
 		return nil, err
@@ -763,7 +823,7 @@ func (db *MongoDB) GetDistrict(warehouseId int, districtId int) (*models.Distric
 	return &district, nil
 }
 
-func (db *MongoDB) UpdateDistrictBalance(warehouseId int, districtId int, amount float64) error {
+func (db *MongoDB) UpdateDistrictBalance(ctx context.Context, warehouseId int, districtId int, amount float64) error {
 	filter := bson.D{
 		{"D_ID", districtId},
 		{"D_W_ID", warehouseId},
@@ -775,7 +835,7 @@ func (db *MongoDB) UpdateDistrictBalance(warehouseId int, districtId int, amount
 		}},
 	}
 
-	r,err := db.C.Collection("DISTRICT").UpdateOne(db.ctx, filter, update, nil)
+	r,err := db.C.Collection("DISTRICT").UpdateOne(db.withSession(ctx), filter, update, nil)
 
 	if r.MatchedCount == 0 {
 		return fmt.Errorf("No district found")
@@ -789,6 +849,7 @@ func (db *MongoDB) UpdateDistrictBalance(warehouseId int, districtId int, amount
 }
 
 func (db *MongoDB) InsertHistory(
+	ctx context.Context,
 	warehouseId int,
 	districtId int,
 	date time.Time,
@@ -796,7 +857,7 @@ func (db *MongoDB) InsertHistory(
 	data string,
 ) error {
 
-	_, err := db.C.Collection("HISTORY").InsertOne(db.ctx, bson.D{
+	_, err := db.C.Collection("HISTORY").InsertOne(db.withSession(ctx), bson.D{
 		{"H_D_ID", districtId},
 		{"H_W_ID", warehouseId},
 		{"H_C_W_ID", warehouseId},
@@ -809,7 +870,7 @@ func (db *MongoDB) InsertHistory(
 	return err
 }
 
-func (db *MongoDB) UpdateCredit(customerId int, warehouseId int, districtId int, balance float64, data string) error {
+func (db *MongoDB) UpdateCredit(ctx context.Context, customerId int, warehouseId int, districtId int, balance float64, data string) error {
 	//updateBCCustomer
 	var err error
 	update :=  bson.D{
@@ -826,7 +887,7 @@ func (db *MongoDB) UpdateCredit(customerId int, warehouseId int, districtId int,
 		}})
 	}
 
-	_, err = db.C.Collection("CUSTOMER").UpdateOne(db.ctx,
+	_, err = db.C.Collection("CUSTOMER").UpdateOne(db.withSession(ctx),
 		bson.D{
 			{"C_ID", customerId},
 			{"C_W_ID", warehouseId},
@@ -842,6 +903,7 @@ func (db *MongoDB) UpdateCredit(customerId int, warehouseId int, districtId int,
 }
 
 func (db *MongoDB) CreateOrder(
+	ctx context.Context,
 	orderId int,
 	customerId int,
 	warehouseId int,
@@ -865,7 +927,7 @@ func (db *MongoDB) CreateOrder(
 		ORDER_LINE:   orderLine,
 	}
 
-	_, err := db.C.Collection("NEW_ORDER").InsertOne(db.ctx,
+	_, err := db.C.Collection("NEW_ORDER").InsertOne(db.withSession(ctx),
 		bson.D{
 			{"NO_O_ID", orderId},
 			{"NO_D_ID", districtId},
@@ -876,7 +938,7 @@ func (db *MongoDB) CreateOrder(
 		return err
 	}
 
-	_, err = db.C.Collection("ORDERS").InsertOne(db.ctx, order)
+	_, err = db.C.Collection("ORDERS").InsertOne(db.withSession(ctx), order)
 
 	if err != nil {
 		return nil
@@ -886,13 +948,13 @@ func (db *MongoDB) CreateOrder(
 }
 
 //todo: sharding
-func (db *MongoDB) GetItems(itemIds []int) (*[]models.Item, error) {
+func (db *MongoDB) GetItems(ctx context.Context, itemIds []int) (*[]models.Item, error) {
 
-	cursor, err := db.C.Collection("ITEM").Find(db.ctx, bson.D{
+	cursor, err := db.C.Collection("ITEM").Find(db.withSession(ctx), bson.D{
 		{"I_ID", bson.D{
 			{"$in", itemIds},
 		}}},
-		options.Find().SetProjection(bson.D{
+		findOptions(ctx, "").SetProjection(bson.D{
 			{"_id", 0},
 			{"I_ID", 1},
 			{"I_PRICE", 1},
@@ -906,7 +968,7 @@ func (db *MongoDB) GetItems(itemIds []int) (*[]models.Item, error) {
 	}
 
 	var items []models.Item
-	err = cursor.All(db.ctx, &items)
+	err = cursor.All(db.withSession(ctx), &items)
 
 	if err != nil {
 		return nil, err
@@ -915,7 +977,7 @@ func (db *MongoDB) GetItems(itemIds []int) (*[]models.Item, error) {
 	return &items, nil
 }
 
-func (db *MongoDB) GetStockInfo(districtId int, iIds []int, iWids []int, allLocal int) (*[]models.Stock, error) {
+func (db *MongoDB) GetStockInfo(ctx context.Context, districtId int, iIds []int, iWids []int, allLocal int) (*[]models.Stock, error) {
 	var err error
 	distCol := fmt.Sprintf("S_DIST_%02d", districtId)
 	stockProjection := bson.D{
@@ -932,12 +994,12 @@ func (db *MongoDB) GetStockInfo(districtId int, iIds []int, iWids []int, allLoca
 
 	var cursor *mongo.Cursor
 	if allLocal == 1 {
-		cursor, err = db.C.Collection("STOCK").Find(db.ctx, bson.D{
+		cursor, err = db.C.Collection("STOCK").Find(db.withSession(ctx), bson.D{
 			{"S_I_ID", bson.D{
 				{"$in", iIds},
 			}},
 			{"S_W_ID", iWids[0]},
-		})
+		}, findOptions(ctx, ""))
 
 		if err != nil {
 			return nil, err
@@ -951,11 +1013,11 @@ func (db *MongoDB) GetStockInfo(districtId int, iIds []int, iWids []int, allLoca
 			})
 		}
 
-		cursor, err = db.C.Collection("STOCK").Find(db.ctx,
+		cursor, err = db.C.Collection("STOCK").Find(db.withSession(ctx),
 			bson.D{
 				{"$or", searchList},
 
-			},options.Find().SetProjection(stockProjection))
+			},findOptions(ctx, "").SetProjection(stockProjection))
 
 		if err != nil {
 			return nil, err
@@ -964,7 +1026,7 @@ func (db *MongoDB) GetStockInfo(districtId int, iIds []int, iWids []int, allLoca
 
 	var stocks []models.Stock
 
-	err = cursor.All(db.ctx, &stocks)
+	err = cursor.All(db.withSession(ctx), &stocks)
 	if err != nil {
 		return nil, err
 	}
@@ -972,8 +1034,8 @@ func (db *MongoDB) GetStockInfo(districtId int, iIds []int, iWids []int, allLoca
 	return &stocks, nil
 }
 
-func (db *MongoDB) UpdateStock(stockId int, warehouseId int, quantity int, ytd int, ordercnt int, remotecnt int ) error {
-	ru, err := db.C.Collection("STOCK").UpdateOne(db.ctx,
+func (db *MongoDB) UpdateStock(ctx context.Context, stockId int, warehouseId int, quantity int, ytd int, ordercnt int, remotecnt int ) error {
+	ru, err := db.C.Collection("STOCK").UpdateOne(db.withSession(ctx),
 		bson.D{
 			{"S_I_ID", stockId},
 			{"S_W_ID", warehouseId},
@@ -999,3 +1061,195 @@ func (db *MongoDB) UpdateStock(stockId int, warehouseId int, quantity int, ytd i
 	return nil
 }
 
+func (db *MongoDB) Close(ctx context.Context) error {
+	db.sess.EndSession(ctx)
+	return db.Client.Disconnect(ctx)
+}
+
+func (db *MongoDB) Classify(err error) databases.ErrorClass {
+	var cmdErr mongo.CommandError
+	var writeErr mongo.WriteException
+
+	switch {
+	case err == nil:
+		return databases.ClassNone
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return databases.ClassNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return databases.ClassTimeout
+	case errors.Is(err, context.Canceled):
+		return databases.ClassCanceled
+	case errors.Is(err, mongo.ErrClientDisconnected), errors.As(err, &topology.ConnectionError{}), databases.IsConnectionError(err):
+		return databases.ClassConnection
+	// the driver formats the server selection errors, they can not be
+	// unwrapped
+	case strings.HasPrefix(err.Error(), "server selection error"):
+		return databases.ClassConnection
+	case errors.As(err, &cmdErr):
+		switch {
+		// WriteConflict
+		case cmdErr.HasErrorLabel("TransientTransactionError"), cmdErr.Code == 112:
+			return databases.ClassConflict
+		case cmdErr.IsMaxTimeMSExpiredError():
+			return databases.ClassTimeout
+		case cmdErr.HasErrorLabel("NetworkError"):
+			return databases.ClassConnection
+		}
+	case errors.As(err, &writeErr):
+		if writeErr.HasErrorLabel("TransientTransactionError") {
+			return databases.ClassConflict
+		}
+		for _, we := range writeErr.WriteErrors {
+			if we.Code == 112 {
+				return databases.ClassConflict
+			}
+		}
+	}
+
+	return databases.ClassOther
+}
+
+func (db *MongoDB) CountRows(ctx context.Context, table string, warehouseId int) (int64, error) {
+	filter := bson.D{}
+	if warehouseId > 0 {
+		column, ok := databases.WarehouseColumns[table]
+		if !ok {
+			return 0, fmt.Errorf("table %s is not split by warehouse", table)
+		}
+		filter = bson.D{{column, warehouseId}}
+	}
+
+	n, err := db.C.Collection(table).CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	if table != "ORDER_LINE" {
+		return n, nil
+	}
+
+	// order lines are embedded in the orders, a normalized ORDER_LINE
+	// collection is counted as well in case both are used
+	match := bson.D{}
+	if warehouseId > 0 {
+		match = bson.D{{"O_W_ID", warehouseId}}
+	}
+
+	embedded, err := db.sumOrders(ctx, match, bson.D{{"$size", bson.D{{"$ifNull", bson.A{"$ORDER_LINE", bson.A{}}}}}})
+	if err != nil {
+		return 0, err
+	}
+
+	return n + embedded, nil
+}
+
+func (db *MongoDB) SumOrderLineCounts(ctx context.Context, warehouseId int) (int64, error) {
+	return db.sumOrders(ctx, bson.D{{"O_W_ID", warehouseId}}, "$O_OL_CNT")
+}
+
+// sumOrders sums an expression over the matching orders
+func (db *MongoDB) sumOrders(ctx context.Context, match bson.D, expression interface{}) (int64, error) {
+	cursor, err := db.C.Collection("ORDERS").Aggregate(ctx, mongo.Pipeline{
+		{{"$match", match}},
+		{{"$group", bson.D{{"_id", nil}, {"n", bson.D{{"$sum", expression}}}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		N int64 `bson:"n"`
+	}
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(result) == 0 {
+		return 0, nil
+	}
+
+	return result[0].N, nil
+}
+
+// SaveMetadata stores one document per key with the key as _id
+func (db *MongoDB) SaveMetadata(ctx context.Context, metadata map[string]string) error {
+	collection := db.C.Collection(databases.MetadataTable)
+
+	for key, value := range metadata {
+		_, err := collection.ReplaceOne(ctx,
+			bson.D{{"_id", key}},
+			bson.D{{"_id", key}, {"value", value}},
+			options.Replace().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *MongoDB) LoadMetadata(ctx context.Context) (map[string]string, error) {
+	cursor, err := db.C.Collection(databases.MetadataTable).Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var documents []struct {
+		Key   string `bson:"_id"`
+		Value string `bson:"value"`
+	}
+	err = cursor.All(ctx, &documents)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := make(map[string]string)
+	for _, d := range documents {
+		metadata[d.Key] = d.Value
+	}
+
+	return metadata, nil
+}
+
+// findOptions, findOneOptions and aggregateOptions set the tag of the
+// context as comment of the operation, or comment without a tag. The driver
+// has no comment for the other operations, the connections are named by
+// their appName instead.
+func findOptions(ctx context.Context, comment string) *options.FindOptions {
+	o := options.Find()
+	if c := operationComment(ctx, comment); c != "" {
+		o.SetComment(c)
+	}
+
+	return o
+}
+
+func findOneOptions(ctx context.Context, comment string) *options.FindOneOptions {
+	o := options.FindOne()
+	if c := operationComment(ctx, comment); c != "" {
+		o.SetComment(c)
+	}
+
+	return o
+}
+
+func aggregateOptions(ctx context.Context, comment string) *options.AggregateOptions {
+	o := options.Aggregate()
+	if c := operationComment(ctx, comment); c != "" {
+		o.SetComment(c)
+	}
+
+	return o
+}
+
+func operationComment(ctx context.Context, comment string) string {
+	if t, ok := databases.TagFrom(ctx); ok {
+		return t.String()
+	}
+
+	return comment
+}
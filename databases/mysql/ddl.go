@@ -1,6 +1,13 @@
 package mysql
 
-func (db *MySQL) CreateSchema() error {
+import (
+	"context"
+	"fmt"
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"strings"
+)
+
+func (db *MySQL) CreateSchema(ctx context.Context) error {
 
 	tables := []string{`
 CREATE TABLE IF NOT EXISTS WAREHOUSE (
@@ -121,9 +128,15 @@ CREATE TABLE DISTRICT (
   C_DELIVERY_CNT smallint DEFAULT NULL,
   C_DATA text,
   PRIMARY KEY (C_W_ID,C_D_ID,C_ID))
+`,`
+CREATE TABLE TPCC_METADATA (
+  M_KEY varchar(64) NOT NULL,
+  M_VALUE varchar(255) DEFAULT NULL,
+  PRIMARY KEY (M_KEY))
 `}
 	for _, table := range tables {
-		_, err := db.Client.Exec(table)
+		name := databases.CreatedTable(table)
+		_, err := db.Client.ExecContext(ctx, table+db.storageClause(name)+db.partitionClause(name))
 		if err != nil {
 			return err
 		}
@@ -132,39 +145,133 @@ CREATE TABLE DISTRICT (
 	return nil
 }
 
-func (db *MySQL) CreateIndexes() error {
+// storageOptions are the table options a storage profile can set, in the
+// order they are given to CREATE TABLE
+var storageOptions = []string{"engine", "row_format", "key_block_size", "compression"}
+
+// storagePresets are the storage profiles of MySQL
+var storagePresets = map[string]databases.Storage{
+	databases.DefaultStorage: {},
+	// InnoDB table compression, needs innodb_file_per_table
+	"compressed": {All: databases.StorageOptions{"row_format": "COMPRESSED", "key_block_size": "8"}},
+	// InnoDB transparent page compression, needs a file system supporting
+	// hole punching
+	"page-compressed": {All: databases.StorageOptions{"compression": "zlib"}},
+}
+
+// storageClause is the table options of the storage of a table
+func (db *MySQL) storageClause(table string) string {
+	options := db.storage.For(table)
 
-	queries := []string {
-		"CREATE INDEX idx_customer on CUSTOMER (C_W_ID,C_D_ID,C_LAST,C_FIRST)",
-		"CREATE INDEX idx_orders  ON ORDERS  (O_W_ID,O_D_ID,O_C_ID,O_ID)",
-		"CREATE INDEX fkey_stock_2 ON STOCK (S_I_ID)",
-		"CREATE INDEX fkey_order_line_2 ON ORDER_LINE (OL_SUPPLY_W_ID,OL_I_ID)",
-		"CREATE INDEX fkey_history_1 ON HISTORY (H_C_W_ID,H_C_D_ID,H_C_ID)",
-		"CREATE INDEX fkey_history_2 ON HISTORY (H_W_ID,H_D_ID)",
+	var clause string
+	for _, name := range storageOptions {
+		value, ok := options[name]
+		if !ok {
+			continue
 		}
 
-	if db.fk {
-		fkq := []string {
-			"ALTER TABLE NEW_ORDER ADD CONSTRAINT fkey_new_orders_1 FOREIGN KEY(NO_W_ID,NO_D_ID,NO_O_ID) REFERENCES ORDERS(O_W_ID,O_D_ID,O_ID)",
-			"ALTER TABLE ORDERS ADD CONSTRAINT fkey_orders_1 FOREIGN KEY(O_W_ID,O_D_ID,O_C_ID) REFERENCES CUSTOMER(C_W_ID,C_D_ID,C_ID)",
-			"ALTER TABLE CUSTOMER ADD CONSTRAINT fkey_customer_1 FOREIGN KEY(C_W_ID,C_D_ID) REFERENCES DISTRICT(D_W_ID,D_ID)",
-			"ALTER TABLE HISTORY ADD CONSTRAINT fkey_history_1 FOREIGN KEY(H_C_W_ID,H_C_D_ID,H_C_ID) REFERENCES CUSTOMER(C_W_ID,C_D_ID,C_ID)",
-			"ALTER TABLE HISTORY ADD CONSTRAINT fkey_history_2 FOREIGN KEY(H_W_ID,H_D_ID) REFERENCES DISTRICT(D_W_ID,D_ID)",
-			"ALTER TABLE DISTRICT ADD CONSTRAINT fkey_district_1 FOREIGN KEY(D_W_ID) REFERENCES WAREHOUSE(W_ID)",
-			"ALTER TABLE ORDER_LINE ADD CONSTRAINT fkey_order_line_1 FOREIGN KEY(OL_W_ID,OL_D_ID,OL_O_ID) REFERENCES ORDERS(O_W_ID,O_D_ID,O_ID)",
-			"ALTER TABLE ORDER_LINE ADD CONSTRAINT fkey_order_line_2 FOREIGN KEY(OL_SUPPLY_W_ID,OL_I_ID) REFERENCES STOCK(S_W_ID,S_I_ID)",
-			"ALTER TABLE STOCK ADD CONSTRAINT fkey_stock_1 FOREIGN KEY(S_W_ID) REFERENCES WAREHOUSE(W_ID)",
-			"ALTER TABLE STOCK ADD CONSTRAINT fkey_stock_2 FOREIGN KEY(S_I_ID) REFERENCES ITEM(I_ID)",
+		if name == "compression" {
+			value = "'" + value + "'"
 		}
+		clause += fmt.Sprintf(" %s=%s", strings.ToUpper(name), value)
+	}
+
+	return clause
+}
+
+// partitionClause is the PARTITION BY clause of a table, empty for the
+// tables not keyed by warehouse or without partitioning
+func (db *MySQL) partitionClause(table string) string {
+	column, ok := databases.WarehouseColumns[table]
+	if !ok || !db.partitions.Enabled() {
+		return ""
+	}
+
+	if db.partitions.Method == databases.PartitionHash {
+		return fmt.Sprintf(" PARTITION BY HASH(%s) PARTITIONS %d", column, db.partitions.Count)
+	}
+
+	var partitions []string
+	for i, bound := range db.partitions.Bounds() {
+		partitions = append(partitions, fmt.Sprintf("PARTITION p%d VALUES LESS THAN (%d)", i, bound))
+	}
+	partitions = append(partitions, fmt.Sprintf("PARTITION p%d VALUES LESS THAN MAXVALUE", db.partitions.Count-1))
 
-		queries = append(queries, fkq...)
+	return fmt.Sprintf(" PARTITION BY RANGE (%s) (%s)", column, strings.Join(partitions, ", "))
+}
+
+func (db *MySQL) Indexes() []databases.Index {
+	var queries []string
+
+	switch db.indexProfile {
+	case databases.IndexMinimal:
+	case databases.IndexCovering:
+		// InnoDB secondary indexes carry the primary key, C_ID is covered
+		queries = append(queries,
+			"CREATE INDEX idx_customer ON CUSTOMER (C_W_ID,C_D_ID,C_LAST,C_FIRST,C_MIDDLE,C_BALANCE)",
+			"CREATE INDEX idx_orders ON ORDERS (O_W_ID,O_D_ID,O_C_ID,O_ID,O_CARRIER_ID,O_ENTRY_D)",
+			"CREATE INDEX idx_order_line ON ORDER_LINE (OL_W_ID,OL_D_ID,OL_O_ID,OL_I_ID,OL_AMOUNT)",
+			"CREATE INDEX idx_stock ON STOCK (S_W_ID,S_I_ID,S_QUANTITY)",
+		)
+		queries = append(queries, databases.SQLForeignKeyIndexes...)
+	default:
+		queries = append(queries, databases.SQLStandardIndexes...)
+		queries = append(queries, databases.SQLForeignKeyIndexes...)
 	}
+
+	if db.fk {
+		queries = append(queries, databases.SQLForeignKeys...)
+	}
+
+	indexes := make([]databases.Index, 0, len(queries))
 	for _, query := range queries {
-		_, err := db.Client.Exec(query)
+		indexes = append(indexes, databases.SQLIndex(query))
+	}
+
+	return indexes
+}
+
+// CreateIndex builds indexes online with the INPLACE algorithm. Foreign
+// keys are added with the COPY algorithm while foreign_key_checks is on.
+func (db *MySQL) CreateIndex(ctx context.Context, index databases.Index, online bool) error {
+	query := index.Definition.(string)
+	if online && !index.ForeignKey {
+		query += " ALGORITHM=INPLACE LOCK=NONE"
+	}
+
+	_, err := db.Client.ExecContext(ctx, query)
+	return err
+}
+
+func (db *MySQL) DropSchema(ctx context.Context) error {
+	return db.eachTable(ctx, "DROP TABLE IF EXISTS %s")
+}
+
+func (db *MySQL) TruncateSchema(ctx context.Context) error {
+	return db.eachTable(ctx, "TRUNCATE TABLE %s")
+}
+
+// eachTable runs the statement for every TPC-C table. Foreign key checks are
+// off meanwhile, InnoDB refuses to truncate a referenced table otherwise.
+func (db *MySQL) eachTable(ctx context.Context, format string) error {
+	conn, err := db.Client.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS=0")
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SET FOREIGN_KEY_CHECKS=1")
+
+	for _, table := range databases.Tables {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf(format, table))
 		if err != nil {
 			return err
 		}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
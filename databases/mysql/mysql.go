@@ -1,10 +1,14 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"github.com/Percona-Lab/go-tpcc/databases"
 	"github.com/Percona-Lab/go-tpcc/tpcc/models"
-	_ "github.com/go-sql-driver/mysql"
+	gomysql "github.com/go-sql-driver/mysql"
 	"reflect"
 	"strconv"
 	"strings"
@@ -15,11 +19,45 @@ type MySQL struct {
 	transactions bool
 	Client *sql.DB
 	fk bool
+	partitions databases.Partitioning
+	indexProfile string
+	storage databases.Storage
 	preparedStatements bool
 	tx *sql.Tx
 	isTx bool
 }
 
+func init() {
+	databases.Register("mysql", func(options databases.Options) (databases.Database, error) {
+		if options.ReadPreference != "" {
+			return nil, fmt.Errorf("the mysql driver has no read preference, replicas are selected by their URI")
+		}
+
+		// InnoDB supports foreign keys on unpartitioned tables only
+		if options.ForeignKeys && options.Partitions.Enabled() {
+			return nil, fmt.Errorf("the mysql driver does not support foreign keys on partitioned tables, use --foreign-keys=false")
+		}
+
+		db, err := NewMySQL(options.URI, options.DBName, options.Transactions)
+		if err != nil {
+			return nil, err
+		}
+
+		db.partitions = options.Partitions
+		db.fk = options.ForeignKeys
+		db.indexProfile = options.IndexProfile
+
+		db.storage, err = options.Storage.Resolve(storagePresets)
+		if err == nil {
+			err = db.storage.Check(storageOptions...)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return db, nil
+	})
+}
 
 func NewMySQL(uri string, dbname string, transactions bool) (*MySQL, error) {
 	var uri_ string
@@ -38,6 +76,14 @@ func NewMySQL(uri string, dbname string, transactions bool) (*MySQL, error) {
 	db.SetMaxOpenConns(1)
 	db.SetConnMaxLifetime(-1)
 
+	// sql.Open does not connect, a server that is down must fail here like
+	// with the other drivers
+	err = db.PingContext(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return &MySQL{
 		transactions: transactions,
 		Client: db,
@@ -47,7 +93,7 @@ func NewMySQL(uri string, dbname string, transactions bool) (*MySQL, error) {
 
 }
 
-func (db *MySQL) InsertOne(tableName string, d interface{}) error {
+func (db *MySQL) InsertOne(ctx context.Context, tableName string, d interface{}) error {
 	v := reflect.ValueOf(d)
 	t := v.Type()
 	var fields []string
@@ -69,7 +115,7 @@ func (db *MySQL) InsertOne(tableName string, d interface{}) error {
 
 	if db.preparedStatements {
 		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, f, strings.Repeat(",?", len(fields))[1:])
-		_, err := db.Client.Exec(query, values...)
+		_, err := db.Client.ExecContext(ctx, query, values...)
 		return err
 	}
 
@@ -90,20 +136,20 @@ func (db *MySQL) InsertOne(tableName string, d interface{}) error {
 		}
 	}
 
-	_,err := db.Client.Exec(
+	_,err := db.Client.ExecContext(ctx,
 		fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, f, strings.Join(values_, ",")),
 		)
 
 	return err
 }
 
-func (db *MySQL) InsertBatch(tableName string, d []interface{}) error {
+func (db *MySQL) InsertBatch(ctx context.Context, tableName string, d []interface{}) error {
 	//PS should be always disabled here
 	//batch should be implemented at some stage here
 	p := db.preparedStatements
 	db.preparedStatements  = false
 	for  _, item := range d {
-		err := db.InsertOne(tableName, item)
+		err := db.InsertOne(ctx, tableName, item)
 		if err != nil {
 			return err
 		}
@@ -115,8 +161,8 @@ func (db *MySQL) InsertBatch(tableName string, d []interface{}) error {
 }
 
 
-func (db *MySQL) StartTrx() error {
-	tx, err := db.Client.Begin()
+func (db *MySQL) StartTrx(ctx context.Context) error {
+	tx, err := db.Client.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -125,7 +171,7 @@ func (db *MySQL) StartTrx() error {
 	return nil
 }
 
-func (db *MySQL) CommitTrx() error {
+func (db *MySQL) CommitTrx(ctx context.Context) error {
 	err := db.tx.Commit()
 	if err != nil {
 		return err
@@ -135,7 +181,7 @@ func (db *MySQL) CommitTrx() error {
 	return nil
 }
 
-func (db *MySQL) RollbackTrx() error {
+func (db *MySQL) RollbackTrx(ctx context.Context) error {
 	err := db.tx.Rollback()
 	if err != nil {
 		return err
@@ -158,44 +204,44 @@ func (db *MySQL) transformQuery(query string, args ...interface{}) (string, []in
 	return query, args
 }
 
-func (db *MySQL) query(query string, args ...interface{}) (*sql.Rows, error){
+func (db *MySQL) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error){
 
-	query, args = db.transformQuery(query,args...)
+	query, args = db.transformQuery(databases.TagQuery(ctx, query),args...)
 
 	if db.transactions && db.isTx {
-		return db.tx.Query(query, args...)
+		return db.tx.QueryContext(ctx, query, args...)
 	}
 
-	return db.Client.Query(query, args...)
+	return db.Client.QueryContext(ctx, query, args...)
 }
 
-func (db *MySQL) queryRow(query string, args ...interface{}) *sql.Row {
+func (db *MySQL) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
 
-	query, args = db.transformQuery(query,args...)
+	query, args = db.transformQuery(databases.TagQuery(ctx, query),args...)
 
 	if db.transactions && db.isTx {
-		return db.tx.QueryRow(query, args...)
+		return db.tx.QueryRowContext(ctx, query, args...)
 	}
 
-	return db.Client.QueryRow(query, args...)
+	return db.Client.QueryRowContext(ctx, query, args...)
 }
 
-func (db *MySQL) exec(query string, args ...interface{}) (sql.Result, error){
+func (db *MySQL) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error){
 
-	query, args = db.transformQuery(query,args...)
+	query, args = db.transformQuery(databases.TagQuery(ctx, query),args...)
 
 	if db.transactions && db.isTx {
-		return db.tx.Exec(query, args...)
+		return db.tx.ExecContext(ctx, query, args...)
 	}
 
-	return db.Client.Exec(query, args...)
+	return db.Client.ExecContext(ctx, query, args...)
 }
 
-func (db *MySQL) IncrementDistrictOrderId(warehouseId int, districtId int) error {
+func (db *MySQL) IncrementDistrictOrderId(ctx context.Context, warehouseId int, districtId int) error {
 
 	query := "UPDATE DISTRICT SET D_NEXT_O_ID = D_NEXT_O_ID+? WHERE D_ID = ? AND D_W_ID = ?"
 
-	r, err := db.exec(query, 1, districtId, warehouseId)
+	r, err := db.exec(ctx, query, 1, districtId, warehouseId)
 
 	if err != nil {
 		return err
@@ -212,7 +258,7 @@ func (db *MySQL) IncrementDistrictOrderId(warehouseId int, districtId int) error
 
 	return nil
 }
-func (db *MySQL) GetNewOrder(warehouseId int, districtId int) (*models.NewOrder, error) {
+func (db *MySQL) GetNewOrder(ctx context.Context, warehouseId int, districtId int) (*models.NewOrder, error) {
 
 	var query string
 	if db.transactions {
@@ -220,7 +266,7 @@ func (db *MySQL) GetNewOrder(warehouseId int, districtId int) (*models.NewOrder,
 	} else {
 		query = "SELECT NO_O_ID FROM NEW_ORDER WHERE NO_D_ID = ? AND NO_W_ID = ? ORDER BY NO_O_ID ASC LIMIT 1"
 	}
-	r := db.queryRow(query, districtId, warehouseId)
+	r := db.queryRow(ctx, query, districtId, warehouseId)
 
 	var no models.NewOrder
 	err := r.Scan(&no.NO_O_ID)
@@ -231,10 +277,10 @@ func (db *MySQL) GetNewOrder(warehouseId int, districtId int) (*models.NewOrder,
 
 	return &no, nil
 }
-func (db *MySQL) DeleteNewOrder(orderId int, warehouseId int, districtId int) error {
+func (db *MySQL) DeleteNewOrder(ctx context.Context, orderId int, warehouseId int, districtId int) error {
 
 	query := "DELETE FROM NEW_ORDER WHERE NO_O_ID = ? AND NO_D_ID = ? AND NO_W_ID = ?"
-	r, err := db.exec(query, orderId, districtId, warehouseId)
+	r, err := db.exec(ctx, query, orderId, districtId, warehouseId)
 
 	if err != nil {
 		return err
@@ -253,7 +299,7 @@ func (db *MySQL) DeleteNewOrder(orderId int, warehouseId int, districtId int) er
 	return nil
 }
 
-func (db *MySQL) GetCustomer(customerId int, warehouseId int, districtId int) (*models.Customer, error) {
+func (db *MySQL) GetCustomer(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error) {
 
 	query := "SELECT C_ID, C_D_ID, C_W_ID, C_FIRST, C_MIDDLE, C_LAST, C_STREET_1, C_STREET_2, C_CITY, C_STATE, C_ZIP, " +
 		"C_PHONE, C_SINCE, C_CREDIT, C_CREDIT_LIM, C_DISCOUNT, C_BALANCE, C_YTD_PAYMENT, C_PAYMENT_CNT, C_DELIVERY_CNT, C_DATA " +
@@ -261,7 +307,7 @@ func (db *MySQL) GetCustomer(customerId int, warehouseId int, districtId int) (*
 
 	var customer models.Customer
 
-	r := db.queryRow(query, warehouseId, districtId, customerId)
+	r := db.queryRow(ctx, query, warehouseId, districtId, customerId)
 
 	err := r.Scan(
 		&customer.C_ID,
@@ -294,10 +340,10 @@ func (db *MySQL) GetCustomer(customerId int, warehouseId int, districtId int) (*
 	return &customer, nil
 }
 
-func (db *MySQL) UpdateOrders(orderId int, warehouseId int, districtId int, oCarrierId int, deliveryDate time.Time) error {
+func (db *MySQL) UpdateOrders(ctx context.Context, orderId int, warehouseId int, districtId int, oCarrierId int, deliveryDate time.Time) error {
 
 	query := "UPDATE ORDERS SET O_CARRIER_ID = ? WHERE O_ID = ? AND O_D_ID = ? AND O_W_ID = ?"
-	r, err := db.exec(query, oCarrierId, orderId, districtId, warehouseId)
+	r, err := db.exec(ctx, query, oCarrierId, orderId, districtId, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -311,7 +357,7 @@ func (db *MySQL) UpdateOrders(orderId int, warehouseId int, districtId int, oCar
 	}
 
 	query = "UPDATE ORDER_LINE SET OL_DELIVERY_D = ? WHERE OL_O_ID = ? AND OL_D_ID = ? AND OL_W_ID = ?"
-	r, err = db.exec(query, deliveryDate, orderId, districtId, warehouseId)
+	r, err = db.exec(ctx, query, deliveryDate, orderId, districtId, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -323,10 +369,10 @@ func (db *MySQL) UpdateOrders(orderId int, warehouseId int, districtId int, oCar
 	return nil
 }
 
-func (db *MySQL) SumOLAmount(orderId int, warehouseId int, districtId int) (float64, error) {
+func (db *MySQL) SumOLAmount(ctx context.Context, orderId int, warehouseId int, districtId int) (float64, error) {
 
 	query := "SELECT SUM(ol_amount) FROM ORDER_LINE WHERE OL_O_ID = ? AND OL_D_ID = ? AND OL_W_ID = ?"
-	row := db.queryRow(query, orderId, districtId, warehouseId)
+	row := db.queryRow(ctx, query, orderId, districtId, warehouseId)
 	var sum float64
 	err := row.Scan(&sum)
 	if err != nil {
@@ -337,10 +383,10 @@ func (db *MySQL) SumOLAmount(orderId int, warehouseId int, districtId int) (floa
 }
 
 
-func (db *MySQL) UpdateCustomer(customerId int, warehouseId int, districtId int, sumOlTotal float64) error {
+func (db *MySQL) UpdateCustomer(ctx context.Context, customerId int, warehouseId int, districtId int, sumOlTotal float64) error {
 	query := "UPDATE CUSTOMER SET C_BALANCE = C_BALANCE + ? WHERE C_ID = ? AND C_D_ID = ? AND C_W_ID = ?"
 
-	res, err := db.exec(query, sumOlTotal, customerId, districtId, warehouseId)
+	res, err := db.exec(ctx, query, sumOlTotal, customerId, districtId, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -357,10 +403,10 @@ func (db *MySQL) UpdateCustomer(customerId int, warehouseId int, districtId int,
 	return nil
 }
 
-func (db *MySQL) GetNextOrderId(warehouseId int, districtId int) (int, error) {
+func (db *MySQL) GetNextOrderId(ctx context.Context, warehouseId int, districtId int) (int, error) {
 	query := "SELECT D_NEXT_O_ID FROM DISTRICT WHERE D_ID = ? AND D_W_ID = ?"
 
-	row := db.queryRow(query, districtId, warehouseId)
+	row := db.queryRow(ctx, query, districtId, warehouseId)
 	var dn int
 	err := row.Scan(&dn)
 	if err != nil {
@@ -370,7 +416,7 @@ func (db *MySQL) GetNextOrderId(warehouseId int, districtId int) (int, error) {
 	return dn, nil
 }
 
-func (db *MySQL) GetStockCount(orderIdLt int, orderIdGt int, threshold int, warehouseId int, districtId int) (int64, error) {
+func (db *MySQL) GetStockCount(ctx context.Context, orderIdLt int, orderIdGt int, threshold int, warehouseId int, districtId int) (int64, error) {
 	query := "SELECT COUNT(DISTINCT(OL_I_ID)) FROM " +
 		"ORDER_LINE, STOCK " +
 		"WHERE " +
@@ -379,7 +425,7 @@ func (db *MySQL) GetStockCount(orderIdLt int, orderIdGt int, threshold int, ware
 		"AND S_W_ID = ? AND S_I_ID = OL_I_ID AND S_QUANTITY < ?"
 
 
-	row := db.queryRow(query, warehouseId, districtId, orderIdLt, orderIdGt, warehouseId, threshold)
+	row := db.queryRow(ctx, query, warehouseId, districtId, orderIdLt, orderIdGt, warehouseId, threshold)
 	var count int64
 	err := row.Scan(&count)
 	if err != nil {
@@ -390,12 +436,12 @@ func (db *MySQL) GetStockCount(orderIdLt int, orderIdGt int, threshold int, ware
 }
 
 
-func (db *MySQL) GetCustomerById(customerId int, warehouseId int, districtId int) (*models.Customer, error) {
+func (db *MySQL) GetCustomerById(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error) {
 	var c models.Customer
 
 	query := "SELECT C_ID, C_FIRST, C_MIDDLE, C_LAST, C_BALANCE FROM CUSTOMER WHERE C_ID = ? AND C_W_ID = ? and C_D_ID = ?"
 
-	row := db.queryRow(query, customerId, warehouseId, districtId)
+	row := db.queryRow(ctx, query, customerId, warehouseId, districtId)
 	err := row.Scan(&c.C_ID, &c.C_FIRST, &c.C_MIDDLE, &c.C_LAST, &c.C_BALANCE)
 	if err != nil {
 		return nil, err
@@ -404,15 +450,15 @@ func (db *MySQL) GetCustomerById(customerId int, warehouseId int, districtId int
 	return &c, nil;
 }
 
-func (db *MySQL) GetCustomerByName(name string, warehouseId int, districtId int) (*models.Customer, error) {
+func (db *MySQL) GetCustomerByName(ctx context.Context, name string, warehouseId int, districtId int) (*models.Customer, error) {
 
 	query := "SELECT C_ID, C_FIRST, C_MIDDLE, C_LAST, C_BALANCE FROM CUSTOMER WHERE C_W_ID = ? AND C_D_ID = ? AND C_LAST = ?"
 
-	rows,err := db.query(query, warehouseId, districtId, name)
-	defer rows.Close()
+	rows,err := db.query(ctx, query, warehouseId, districtId, name)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	var customer models.Customer
 	var customers []models.Customer
 	for rows.Next() {
@@ -427,17 +473,17 @@ func (db *MySQL) GetCustomerByName(name string, warehouseId int, districtId int)
 	}
 
 	if len(customers) < 1 {
-		return nil, fmt.Errorf("no customers found with given name: %s", name)
+		return nil, fmt.Errorf("no customers found with given name: %s: %w", name, sql.ErrNoRows)
 	}
 
 	return &customers[(len(customers)-1)/2],nil
 }
 
-func (db *MySQL) GetLastOrder(customerId int, warehouseId int, districtId int) (*models.Order, error) {
+func (db *MySQL) GetLastOrder(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Order, error) {
 
 	query := "SELECT O_ID, O_CARRIER_ID, O_ENTRY_D FROM ORDERS WHERE O_W_ID = ? AND O_D_ID = ? AND O_C_ID = ?"
 
-	row := db.queryRow(query, warehouseId, districtId, customerId)
+	row := db.queryRow(ctx, query, warehouseId, districtId, customerId)
 
 	var m models.Order
 
@@ -449,16 +495,16 @@ func (db *MySQL) GetLastOrder(customerId int, warehouseId int, districtId int) (
 	return &m, nil
 }
 
-func (db *MySQL) GetOrderLines(orderId int, warehouseId int, districtId int) (*[]models.OrderLine, error) {
+func (db *MySQL) GetOrderLines(ctx context.Context, orderId int, warehouseId int, districtId int) (*[]models.OrderLine, error) {
 
 	query := "SELECT OL_O_ID, OL_D_ID, OL_W_ID, OL_NUMBER, OL_I_ID, OL_SUPPLY_W_ID, OL_DELIVERY_D, OL_QUANTITY, OL_AMOUNT, OL_DIST_INFO FROM ORDER_LINE " +
 		"WHERE OL_O_ID = ? AND OL_W_ID = ? AND OL_D_ID = ?"
 
-	rows, err := db.query(query, orderId, warehouseId, districtId)
-	defer rows.Close()
+	rows, err := db.query(ctx, query, orderId, warehouseId, districtId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 
 	var ol []models.OrderLine
@@ -489,11 +535,11 @@ func (db *MySQL) GetOrderLines(orderId int, warehouseId int, districtId int) (*[
 }
 
 
-func (db *MySQL) GetWarehouse(warehouseId int) (*models.Warehouse, error) {
+func (db *MySQL) GetWarehouse(ctx context.Context, warehouseId int) (*models.Warehouse, error) {
 
 	query := "SELECT W_ID, W_NAME, W_STREET_1, W_STREET_2, W_CITY, W_STATE, W_ZIP, W_TAX, W_YTD FROM WAREHOUSE WHERE W_ID = ?"
 
-	row := db.queryRow(query, warehouseId)
+	row := db.queryRow(ctx, query, warehouseId)
 
 	var w models.Warehouse
 
@@ -505,10 +551,10 @@ func (db *MySQL) GetWarehouse(warehouseId int) (*models.Warehouse, error) {
 	return &w, nil
 }
 
-func (db *MySQL) UpdateWarehouseBalance(warehouseId int, amount float64) error {
+func (db *MySQL) UpdateWarehouseBalance(ctx context.Context, warehouseId int, amount float64) error {
 	query := "UPDATE WAREHOUSE SET W_YTD = W_YTD + ? WHERE W_ID = ?"
 
-	r, err := db.exec(query, amount, warehouseId)
+	r, err := db.exec(ctx, query, amount, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -526,7 +572,7 @@ func (db *MySQL) UpdateWarehouseBalance(warehouseId int, amount float64) error {
 	return nil
 }
 
-func (db *MySQL) GetDistrict(warehouseId int, districtId int) (*models.District, error) {
+func (db *MySQL) GetDistrict(ctx context.Context, warehouseId int, districtId int) (*models.District, error) {
 
 	var query string
 	if db.transactions {
@@ -535,7 +581,7 @@ func (db *MySQL) GetDistrict(warehouseId int, districtId int) (*models.District,
 		query = "SELECT D_ID, D_W_ID, D_NAME, D_STREET_1, D_STREET_2, D_CITY, D_STATE, D_ZIP, D_TAX, D_YTD, D_NEXT_O_ID FROM DISTRICT WHERE D_W_ID = ? and D_ID = ?"
 	}
 
-	r := db.queryRow(query, warehouseId, districtId)
+	r := db.queryRow(ctx, query, warehouseId, districtId)
 	var d models.District
 
 	err := r.Scan(
@@ -558,11 +604,11 @@ func (db *MySQL) GetDistrict(warehouseId int, districtId int) (*models.District,
 
 	return &d, nil
 }
-func (db *MySQL) UpdateDistrictBalance(warehouseId int, districtId int, amount float64) error {
+func (db *MySQL) UpdateDistrictBalance(ctx context.Context, warehouseId int, districtId int, amount float64) error {
 
 	query := "UPDATE DISTRICT SET D_YTD = D_YTD + ? WHERE D_W_ID = ? AND D_ID = ?"
 
-	r, err := db.exec(query, amount, warehouseId, districtId)
+	r, err := db.exec(ctx, query, amount, warehouseId, districtId)
 	if err != nil {
 		return err
 	}
@@ -579,10 +625,10 @@ func (db *MySQL) UpdateDistrictBalance(warehouseId int, districtId int, amount f
 	return nil
 }
 
-func (db *MySQL) InsertHistory(warehouseId int, districtId int, date time.Time, amount float64, data string) error {
+func (db *MySQL) InsertHistory(ctx context.Context, warehouseId int, districtId int, date time.Time, amount float64, data string) error {
 	query := "INSERT INTO HISTORY (H_C_ID, H_D_ID, H_W_ID, H_C_W_ID, H_C_D_ID, H_DATE, H_AMOUNT, H_DATA) VALUES (?,?,?,?,?,?,?,?)"
 
-	_,err := db.exec(query, 1, districtId, warehouseId, warehouseId, districtId, date, amount, data)
+	_,err := db.exec(ctx, query, 1, districtId, warehouseId, warehouseId, districtId, date, amount, data)
 	if err != nil {
 		return err
 	}
@@ -590,11 +636,11 @@ func (db *MySQL) InsertHistory(warehouseId int, districtId int, date time.Time,
 	return nil
 }
 
-func (db *MySQL) GetCustomerIdOrder(orderId int, warehouseId int, districtId int) (int, error) {
+func (db *MySQL) GetCustomerIdOrder(ctx context.Context, orderId int, warehouseId int, districtId int) (int, error) {
 
 	query := "SELECT O_C_ID FROM ORDERS WHERE O_ID = ? AND O_D_ID = ? AND O_W_ID = ?"
 
-	r := db.queryRow(query, orderId, districtId, warehouseId)
+	r := db.queryRow(ctx, query, orderId, districtId, warehouseId)
 
 	var cId int
 
@@ -607,13 +653,13 @@ func (db *MySQL) GetCustomerIdOrder(orderId int, warehouseId int, districtId int
 	return cId, nil
 }
 
-func (db *MySQL) UpdateCredit(customerId int, warehouseId int, districtId int, balance float64, data string) error {
+func (db *MySQL) UpdateCredit(ctx context.Context, customerId int, warehouseId int, districtId int, balance float64, data string) error {
 
 	var err error
 	var res sql.Result
 
 	if len(data) > 0 {
-		res, err = db.exec("UPDATE CUSTOMER SET " +
+		res, err = db.exec(ctx, "UPDATE CUSTOMER SET " +
 			"C_BALANCE = C_BALANCE + ?, C_YTD_PAYMENT = C_YTD_PAYMENT + ?, C_PAYMENT_CNT = C_PAYMENT_CNT + ?, C_DATA = ? " +
 			"WHERE C_ID = ? AND C_W_ID = ? AND C_D_ID = ?",
 			-1* balance,
@@ -625,7 +671,7 @@ func (db *MySQL) UpdateCredit(customerId int, warehouseId int, districtId int, b
 			districtId,
 		)
 	} else {
-		res, err = db.exec("UPDATE CUSTOMER SET " +
+		res, err = db.exec(ctx, "UPDATE CUSTOMER SET " +
 			"C_BALANCE = C_BALANCE + ?, C_YTD_PAYMENT = C_YTD_PAYMENT + ?, C_PAYMENT_CNT = C_PAYMENT_CNT + ? " +
 			"WHERE C_ID = ? AND C_W_ID = ? AND C_D_ID = ?",
 			-1* balance,
@@ -655,6 +701,7 @@ func (db *MySQL) UpdateCredit(customerId int, warehouseId int, districtId int, b
 
 
 func (db *MySQL) CreateOrder(
+	ctx context.Context,
 	orderId int,
 	customerId int,
 	warehouseId int,
@@ -668,14 +715,14 @@ func (db *MySQL) CreateOrder(
 
 	query := "INSERT INTO ORDERS (O_ID, O_C_ID, O_D_ID, O_W_ID, O_ENTRY_D, O_CARRIER_ID, O_OL_CNT, O_ALL_LOCAL) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
 
-	_, err := db.exec(query, orderId, customerId, districtId, warehouseId, orderEntryDate, oCarrierId, oOlCnt, allLocal)
+	_, err := db.exec(ctx, query, orderId, customerId, districtId, warehouseId, orderEntryDate, oCarrierId, oOlCnt, allLocal)
 
 	if err != nil {
 		return err
 	}
 
 	query = "INSERT INTO NEW_ORDER (NO_O_ID, NO_D_ID, NO_W_ID) VALUES (?, ?, ?)"
-	_,err = db.exec(query, orderId, districtId, warehouseId)
+	_,err = db.exec(ctx, query, orderId, districtId, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -684,7 +731,7 @@ func (db *MySQL) CreateOrder(
 		query = "INSERT INTO ORDER_LINE (OL_O_ID, OL_D_ID, OL_W_ID, OL_NUMBER, OL_I_ID, OL_SUPPLY_W_ID, OL_QUANTITY, OL_AMOUNT, OL_DIST_INFO) " +
 			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
 
-		_, err = db.exec(query, o.OL_O_ID, districtId, warehouseId, o.OL_NUMBER, o.OL_I_ID, o.OL_SUPPLY_W_ID, o.OL_QUANTITY, o.OL_AMOUNT, o.OL_DIST_INFO)
+		_, err = db.exec(ctx, query, o.OL_O_ID, districtId, warehouseId, o.OL_NUMBER, o.OL_I_ID, o.OL_SUPPLY_W_ID, o.OL_QUANTITY, o.OL_AMOUNT, o.OL_DIST_INFO)
 		if err != nil {
 
 			return err
@@ -694,7 +741,7 @@ func (db *MySQL) CreateOrder(
 	return nil
 }
 
-func (db *MySQL) GetItems(itemIds []int) (*[]models.Item, error) {
+func (db *MySQL) GetItems(ctx context.Context, itemIds []int) (*[]models.Item, error) {
 	var itemIds_ []string
 
 	for _,item := range itemIds {
@@ -703,12 +750,12 @@ func (db *MySQL) GetItems(itemIds []int) (*[]models.Item, error) {
 
 	query := fmt.Sprintf("SELECT I_PRICE, I_NAME, I_DATA FROM ITEM WHERE I_ID IN (%s)", strings.Join(itemIds_, ","))
 
-	rows, err := db.query(query)
+	rows, err := db.query(ctx, query)
 
-	defer rows.Close()
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	var items []models.Item
 
 	for rows.Next() {
@@ -724,11 +771,11 @@ func (db *MySQL) GetItems(itemIds []int) (*[]models.Item, error) {
 	return &items, nil
 }
 
-func (db *MySQL) UpdateStock(stockId int, warehouseId int, quantity int, ytd int, ordercnt int, remotecnt int) error {
+func (db *MySQL) UpdateStock(ctx context.Context, stockId int, warehouseId int, quantity int, ytd int, ordercnt int, remotecnt int) error {
 
 	query := "UPDATE STOCK SET S_QUANTITY = ?, S_YTD = ?, S_ORDER_CNT = ?, S_REMOTE_CNT = ? WHERE S_I_ID = ? AND S_W_ID = ?"
 
-	r, err := db.exec(query, quantity, ytd, ordercnt, remotecnt, stockId, warehouseId)
+	r, err := db.exec(ctx, query, quantity, ytd, ordercnt, remotecnt, stockId, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -745,7 +792,7 @@ func (db *MySQL) UpdateStock(stockId int, warehouseId int, quantity int, ytd int
 	return nil
 }
 
-func (db *MySQL) GetStockInfo(districtId int, iIds []int, iWids []int, allLocal int) (*[]models.Stock, error) {
+func (db *MySQL) GetStockInfo(ctx context.Context, districtId int, iIds []int, iWids []int, allLocal int) (*[]models.Stock, error) {
 
 	var buf string
 
@@ -771,11 +818,11 @@ func (db *MySQL) GetStockInfo(districtId int, iIds []int, iWids []int, allLocal
 	query := fmt.Sprintf("SELECT S_I_ID, S_W_ID, S_QUANTITY, S_DATA, S_YTD, S_ORDER_CNT, S_REMOTE_CNT, S_DIST_%02d FROM STOCK " +
 		"WHERE %s", districtId, buf)
 
-	rows, err := db.query(query)
-	defer rows.Close()
+	rows, err := db.query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var stocks []models.Stock
 	for rows.Next() {
@@ -817,3 +864,96 @@ func (db *MySQL) GetStockInfo(districtId int, iIds []int, iWids []int, allLocal
 	}
 	return &stocks, nil
 }
+
+func (db *MySQL) Close(ctx context.Context) error {
+	return db.Client.Close()
+}
+
+func (db *MySQL) Classify(err error) databases.ErrorClass {
+	var myErr *gomysql.MySQLError
+
+	switch {
+	case err == nil:
+		return databases.ClassNone
+	case errors.Is(err, sql.ErrNoRows):
+		return databases.ClassNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return databases.ClassTimeout
+	case errors.Is(err, context.Canceled):
+		return databases.ClassCanceled
+	case errors.Is(err, gomysql.ErrInvalidConn), errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), databases.IsConnectionError(err):
+		return databases.ClassConnection
+	case errors.As(err, &myErr):
+		switch myErr.Number {
+		// ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT
+		case 1213, 1205:
+			return databases.ClassConflict
+		// ER_QUERY_TIMEOUT (max_execution_time), ER_QUERY_INTERRUPTED
+		case 3024, 1317:
+			return databases.ClassTimeout
+		}
+	}
+
+	return databases.ClassOther
+}
+
+func (db *MySQL) CountRows(ctx context.Context, table string, warehouseId int) (int64, error) {
+	query, args, err := databases.CountQuery(table, warehouseId)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err = db.queryRow(ctx, query, args...).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (db *MySQL) SumOrderLineCounts(ctx context.Context, warehouseId int) (int64, error) {
+	query := "SELECT COALESCE(SUM(O_OL_CNT), 0) FROM ORDERS WHERE O_W_ID = ?"
+
+	var n int64
+	err := db.queryRow(ctx, query, warehouseId).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+
+func (db *MySQL) SaveMetadata(ctx context.Context, metadata map[string]string) error {
+	query := "REPLACE INTO TPCC_METADATA (M_KEY, M_VALUE) VALUES (?, ?)"
+
+	for key, value := range metadata {
+		_, err := db.exec(ctx, query, key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *MySQL) LoadMetadata(ctx context.Context) (map[string]string, error) {
+	rows, err := db.query(ctx, "SELECT M_KEY, M_VALUE FROM TPCC_METADATA")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = value
+	}
+
+	return metadata, rows.Err()
+}
@@ -0,0 +1,75 @@
+package databases
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	PartitionHash  = "hash"
+	PartitionRange = "range"
+)
+
+// Partitioning splits the tables keyed by warehouse, those in
+// WarehouseColumns, into partitions by their warehouse id
+type Partitioning struct {
+	// Count is the number of partitions, 0 keeps the tables unpartitioned
+	Count int
+	// Method is PartitionHash or PartitionRange
+	Method string
+	// Warehouses is the number of warehouses the ranges are cut from
+	Warehouses int
+}
+
+func (p Partitioning) Enabled() bool {
+	return p.Count > 0
+}
+
+func (p Partitioning) Validate() error {
+	if p.Count < 0 {
+		return fmt.Errorf("number of partitions must not be negative, got %d", p.Count)
+	}
+
+	if !p.Enabled() {
+		return nil
+	}
+
+	switch p.Method {
+	case PartitionHash:
+	case PartitionRange:
+		if p.Warehouses < 1 {
+			return fmt.Errorf("range partitioning needs the number of warehouses")
+		}
+	default:
+		return fmt.Errorf("unknown partitioning %q, use %s|%s", p.Method, PartitionHash, PartitionRange)
+	}
+
+	return nil
+}
+
+// Bounds returns the exclusive upper warehouse id of every range partition
+// but the last one, which takes the rest. The warehouses are spread evenly,
+// the last partitions stay empty when there are fewer warehouses than
+// partitions.
+func (p Partitioning) Bounds() []int {
+	size := (p.Warehouses + p.Count - 1) / p.Count
+
+	bounds := make([]int, 0, p.Count-1)
+	for i := 1; i < p.Count; i++ {
+		bounds = append(bounds, i*size+1)
+	}
+
+	return bounds
+}
+
+var createTable = regexp.MustCompile(`(?i)^\s*CREATE TABLE (?:IF NOT EXISTS )?(\w+)`)
+
+// CreatedTable returns the name of the table a CREATE TABLE statement creates
+func CreatedTable(ddl string) string {
+	m := createTable.FindStringSubmatch(ddl)
+	if m == nil {
+		return ""
+	}
+
+	return m[1]
+}
@@ -1,8 +1,15 @@
 package postgresql
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"sort"
+	"strconv"
+	"strings"
+)
 
-func (db *PostgreSQL) CreateSchema() error {
+func (db *PostgreSQL) CreateSchema(ctx context.Context) error {
 
 	tables := []string{`
 CREATE TABLE IF NOT EXISTS WAREHOUSE (
@@ -123,52 +130,180 @@ CREATE TABLE DISTRICT (
   C_DELIVERY_CNT smallint DEFAULT NULL,
   C_DATA text,
   PRIMARY KEY (C_W_ID,C_D_ID,C_ID))
+`,`
+CREATE TABLE TPCC_METADATA (
+  M_KEY varchar(64) NOT NULL,
+  M_VALUE varchar(255) DEFAULT NULL,
+  PRIMARY KEY (M_KEY))
 `}
 
 	for _, table := range tables {
-		_, err := db.Client.Exec(context.Background(), table)
-		if err != nil {
-			return err
+		for _, query := range db.createTable(table) {
+			_, err := db.Client.Exec(ctx, query)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-func (db *PostgreSQL) CreateIndexes() error {
+// storagePresets are the storage profiles of PostgreSQL. Options other than
+// unlogged and tablespace are storage parameters.
+var storagePresets = map[string]databases.Storage{
+	databases.DefaultStorage: {},
+	// no WAL, the tables are emptied by crash recovery
+	"unlogged": {All: databases.StorageOptions{"unlogged": "true"}},
+	// room in the pages of the updated tables for HOT updates
+	"hot-updates": {Tables: map[string]databases.StorageOptions{
+		"WAREHOUSE": {"fillfactor": "80"},
+		"DISTRICT":  {"fillfactor": "80"},
+		"CUSTOMER":  {"fillfactor": "80"},
+		"STOCK":     {"fillfactor": "80"},
+	}},
+}
 
-	queries := []string {
-		"CREATE INDEX idx_customer on CUSTOMER (C_W_ID,C_D_ID,C_LAST,C_FIRST)",
-		"CREATE INDEX idx_orders  ON ORDERS  (O_W_ID,O_D_ID,O_C_ID,O_ID)",
-		"CREATE INDEX fkey_stock_2 ON STOCK (S_I_ID)",
-		"CREATE INDEX fkey_order_line_2 ON ORDER_LINE (OL_SUPPLY_W_ID,OL_I_ID)",
-		"CREATE INDEX fkey_history_1 ON HISTORY (H_C_W_ID,H_C_D_ID,H_C_ID)",
-		"CREATE INDEX fkey_history_2 ON HISTORY (H_W_ID,H_D_ID)",
+func checkStorage(s databases.Storage) error {
+	err := s.Check()
+	if err != nil {
+		return err
 	}
 
-	if db.fk {
-		fkq := []string {
-			"ALTER TABLE NEW_ORDER ADD CONSTRAINT fkey_new_orders_1 FOREIGN KEY(NO_W_ID,NO_D_ID,NO_O_ID) REFERENCES ORDERS(O_W_ID,O_D_ID,O_ID)",
-			"ALTER TABLE ORDERS ADD CONSTRAINT fkey_orders_1 FOREIGN KEY(O_W_ID,O_D_ID,O_C_ID) REFERENCES CUSTOMER(C_W_ID,C_D_ID,C_ID)",
-			"ALTER TABLE CUSTOMER ADD CONSTRAINT fkey_customer_1 FOREIGN KEY(C_W_ID,C_D_ID) REFERENCES DISTRICT(D_W_ID,D_ID)",
-			"ALTER TABLE HISTORY ADD CONSTRAINT fkey_history_1 FOREIGN KEY(H_C_W_ID,H_C_D_ID,H_C_ID) REFERENCES CUSTOMER(C_W_ID,C_D_ID,C_ID)",
-			"ALTER TABLE HISTORY ADD CONSTRAINT fkey_history_2 FOREIGN KEY(H_W_ID,H_D_ID) REFERENCES DISTRICT(D_W_ID,D_ID)",
-			"ALTER TABLE DISTRICT ADD CONSTRAINT fkey_district_1 FOREIGN KEY(D_W_ID) REFERENCES WAREHOUSE(W_ID)",
-			"ALTER TABLE ORDER_LINE ADD CONSTRAINT fkey_order_line_1 FOREIGN KEY(OL_W_ID,OL_D_ID,OL_O_ID) REFERENCES ORDERS(O_W_ID,O_D_ID,O_ID)",
-			"ALTER TABLE ORDER_LINE ADD CONSTRAINT fkey_order_line_2 FOREIGN KEY(OL_SUPPLY_W_ID,OL_I_ID) REFERENCES STOCK(S_W_ID,S_I_ID)",
-			"ALTER TABLE STOCK ADD CONSTRAINT fkey_stock_1 FOREIGN KEY(S_W_ID) REFERENCES WAREHOUSE(W_ID)",
-			"ALTER TABLE STOCK ADD CONSTRAINT fkey_stock_2 FOREIGN KEY(S_I_ID) REFERENCES ITEM(I_ID)",
+	for _, table := range databases.Tables {
+		if v, ok := s.For(table)["unlogged"]; ok {
+			if _, err := strconv.ParseBool(v); err != nil {
+				return fmt.Errorf("invalid unlogged %q for %s", v, table)
+			}
+		}
+	}
+
+	return nil
+}
+
+// storageClause returns whether a table is unlogged and the clauses that
+// follow its definition
+func (db *PostgreSQL) storageClause(table string) (bool, string) {
+	options := db.storage.For(table)
+
+	var parameters []string
+	for name, value := range options {
+		if name != "unlogged" && name != "tablespace" {
+			parameters = append(parameters, name+"="+value)
 		}
+	}
+	sort.Strings(parameters)
 
-		queries = append(queries, fkq...)
+	var clause string
+	if len(parameters) > 0 {
+		clause += " WITH (" + strings.Join(parameters, ", ") + ")"
 	}
-	for _, query := range queries {
-		_, err := db.Client.Exec(context.Background(), query)
-		if err != nil {
-			return err
+	if tablespace, ok := options["tablespace"]; ok {
+		clause += " TABLESPACE " + tablespace
+	}
+
+	unlogged, _ := strconv.ParseBool(options["unlogged"])
+	return unlogged, clause
+}
+
+// createTable turns a CREATE TABLE statement into the statements creating
+// the table with its storage. Tables keyed by warehouse get their
+// partitions, the storage applies to those as a partitioned table has none.
+func (db *PostgreSQL) createTable(ddl string) []string {
+	table := databases.CreatedTable(ddl)
+
+	unlogged, storage := db.storageClause(table)
+	create := func(query string) string {
+		if unlogged {
+			query = strings.Replace(query, "CREATE TABLE", "CREATE UNLOGGED TABLE", 1)
 		}
+		return query + storage
 	}
 
-	return nil
+	column, ok := databases.WarehouseColumns[table]
+	if !ok || !db.partitions.Enabled() {
+		return []string{create(ddl)}
+	}
+
+	n := db.partitions.Count
+	queries := []string{fmt.Sprintf("%s PARTITION BY %s (%s)", ddl, strings.ToUpper(db.partitions.Method), column)}
+
+	for i := 0; i < n; i++ {
+		var bounds string
+		if db.partitions.Method == databases.PartitionHash {
+			bounds = fmt.Sprintf("WITH (MODULUS %d, REMAINDER %d)", n, i)
+		} else {
+			from, to := "MINVALUE", "MAXVALUE"
+			b := db.partitions.Bounds()
+			if i > 0 {
+				from = strconv.Itoa(b[i-1])
+			}
+			if i < n-1 {
+				to = strconv.Itoa(b[i])
+			}
+			bounds = fmt.Sprintf("FROM (%s) TO (%s)", from, to)
+		}
+
+		queries = append(queries, create(fmt.Sprintf("CREATE TABLE %s_P%d PARTITION OF %s FOR VALUES %s", table, i, table, bounds)))
+	}
+
+	return queries
 }
 
+func (db *PostgreSQL) Indexes() []databases.Index {
+	var queries []string
+
+	switch db.indexProfile {
+	case databases.IndexMinimal:
+	case databases.IndexCovering:
+		// INCLUDE needs PostgreSQL 11
+		queries = append(queries,
+			"CREATE INDEX idx_customer ON CUSTOMER (C_W_ID,C_D_ID,C_LAST,C_FIRST) INCLUDE (C_ID,C_MIDDLE,C_BALANCE)",
+			"CREATE INDEX idx_orders ON ORDERS (O_W_ID,O_D_ID,O_C_ID,O_ID) INCLUDE (O_CARRIER_ID,O_ENTRY_D)",
+			"CREATE INDEX idx_order_line ON ORDER_LINE (OL_W_ID,OL_D_ID,OL_O_ID) INCLUDE (OL_I_ID,OL_AMOUNT)",
+			"CREATE INDEX idx_stock ON STOCK (S_W_ID,S_I_ID) INCLUDE (S_QUANTITY)",
+		)
+		queries = append(queries, databases.SQLForeignKeyIndexes...)
+	default:
+		queries = append(queries, databases.SQLStandardIndexes...)
+		queries = append(queries, databases.SQLForeignKeyIndexes...)
+	}
+
+	if db.fk {
+		queries = append(queries, databases.SQLForeignKeys...)
+	}
+
+	indexes := make([]databases.Index, 0, len(queries))
+	for _, query := range queries {
+		indexes = append(indexes, databases.SQLIndex(query))
+	}
+
+	return indexes
+}
+
+// CreateIndex builds indexes online with CONCURRENTLY, but for those of
+// partitioned tables which do not support it
+func (db *PostgreSQL) CreateIndex(ctx context.Context, index databases.Index, online bool) error {
+	query := index.Definition.(string)
+
+	_, keyed := databases.WarehouseColumns[index.Table]
+	partitioned := keyed && db.partitions.Enabled()
+	if online && !index.ForeignKey && !partitioned {
+		query = strings.Replace(query, "CREATE INDEX", "CREATE INDEX CONCURRENTLY", 1)
+	}
+
+	_, err := db.Client.Exec(ctx, query)
+	return err
+}
+
+func (db *PostgreSQL) DropSchema(ctx context.Context) error {
+	_, err := db.Client.Exec(ctx, "DROP TABLE IF EXISTS "+strings.Join(databases.Tables, ", ")+" CASCADE")
+
+	return err
+}
+
+func (db *PostgreSQL) TruncateSchema(ctx context.Context) error {
+	_, err := db.Client.Exec(ctx, "TRUNCATE "+strings.Join(databases.Tables, ", ")+" CASCADE")
+
+	return err
+}
@@ -2,7 +2,9 @@ package postgresql
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/Percona-Lab/go-tpcc/databases"
 	"github.com/Percona-Lab/go-tpcc/tpcc/models"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
@@ -16,14 +18,51 @@ type PostgreSQL struct {
 	transactions bool
 	Client *pgx.Conn
 	fk bool
+	partitions databases.Partitioning
+	indexProfile string
+	storage databases.Storage
 	preparedStatements bool
 	tx pgx.Tx
 	isTx bool
 }
 
+func init() {
+	databases.Register("postgresql", func(options databases.Options) (databases.Database, error) {
+		if options.ReadPreference != "" {
+			return nil, fmt.Errorf("the postgresql driver has no read preference, replicas are selected by their URI")
+		}
+
+		db, err := NewPostgreSQL(options.URI, options.DBName, options.Transactions, options.ApplicationName)
+		if err != nil {
+			return nil, err
+		}
+		db.partitions = options.Partitions
+		db.fk = options.ForeignKeys
+		db.indexProfile = options.IndexProfile
+
+		db.storage, err = options.Storage.Resolve(storagePresets)
+		if err == nil {
+			err = checkStorage(db.storage)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return db, nil
+	})
+}
+
+func NewPostgreSQL(uri string, dbname string, transactions bool, applicationName string) (*PostgreSQL, error) {
+	config, err := pgx.ParseConfig(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if applicationName != "" {
+		config.RuntimeParams["application_name"] = applicationName
+	}
 
-func NewPostgreSQL(uri string, dbname string, transactions bool) (*PostgreSQL, error) {
-	conn, err := pgx.Connect(context.Background(), uri)
+	conn, err := pgx.ConnectConfig(context.Background(), config)
 	if err != nil {
 		return nil, err
 	}
@@ -42,8 +81,8 @@ func NewPostgreSQL(uri string, dbname string, transactions bool) (*PostgreSQL, e
 
 }
 
-func (db *PostgreSQL) StartTrx() error {
-	tx, err := db.Client.Begin(context.Background())
+func (db *PostgreSQL) StartTrx(ctx context.Context) error {
+	tx, err := db.Client.Begin(ctx)
 	if err != nil {
 		return err
 	}
@@ -52,12 +91,12 @@ func (db *PostgreSQL) StartTrx() error {
 	return nil
 }
 
-func (db *PostgreSQL) CommitTrx() error {
-	return db.tx.Commit(context.Background())
+func (db *PostgreSQL) CommitTrx(ctx context.Context) error {
+	return db.tx.Commit(ctx)
 }
 
-func (db *PostgreSQL) RollbackTrx() error {
-	return db.tx.Rollback(context.Background())
+func (db *PostgreSQL) RollbackTrx(ctx context.Context) error {
+	return db.tx.Rollback(ctx)
 }
 
 func (db *PostgreSQL) transformQuery(query string, args ...interface{}) (string, []interface{}) {
@@ -82,40 +121,40 @@ func (db *PostgreSQL) transformQuery(query string, args ...interface{}) (string,
 	return query, args
 }
 
-func (db *PostgreSQL) query(query string, args ...interface{}) (pgx.Rows, error){
+func (db *PostgreSQL) query(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error){
 
-	query, args = db.transformQuery(query,args...)
+	query, args = db.transformQuery(databases.TagQuery(ctx, query),args...)
 
 	if db.transactions && db.isTx {
-		return db.tx.Query(context.Background(), query, args...)
+		return db.tx.Query(ctx, query, args...)
 	}
 
-	return db.Client.Query(context.Background(), query, args...)
+	return db.Client.Query(ctx, query, args...)
 }
 
-func (db *PostgreSQL) queryRow(query string, args ...interface{}) pgx.Row {
+func (db *PostgreSQL) queryRow(ctx context.Context, query string, args ...interface{}) pgx.Row {
 
-	query, args = db.transformQuery(query,args...)
+	query, args = db.transformQuery(databases.TagQuery(ctx, query),args...)
 
 	if db.transactions && db.isTx {
-		return db.tx.QueryRow(context.Background(), query, args...)
+		return db.tx.QueryRow(ctx, query, args...)
 	}
 
-	return db.Client.QueryRow(context.Background(), query, args...)
+	return db.Client.QueryRow(ctx, query, args...)
 }
 
-func (db *PostgreSQL) exec(query string, args ...interface{}) (pgconn.CommandTag, error){
+func (db *PostgreSQL) exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error){
 
-	query, args = db.transformQuery(query,args...)
+	query, args = db.transformQuery(databases.TagQuery(ctx, query),args...)
 
 	if db.transactions && db.isTx {
-		return db.tx.Exec(context.Background(), query, args...)
+		return db.tx.Exec(ctx, query, args...)
 	}
 
-	return db.Client.Exec(context.Background(), query, args...)
+	return db.Client.Exec(ctx, query, args...)
 }
 
-func (db *PostgreSQL) InsertOne(tableName string, d interface{}) error {
+func (db *PostgreSQL) InsertOne(ctx context.Context, tableName string, d interface{}) error {
 	v := reflect.ValueOf(d)
 	t := v.Type()
 	var fields []string
@@ -136,7 +175,7 @@ func (db *PostgreSQL) InsertOne(tableName string, d interface{}) error {
 	if db.preparedStatements {
 
 		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, f, strings.Repeat(",?", len(fields))[1:])
-		_, err := db.Client.Exec(context.Background(), query, values...)
+		_, err := db.Client.Exec(ctx, query, values...)
 		return err
 	}
 
@@ -158,7 +197,7 @@ func (db *PostgreSQL) InsertOne(tableName string, d interface{}) error {
 	}
 
 	_,err := db.Client.Exec(
-		context.Background(),
+		ctx,
 		fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, f, strings.Join(values_, ",")),
 	)
 	if err != nil {
@@ -168,9 +207,9 @@ func (db *PostgreSQL) InsertOne(tableName string, d interface{}) error {
 	return err
 }
 
-func (db *PostgreSQL) InsertBatch(tableName string, d []interface{}) error {
+func (db *PostgreSQL) InsertBatch(ctx context.Context, tableName string, d []interface{}) error {
 	for _, item := range d {
-		err := db.InsertOne(tableName, item)
+		err := db.InsertOne(ctx, tableName, item)
 		if err != nil {
 			return err
 		}
@@ -179,10 +218,10 @@ func (db *PostgreSQL) InsertBatch(tableName string, d []interface{}) error {
 	return nil
 }
 
-func (db *PostgreSQL) IncrementDistrictOrderId(warehouseId int, districtId int) error {
+func (db *PostgreSQL) IncrementDistrictOrderId(ctx context.Context, warehouseId int, districtId int) error {
 	query := "UPDATE DISTRICT SET D_NEXT_O_ID = D_NEXT_O_ID+? WHERE D_ID = ? AND D_W_ID = ?"
 
-	r, err := db.exec(query, 1, districtId, warehouseId)
+	r, err := db.exec(ctx, query, 1, districtId, warehouseId)
 
 	if err != nil {
 		return err
@@ -195,7 +234,7 @@ func (db *PostgreSQL) IncrementDistrictOrderId(warehouseId int, districtId int)
 	return nil
 }
 
-func (db *PostgreSQL) GetNewOrder(warehouseId int, districtId int) (*models.NewOrder, error) {
+func (db *PostgreSQL) GetNewOrder(ctx context.Context, warehouseId int, districtId int) (*models.NewOrder, error) {
 
 	var query string
 	if db.transactions {
@@ -203,7 +242,7 @@ func (db *PostgreSQL) GetNewOrder(warehouseId int, districtId int) (*models.NewO
 	} else {
 		query = "SELECT NO_O_ID FROM NEW_ORDER WHERE NO_D_ID = ? AND NO_W_ID = ? ORDER BY NO_O_ID ASC LIMIT 1"
 	}
-	r := db.queryRow(query, districtId, warehouseId)
+	r := db.queryRow(ctx, query, districtId, warehouseId)
 
 	var no models.NewOrder
 	err := r.Scan(&no.NO_O_ID)
@@ -215,10 +254,10 @@ func (db *PostgreSQL) GetNewOrder(warehouseId int, districtId int) (*models.NewO
 	return &no, nil
 }
 
-func (db *PostgreSQL) DeleteNewOrder(orderId int, warehouseId int, districtId int) error {
+func (db *PostgreSQL) DeleteNewOrder(ctx context.Context, orderId int, warehouseId int, districtId int) error {
 
 	query := "DELETE FROM NEW_ORDER WHERE NO_O_ID = ? AND NO_D_ID = ? AND NO_W_ID = ?"
-	r, err := db.exec(query, orderId, districtId, warehouseId)
+	r, err := db.exec(ctx, query, orderId, districtId, warehouseId)
 
 	if err != nil {
 		return err
@@ -231,7 +270,7 @@ func (db *PostgreSQL) DeleteNewOrder(orderId int, warehouseId int, districtId in
 	return nil
 }
 
-func (db *PostgreSQL) GetCustomer(customerId int, warehouseId int, districtId int) (*models.Customer, error) {
+func (db *PostgreSQL) GetCustomer(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error) {
 
 	query := "SELECT C_ID, C_D_ID, C_W_ID, C_FIRST, C_MIDDLE, C_LAST, C_STREET_1, C_STREET_2, C_CITY, C_STATE, C_ZIP, " +
 		"C_PHONE, C_SINCE, C_CREDIT, C_CREDIT_LIM :: float, C_DISCOUNT, C_BALANCE, C_YTD_PAYMENT, C_PAYMENT_CNT, C_DELIVERY_CNT, C_DATA " +
@@ -239,7 +278,7 @@ func (db *PostgreSQL) GetCustomer(customerId int, warehouseId int, districtId in
 
 	var customer models.Customer
 
-	r := db.queryRow(query, warehouseId, districtId, customerId)
+	r := db.queryRow(ctx, query, warehouseId, districtId, customerId)
 
 	err := r.Scan(
 		&customer.C_ID,
@@ -272,10 +311,10 @@ func (db *PostgreSQL) GetCustomer(customerId int, warehouseId int, districtId in
 	return &customer, nil
 }
 
-func (db *PostgreSQL) GetCustomerIdOrder(orderId int, warehouseId int, districtId int) (int, error) {
+func (db *PostgreSQL) GetCustomerIdOrder(ctx context.Context, orderId int, warehouseId int, districtId int) (int, error) {
 	query := "SELECT O_C_ID FROM ORDERS WHERE O_ID = ? AND O_D_ID = ? AND O_W_ID = ?"
 
-	r := db.queryRow(query, orderId, districtId, warehouseId)
+	r := db.queryRow(ctx, query, orderId, districtId, warehouseId)
 
 	var cId int
 
@@ -288,9 +327,9 @@ func (db *PostgreSQL) GetCustomerIdOrder(orderId int, warehouseId int, districtI
 	return cId, nil
 }
 
-func (db *PostgreSQL) UpdateOrders(orderId int, warehouseId int, districtId int, oCarrierId int, deliveryDate time.Time) error {
+func (db *PostgreSQL) UpdateOrders(ctx context.Context, orderId int, warehouseId int, districtId int, oCarrierId int, deliveryDate time.Time) error {
 	query := "UPDATE ORDERS SET O_CARRIER_ID = ? WHERE O_ID = ? AND O_D_ID = ? AND O_W_ID = ?"
-	r, err := db.exec(query, oCarrierId, orderId, districtId, warehouseId)
+	r, err := db.exec(ctx, query, oCarrierId, orderId, districtId, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -304,7 +343,7 @@ func (db *PostgreSQL) UpdateOrders(orderId int, warehouseId int, districtId int,
 	}
 
 	query = "UPDATE ORDER_LINE SET OL_DELIVERY_D = ? WHERE OL_O_ID = ? AND OL_D_ID = ? AND OL_W_ID = ?"
-	r, err = db.exec(query, deliveryDate, orderId, districtId, warehouseId)
+	r, err = db.exec(ctx, query, deliveryDate, orderId, districtId, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -312,9 +351,9 @@ func (db *PostgreSQL) UpdateOrders(orderId int, warehouseId int, districtId int,
 	return nil
 }
 
-func (db *PostgreSQL) SumOLAmount(orderId int, warehouseId int, districtId int) (float64, error) {
+func (db *PostgreSQL) SumOLAmount(ctx context.Context, orderId int, warehouseId int, districtId int) (float64, error) {
 	query := "SELECT SUM(ol_amount) FROM ORDER_LINE WHERE OL_O_ID = ? AND OL_D_ID = ? AND OL_W_ID = ?"
-	row := db.queryRow(query, orderId, districtId, warehouseId)
+	row := db.queryRow(ctx, query, orderId, districtId, warehouseId)
 	var sum float64
 	err := row.Scan(&sum)
 	if err != nil {
@@ -324,10 +363,10 @@ func (db *PostgreSQL) SumOLAmount(orderId int, warehouseId int, districtId int)
 	return sum, nil
 }
 
-func (db *PostgreSQL) UpdateCustomer(customerId int, warehouseId int, districtId int, sumOlTotal float64) error {
+func (db *PostgreSQL) UpdateCustomer(ctx context.Context, customerId int, warehouseId int, districtId int, sumOlTotal float64) error {
 	query := "UPDATE CUSTOMER SET C_BALANCE = C_BALANCE + ? WHERE C_ID = ? AND C_D_ID = ? AND C_W_ID = ?"
 
-	res, err := db.exec(query, sumOlTotal, customerId, districtId, warehouseId)
+	res, err := db.exec(ctx, query, sumOlTotal, customerId, districtId, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -339,10 +378,10 @@ func (db *PostgreSQL) UpdateCustomer(customerId int, warehouseId int, districtId
 	return nil
 }
 
-func (db *PostgreSQL) GetNextOrderId(warehouseId int, districtId int) (int, error) {
+func (db *PostgreSQL) GetNextOrderId(ctx context.Context, warehouseId int, districtId int) (int, error) {
 	query := "SELECT D_NEXT_O_ID FROM DISTRICT WHERE D_ID = ? AND D_W_ID = ?"
 
-	row := db.queryRow(query, districtId, warehouseId)
+	row := db.queryRow(ctx, query, districtId, warehouseId)
 	var dn int
 	err := row.Scan(&dn)
 	if err != nil {
@@ -352,7 +391,7 @@ func (db *PostgreSQL) GetNextOrderId(warehouseId int, districtId int) (int, erro
 	return dn, nil
 }
 
-func (db *PostgreSQL) GetStockCount(orderIdLt int, orderIdGt int, threshold int, warehouseId int, districtId int) (int64, error) {
+func (db *PostgreSQL) GetStockCount(ctx context.Context, orderIdLt int, orderIdGt int, threshold int, warehouseId int, districtId int) (int64, error) {
 	query := "SELECT COUNT(DISTINCT(OL_I_ID)) FROM " +
 		"ORDER_LINE, STOCK " +
 		"WHERE " +
@@ -361,7 +400,7 @@ func (db *PostgreSQL) GetStockCount(orderIdLt int, orderIdGt int, threshold int,
 		"AND S_W_ID = ? AND S_I_ID = OL_I_ID AND S_QUANTITY < ?"
 
 
-	row := db.queryRow(query, warehouseId, districtId, orderIdLt, orderIdGt, warehouseId, threshold)
+	row := db.queryRow(ctx, query, warehouseId, districtId, orderIdLt, orderIdGt, warehouseId, threshold)
 	var count int64
 	err := row.Scan(&count)
 	if err != nil {
@@ -371,12 +410,12 @@ func (db *PostgreSQL) GetStockCount(orderIdLt int, orderIdGt int, threshold int,
 	return count, nil
 }
 
-func (db *PostgreSQL) GetCustomerById(customerId int, warehouseId int, districtId int) (*models.Customer, error) {
+func (db *PostgreSQL) GetCustomerById(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Customer, error) {
 	var c models.Customer
 
 	query := "SELECT C_ID, C_FIRST, C_MIDDLE, C_LAST, C_BALANCE FROM CUSTOMER WHERE C_ID = ? AND C_W_ID = ? and C_D_ID = ?"
 
-	row := db.queryRow(query, customerId, warehouseId, districtId)
+	row := db.queryRow(ctx, query, customerId, warehouseId, districtId)
 	err := row.Scan(&c.C_ID, &c.C_FIRST, &c.C_MIDDLE, &c.C_LAST, &c.C_BALANCE)
 	if err != nil {
 		return nil, err
@@ -385,14 +424,14 @@ func (db *PostgreSQL) GetCustomerById(customerId int, warehouseId int, districtI
 	return &c, nil;
 }
 
-func (db *PostgreSQL) GetCustomerByName(name string, warehouseId int, districtId int) (*models.Customer, error) {
+func (db *PostgreSQL) GetCustomerByName(ctx context.Context, name string, warehouseId int, districtId int) (*models.Customer, error) {
 	query := "SELECT C_ID, C_FIRST, C_MIDDLE, C_LAST, C_BALANCE FROM CUSTOMER WHERE C_W_ID = ? AND C_D_ID = ? AND C_LAST = ?"
 
-	rows,err := db.query(query, warehouseId, districtId, name)
-	defer rows.Close()
+	rows,err := db.query(ctx, query, warehouseId, districtId, name)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	var customer models.Customer
 	var customers []models.Customer
 	for rows.Next() {
@@ -407,16 +446,16 @@ func (db *PostgreSQL) GetCustomerByName(name string, warehouseId int, districtId
 	}
 
 	if len(customers) < 1 {
-		return nil, fmt.Errorf("no customers found with given name: %s", name)
+		return nil, fmt.Errorf("no customers found with given name: %s: %w", name, pgx.ErrNoRows)
 	}
 
 	return &customers[(len(customers)-1)/2],nil
 }
 
-func (db *PostgreSQL) GetLastOrder(customerId int, warehouseId int, districtId int) (*models.Order, error) {
+func (db *PostgreSQL) GetLastOrder(ctx context.Context, customerId int, warehouseId int, districtId int) (*models.Order, error) {
 	query := "SELECT O_ID, O_CARRIER_ID, O_ENTRY_D FROM ORDERS WHERE O_W_ID = ? AND O_D_ID = ? AND O_C_ID = ?"
 
-	row := db.queryRow(query, warehouseId, districtId, customerId)
+	row := db.queryRow(ctx, query, warehouseId, districtId, customerId)
 
 	var m models.Order
 
@@ -428,15 +467,15 @@ func (db *PostgreSQL) GetLastOrder(customerId int, warehouseId int, districtId i
 	return &m, nil
 }
 
-func (db *PostgreSQL) GetOrderLines(orderId int, warehouseId int, districtId int) (*[]models.OrderLine, error) {
+func (db *PostgreSQL) GetOrderLines(ctx context.Context, orderId int, warehouseId int, districtId int) (*[]models.OrderLine, error) {
 	query := "SELECT OL_O_ID, OL_D_ID, OL_W_ID, OL_NUMBER, OL_I_ID, OL_SUPPLY_W_ID, OL_DELIVERY_D, OL_QUANTITY, OL_AMOUNT, OL_DIST_INFO FROM ORDER_LINE " +
 		"WHERE OL_O_ID = ? AND OL_W_ID = ? AND OL_D_ID = ?"
 
-	rows, err := db.query(query, orderId, warehouseId, districtId)
-	defer rows.Close()
+	rows, err := db.query(ctx, query, orderId, warehouseId, districtId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 
 	var ol []models.OrderLine
@@ -465,10 +504,10 @@ func (db *PostgreSQL) GetOrderLines(orderId int, warehouseId int, districtId int
 	return &ol, nil
 }
 
-func (db *PostgreSQL) GetWarehouse(warehouseId int) (*models.Warehouse, error) {
+func (db *PostgreSQL) GetWarehouse(ctx context.Context, warehouseId int) (*models.Warehouse, error) {
 	query := "SELECT W_ID, W_NAME, W_STREET_1, W_STREET_2, W_CITY, W_STATE, W_ZIP, W_TAX, W_YTD FROM WAREHOUSE WHERE W_ID = ?"
 
-	row := db.queryRow(query, warehouseId)
+	row := db.queryRow(ctx, query, warehouseId)
 
 	var w models.Warehouse
 
@@ -480,10 +519,10 @@ func (db *PostgreSQL) GetWarehouse(warehouseId int) (*models.Warehouse, error) {
 	return &w, nil
 }
 
-func (db *PostgreSQL) UpdateWarehouseBalance(warehouseId int, amount float64) error {
+func (db *PostgreSQL) UpdateWarehouseBalance(ctx context.Context, warehouseId int, amount float64) error {
 	query := "UPDATE WAREHOUSE SET W_YTD = W_YTD + ? WHERE W_ID = ?"
 
-	r, err := db.exec(query, amount, warehouseId)
+	r, err := db.exec(ctx, query, amount, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -496,7 +535,7 @@ func (db *PostgreSQL) UpdateWarehouseBalance(warehouseId int, amount float64) er
 	return nil
 }
 
-func (db *PostgreSQL) GetDistrict(warehouseId int, districtId int) (*models.District, error) {
+func (db *PostgreSQL) GetDistrict(ctx context.Context, warehouseId int, districtId int) (*models.District, error) {
 	var query string
 	if db.transactions {
 		query = "SELECT D_ID, D_W_ID, D_NAME, D_STREET_1, D_STREET_2, D_CITY, D_STATE, D_ZIP, D_TAX, D_YTD, D_NEXT_O_ID FROM DISTRICT WHERE D_W_ID = ? and D_ID = ? FOR UPDATE"
@@ -504,7 +543,7 @@ func (db *PostgreSQL) GetDistrict(warehouseId int, districtId int) (*models.Dist
 		query = "SELECT D_ID, D_W_ID, D_NAME, D_STREET_1, D_STREET_2, D_CITY, D_STATE, D_ZIP, D_TAX, D_YTD, D_NEXT_O_ID FROM DISTRICT WHERE D_W_ID = ? and D_ID = ?"
 	}
 
-	r := db.queryRow(query, warehouseId, districtId)
+	r := db.queryRow(ctx, query, warehouseId, districtId)
 	var d models.District
 
 	err := r.Scan(
@@ -528,10 +567,10 @@ func (db *PostgreSQL) GetDistrict(warehouseId int, districtId int) (*models.Dist
 	return &d, nil
 }
 
-func (db *PostgreSQL) UpdateDistrictBalance(warehouseId int, districtId int, amount float64) error {
+func (db *PostgreSQL) UpdateDistrictBalance(ctx context.Context, warehouseId int, districtId int, amount float64) error {
 	query := "UPDATE DISTRICT SET D_YTD = D_YTD + ? WHERE D_W_ID = ? AND D_ID = ?"
 
-	r, err := db.exec(query, amount, warehouseId, districtId)
+	r, err := db.exec(ctx, query, amount, warehouseId, districtId)
 	if err != nil {
 		return err
 	}
@@ -543,25 +582,23 @@ func (db *PostgreSQL) UpdateDistrictBalance(warehouseId int, districtId int, amo
 	return nil
 }
 
-func (db *PostgreSQL) InsertHistory(warehouseId int, districtId int, date time.Time, amount float64, data string) error {
+func (db *PostgreSQL) InsertHistory(ctx context.Context, warehouseId int, districtId int, date time.Time, amount float64, data string) error {
 	query := "INSERT INTO HISTORY (H_C_ID, H_D_ID, H_W_ID, H_C_W_ID, H_C_D_ID, H_DATE, H_AMOUNT, H_DATA) VALUES (?,?,?,?,?,?,?,?)"
 
-	_,err := db.exec(query, 1, districtId, warehouseId, warehouseId, districtId, date, amount, data)
+	_,err := db.exec(ctx, query, 1, districtId, warehouseId, warehouseId, districtId, date, amount, data)
 	if err != nil {
-		fmt.Println(db.transformQuery(query, 1, districtId, warehouseId, warehouseId, districtId, date, amount, data))
-		panic("aa")
 		return err
 	}
 
 	return nil
 }
 
-func (db *PostgreSQL) UpdateCredit(customerId int, warehouseId int, districtId int, balance float64, data string) error {
+func (db *PostgreSQL) UpdateCredit(ctx context.Context, customerId int, warehouseId int, districtId int, balance float64, data string) error {
 	var err error
 	var res pgconn.CommandTag
 
 	if len(data) > 0 {
-		res, err = db.exec("UPDATE CUSTOMER SET " +
+		res, err = db.exec(ctx, "UPDATE CUSTOMER SET " +
 			"C_BALANCE = C_BALANCE + ?, C_YTD_PAYMENT = C_YTD_PAYMENT + ?, C_PAYMENT_CNT = C_PAYMENT_CNT + ?, C_DATA = ? " +
 			"WHERE C_ID = ? AND C_W_ID = ? AND C_D_ID = ?",
 			-1* balance,
@@ -573,7 +610,7 @@ func (db *PostgreSQL) UpdateCredit(customerId int, warehouseId int, districtId i
 			districtId,
 		)
 	} else {
-		res, err = db.exec("UPDATE CUSTOMER SET " +
+		res, err = db.exec(ctx, "UPDATE CUSTOMER SET " +
 			"C_BALANCE = C_BALANCE + ?, C_YTD_PAYMENT = C_YTD_PAYMENT + ?, C_PAYMENT_CNT = C_PAYMENT_CNT + ? " +
 			"WHERE C_ID = ? AND C_W_ID = ? AND C_D_ID = ?",
 			-1* balance,
@@ -597,21 +634,21 @@ func (db *PostgreSQL) UpdateCredit(customerId int, warehouseId int, districtId i
 }
 
 func (db *PostgreSQL) CreateOrder(
+	ctx context.Context,
 	orderId, customerId, warehouseId, districtId, oCarrierId, oOlCnt, allLocal int,
 	orderEntryDate time.Time,
 	orderLine []models.OrderLine,
 ) error {
 	query := "INSERT INTO ORDERS (O_ID, O_C_ID, O_D_ID, O_W_ID, O_ENTRY_D, O_CARRIER_ID, O_OL_CNT, O_ALL_LOCAL) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
 
-	_, err := db.exec(query, orderId, customerId, districtId, warehouseId, orderEntryDate, oCarrierId, oOlCnt, allLocal)
+	_, err := db.exec(ctx, query, orderId, customerId, districtId, warehouseId, orderEntryDate, oCarrierId, oOlCnt, allLocal)
 
 	if err != nil {
-		fmt.Println(orderId, customerId, districtId, warehouseId, orderEntryDate, oCarrierId, oOlCnt, allLocal)
 		return err
 	}
 
 	query = "INSERT INTO NEW_ORDER (NO_O_ID, NO_D_ID, NO_W_ID) VALUES (?, ?, ?)"
-	_,err = db.exec(query, orderId, districtId, warehouseId)
+	_,err = db.exec(ctx, query, orderId, districtId, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -620,7 +657,7 @@ func (db *PostgreSQL) CreateOrder(
 		query = "INSERT INTO ORDER_LINE (OL_O_ID, OL_D_ID, OL_W_ID, OL_NUMBER, OL_I_ID, OL_SUPPLY_W_ID, OL_QUANTITY, OL_AMOUNT, OL_DIST_INFO) " +
 			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
 
-		_, err = db.exec(query, o.OL_O_ID, districtId, warehouseId, o.OL_NUMBER, o.OL_I_ID, o.OL_SUPPLY_W_ID, o.OL_QUANTITY, o.OL_AMOUNT, o.OL_DIST_INFO)
+		_, err = db.exec(ctx, query, o.OL_O_ID, districtId, warehouseId, o.OL_NUMBER, o.OL_I_ID, o.OL_SUPPLY_W_ID, o.OL_QUANTITY, o.OL_AMOUNT, o.OL_DIST_INFO)
 		if err != nil {
 
 			return err
@@ -630,7 +667,7 @@ func (db *PostgreSQL) CreateOrder(
 	return nil
 }
 
-func (db *PostgreSQL) GetItems(itemIds []int) (*[]models.Item, error) {
+func (db *PostgreSQL) GetItems(ctx context.Context, itemIds []int) (*[]models.Item, error) {
 	var itemIds_ []string
 
 	for _,item := range itemIds {
@@ -639,12 +676,12 @@ func (db *PostgreSQL) GetItems(itemIds []int) (*[]models.Item, error) {
 
 	query := fmt.Sprintf("SELECT I_PRICE, I_NAME, I_DATA FROM ITEM WHERE I_ID IN (%s)", strings.Join(itemIds_, ","))
 
-	rows, err := db.query(query)
+	rows, err := db.query(ctx, query)
 
-	defer rows.Close()
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	var items []models.Item
 
 	for rows.Next() {
@@ -660,11 +697,11 @@ func (db *PostgreSQL) GetItems(itemIds []int) (*[]models.Item, error) {
 	return &items, nil
 }
 
-func (db *PostgreSQL) UpdateStock(stockId int, warehouseId int, quantity int, ytd int, ordercnt int, remotecnt int) error {
+func (db *PostgreSQL) UpdateStock(ctx context.Context, stockId int, warehouseId int, quantity int, ytd int, ordercnt int, remotecnt int) error {
 
 	query := "UPDATE STOCK SET S_QUANTITY = ?, S_YTD = ?, S_ORDER_CNT = ?, S_REMOTE_CNT = ? WHERE S_I_ID = ? AND S_W_ID = ?"
 
-	r, err := db.exec(query, quantity, ytd, ordercnt, remotecnt, stockId, warehouseId)
+	r, err := db.exec(ctx, query, quantity, ytd, ordercnt, remotecnt, stockId, warehouseId)
 	if err != nil {
 		return err
 	}
@@ -677,6 +714,7 @@ func (db *PostgreSQL) UpdateStock(stockId int, warehouseId int, quantity int, yt
 }
 
 func (db *PostgreSQL) GetStockInfo(
+	ctx context.Context,
 	districtId int,
 	iIds []int,
 	iWids []int,
@@ -706,11 +744,11 @@ func (db *PostgreSQL) GetStockInfo(
 	query := fmt.Sprintf("SELECT S_I_ID, S_W_ID, S_QUANTITY, S_DATA, S_YTD, S_ORDER_CNT, S_REMOTE_CNT, S_DIST_%02d FROM STOCK " +
 		"WHERE %s", districtId, buf)
 
-	rows, err := db.query(query)
-	defer rows.Close()
+	rows, err := db.query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var stocks []models.Stock
 	for rows.Next() {
@@ -753,3 +791,100 @@ func (db *PostgreSQL) GetStockInfo(
 	return &stocks, nil
 }
 
+func (db *PostgreSQL) Close(ctx context.Context) error {
+	return db.Client.Close(ctx)
+}
+
+func (db *PostgreSQL) Classify(err error) databases.ErrorClass {
+	var pgErr *pgconn.PgError
+
+	switch {
+	case err == nil:
+		return databases.ClassNone
+	case errors.Is(err, pgx.ErrNoRows):
+		return databases.ClassNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return databases.ClassTimeout
+	case errors.Is(err, context.Canceled):
+		return databases.ClassCanceled
+	case errors.As(err, &pgErr):
+		switch {
+		// serialization_failure, deadlock_detected, lock_not_available
+		case pgErr.Code == "40001", pgErr.Code == "40P01", pgErr.Code == "55P03":
+			return databases.ClassConflict
+		// query_canceled, raised by statement_timeout
+		case pgErr.Code == "57014":
+			return databases.ClassTimeout
+		// connection_exception class
+		case strings.HasPrefix(pgErr.Code, "08"):
+			return databases.ClassConnection
+		}
+	case pgconn.Timeout(err):
+		return databases.ClassTimeout
+	case db.Client.IsClosed(), databases.IsConnectionError(err):
+		return databases.ClassConnection
+	}
+
+	return databases.ClassOther
+}
+
+func (db *PostgreSQL) CountRows(ctx context.Context, table string, warehouseId int) (int64, error) {
+	query, args, err := databases.CountQuery(table, warehouseId)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err = db.queryRow(ctx, query, args...).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (db *PostgreSQL) SumOrderLineCounts(ctx context.Context, warehouseId int) (int64, error) {
+	query := "SELECT COALESCE(SUM(O_OL_CNT), 0) FROM ORDERS WHERE O_W_ID = ?"
+
+	var n int64
+	err := db.queryRow(ctx, query, warehouseId).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+
+func (db *PostgreSQL) SaveMetadata(ctx context.Context, metadata map[string]string) error {
+	query := "INSERT INTO TPCC_METADATA (M_KEY, M_VALUE) VALUES (?, ?) ON CONFLICT (M_KEY) DO UPDATE SET M_VALUE = EXCLUDED.M_VALUE"
+
+	for key, value := range metadata {
+		_, err := db.exec(ctx, query, key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *PostgreSQL) LoadMetadata(ctx context.Context) (map[string]string, error) {
+	rows, err := db.query(ctx, "SELECT M_KEY, M_VALUE FROM TPCC_METADATA")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = value
+	}
+
+	return metadata, rows.Err()
+}
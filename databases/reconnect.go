@@ -0,0 +1,147 @@
+package databases
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// closeTimeout bounds closing a broken connection
+const closeTimeout = 5 * time.Second
+
+// Backoff is the delay between two attempts to reconnect, doubled after
+// every failed attempt up to Max
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// Downtime is a lost connection, from the call that failed with a connection
+// error to the successful reconnect
+type Downtime struct {
+	Start time.Time
+	End   time.Time
+	// Attempts is the number of connections opened, the successful one
+	// included
+	Attempts int
+}
+
+// ReconnectError is returned when the context of a call ends before the
+// connection could be opened again
+type ReconnectError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ReconnectError) Error() string {
+	return fmt.Sprintf("reconnecting failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *ReconnectError) Unwrap() error {
+	return e.Err
+}
+
+// Reconnector replaces broken connections and keeps their downtimes. It
+// belongs to one worker and is not safe for concurrent use.
+type Reconnector struct {
+	backoff   Backoff
+	downtimes []Downtime
+}
+
+// NewReconnector returns a reconnector waiting backoff.Initial, at least a
+// millisecond, before the second attempt
+func NewReconnector(backoff Backoff) *Reconnector {
+	if backoff.Initial < time.Millisecond {
+		backoff.Initial = time.Millisecond
+	}
+	if backoff.Max < backoff.Initial {
+		backoff.Max = backoff.Initial
+	}
+
+	return &Reconnector{backoff: backoff}
+}
+
+// Wrap returns a Database that replaces db, opened by open, once a call
+// fails with a connection error. The transaction running on the broken
+// connection fails and its rollback succeeds, as the server rolls it back.
+// The next call opens a new connection, trying again with backoff until it
+// succeeds or the context of the call ends.
+func (r *Reconnector) Wrap(db Database, open func() (Database, error)) Database {
+	c := &reconnecting{r: r, open: open}
+	c.db = &intercepted{next: db, i: c.intercept}
+
+	return c.db
+}
+
+// Take returns the downtimes that ended since the last Take
+func (r *Reconnector) Take() []Downtime {
+	downtimes := r.downtimes
+	r.downtimes = nil
+
+	return downtimes
+}
+
+type reconnecting struct {
+	r    *Reconnector
+	open func() (Database, error)
+	db   *intercepted
+	// broken is set by a connection error, down is when it happened
+	broken bool
+	down   time.Time
+}
+
+func (c *reconnecting) intercept(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	if c.broken {
+		switch method {
+		case "RollbackTrx":
+			return nil
+		case "CommitTrx":
+			return &ReconnectError{Err: fmt.Errorf("the connection of the transaction was lost")}
+		}
+
+		if err := c.reconnect(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := call(ctx)
+	if err != nil && c.db.next.Classify(err) == ClassConnection {
+		c.broken = true
+		c.down = time.Now()
+	}
+
+	return err
+}
+
+func (c *reconnecting) reconnect(ctx context.Context) error {
+	wait := c.r.backoff.Initial
+	attempts := 0
+
+	for {
+		attempts++
+		db, err := c.open()
+		if err == nil {
+			closeCtx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+			c.db.next.Close(closeCtx)
+			cancel()
+
+			c.db.next = db
+			c.broken = false
+			c.r.downtimes = append(c.r.downtimes, Downtime{Start: c.down, End: time.Now(), Attempts: attempts})
+			return nil
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return &ReconnectError{Attempts: attempts, Err: err}
+		}
+
+		wait *= 2
+		if wait > c.r.backoff.Max {
+			wait = c.r.backoff.Max
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package databases
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultStorage is the storage profile every driver has, it leaves the
+// tables as the database creates them by default
+const DefaultStorage = "default"
+
+// StorageOptions are driver specific table options by name, e.g. row_format
+// for MySQL or fillfactor for PostgreSQL
+type StorageOptions map[string]string
+
+// Storage selects how CreateSchema stores the tables
+type Storage struct {
+	// Profile names a preset of the driver, empty for DefaultStorage
+	Profile string
+	// All applies to every table. Tables applies to single tables and takes
+	// precedence over All.
+	All    StorageOptions
+	Tables map[string]StorageOptions
+}
+
+// Resolve applies s over the preset of the driver it names. Options of s
+// take precedence over those of the preset.
+func (s Storage) Resolve(presets map[string]Storage) (Storage, error) {
+	profile := s.Profile
+	if profile == "" {
+		profile = DefaultStorage
+	}
+
+	preset, ok := presets[profile]
+	if !ok {
+		var names []string
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return Storage{}, fmt.Errorf("unknown storage profile %q (available: %s)", profile, strings.Join(names, "|"))
+	}
+
+	r := Storage{
+		Profile: profile,
+		All:     merge(preset.All, s.All),
+		Tables:  make(map[string]StorageOptions),
+	}
+	for table, options := range preset.Tables {
+		r.Tables[table] = merge(options, nil)
+	}
+	for table, options := range s.Tables {
+		r.Tables[table] = merge(r.Tables[table], options)
+	}
+
+	return r, nil
+}
+
+// Check reports options that are not in known and tables that do not exist.
+// Without known any option is accepted.
+func (s Storage) Check(known ...string) error {
+	check := func(options StorageOptions) error {
+		if len(known) == 0 {
+			return nil
+		}
+
+		for name := range options {
+			if !containsString(known, name) {
+				return fmt.Errorf("unknown storage option %q (available: %s)", name, strings.Join(known, "|"))
+			}
+		}
+		return nil
+	}
+
+	if err := check(s.All); err != nil {
+		return err
+	}
+
+	for table, options := range s.Tables {
+		if !containsString(Tables, table) {
+			return fmt.Errorf("unknown table %q in the storage options", table)
+		}
+		if err := check(options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Empty reports whether s sets no option
+func (s Storage) Empty() bool {
+	if len(s.All) > 0 {
+		return false
+	}
+
+	for _, options := range s.Tables {
+		if len(options) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// For returns the options of one table
+func (s Storage) For(table string) StorageOptions {
+	return merge(s.All, s.Tables[table])
+}
+
+// String lists the options as TABLE.option=value, sorted, with * for All
+func (s Storage) String() string {
+	var list []string
+	add := func(table string, options StorageOptions) {
+		for name, value := range options {
+			list = append(list, table+"."+name+"="+value)
+		}
+	}
+
+	add("*", s.All)
+	for table, options := range s.Tables {
+		add(table, options)
+	}
+	sort.Strings(list)
+
+	return strings.Join(list, ",")
+}
+
+func merge(base StorageOptions, over StorageOptions) StorageOptions {
+	r := make(StorageOptions, len(base)+len(over))
+	for name, value := range base {
+		r[name] = value
+	}
+	for name, value := range over {
+		r[name] = value
+	}
+
+	return r
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,61 @@
+package databases
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Tag tells which transaction, method and worker a statement comes from, so
+// it can be found in slow logs, performance_schema, pg_stat_statements or
+// the MongoDB profiler
+type Tag struct {
+	Transaction string
+	Method      string
+	Worker      int
+}
+
+func (t Tag) String() string {
+	s := fmt.Sprintf("go-tpcc trx=%s method=%s worker=%d", t.Transaction, t.Method, t.Worker)
+
+	// the tag ends up in SQL comments, which the drivers may run through
+	// their placeholder substitution
+	return strings.NewReplacer("*/", "", "?", "", "%", "").Replace(s)
+}
+
+type tagKey struct{}
+
+// WithTag returns a context tagging the statements run with it
+func WithTag(ctx context.Context, t Tag) context.Context {
+	return context.WithValue(ctx, tagKey{}, t)
+}
+
+// TagFrom returns the tag of the context, if it has one
+func TagFrom(ctx context.Context) (Tag, bool) {
+	t, ok := ctx.Value(tagKey{}).(Tag)
+	return t, ok
+}
+
+// TagQuery prefixes a SQL statement with the tag of the context as a
+// comment, statements without a tag are returned as they are
+func TagQuery(ctx context.Context, query string) string {
+	t, ok := TagFrom(ctx)
+	if !ok {
+		return query
+	}
+
+	return "/* " + t.String() + " */ " + query
+}
+
+// Tagging returns an interceptor setting the method of the tag of the
+// context, contexts without a tag are left alone
+func Tagging() Interceptor {
+	return func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		if t, ok := TagFrom(ctx); ok {
+			t.Method = method
+			ctx = WithTag(ctx, t)
+		}
+
+		return call(ctx)
+	}
+}
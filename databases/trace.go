@@ -0,0 +1,49 @@
+package databases
+
+import (
+	"context"
+	"time"
+)
+
+// Call is one Database method call timed by a Tracer
+type Call struct {
+	Method string
+	// Time is the duration of the call in milliseconds
+	Time   float64
+	Failed bool
+}
+
+// Tracer times the Database method calls going through its interceptor. A
+// tracer belongs to one worker and is not safe for concurrent use.
+type Tracer struct {
+	calls []Call
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{}
+}
+
+// Interceptor returns the interceptor recording the calls. Calls made with
+// any context are recorded, the rollbacks of failed transactions included.
+func (t *Tracer) Interceptor() Interceptor {
+	return func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		start := time.Now()
+		err := call(ctx)
+
+		t.calls = append(t.calls, Call{
+			Method: method,
+			Time:   float64(time.Since(start).Nanoseconds()) / 1e6,
+			Failed: err != nil,
+		})
+
+		return err
+	}
+}
+
+// Take returns the calls recorded since the last Take
+func (t *Tracer) Take() []Call {
+	calls := t.calls
+	t.calls = nil
+
+	return calls
+}
@@ -1,6 +1,8 @@
 package executor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/Percona-Lab/go-tpcc/databases"
 	"github.com/Percona-Lab/go-tpcc/tpcc/models"
@@ -13,10 +15,18 @@ type Executor struct {
 	db databases.Database
 	retries int
 	transaction bool
+	lastRetries int
 }
 
 const DefaultRetries = 10
 
+// rollbackTimeout bounds the rollback of a failed transaction
+const rollbackTimeout = 10 * time.Second
+
+// ErrInvalidItem is returned by New-Order when an item does not exist. TPC-C
+// uses an unused item number in 1% of New-Order transactions to force a rollback.
+var ErrInvalidItem = errors.New("TPCC defines 1% of neworder gives a wrong itemid, causing rollback. This happens on purpose")
+
 func NewExecutor(db databases.Database, batchSize int) (*Executor, error) {
 
 
@@ -37,14 +47,40 @@ func (e *Executor) ChangeRetries(r int) {
 	e.retries = r
 }
 
+// ChangeTransactions makes the Do*Trx functions run inside of a database transaction
+func (e *Executor) ChangeTransactions(t bool) {
+	e.transaction = t
+}
+
+// LastRetries returns how many times the last Do*Trx call was retried
+func (e *Executor) LastRetries() int {
+	return e.lastRetries
+}
+
+// Classify maps an error returned by the executor to an ErrorClass
+func (e *Executor) Classify(err error) databases.ErrorClass {
+	switch {
+	case err == nil:
+		return databases.ClassNone
+	case errors.Is(err, ErrInvalidItem):
+		return databases.ClassRollback
+	case errors.Is(err, context.DeadlineExceeded):
+		return databases.ClassTimeout
+	case errors.Is(err, context.Canceled):
+		return databases.ClassCanceled
+	}
+
+	return e.db.Classify(err)
+}
+
 // @TODO@
 // Error handling
 
-func (e *Executor) SaveBatch(collectionName string, d interface{}) error {
+func (e *Executor) SaveBatch(ctx context.Context, collectionName string, d interface{}) error {
 	e.data[collectionName] = append(e.data[collectionName], d)
 
 	if len(e.data[collectionName]) % e.batchSize == 0 {
-		err := e.db.InsertBatch(collectionName,e.data[collectionName])
+		err := e.db.InsertBatch(ctx, collectionName,e.data[collectionName])
 		if err != nil {
 			return err
 		}
@@ -54,8 +90,8 @@ func (e *Executor) SaveBatch(collectionName string, d interface{}) error {
 	return nil
 }
 
-func (e *Executor) Flush(collectionName string) error {
-	err := e.db.InsertBatch(collectionName,e.data[collectionName])
+func (e *Executor) Flush(ctx context.Context, collectionName string) error {
+	err := e.db.InsertBatch(ctx, collectionName,e.data[collectionName])
 	if err != nil {
 		return err
 	}
@@ -63,8 +99,8 @@ func (e *Executor) Flush(collectionName string) error {
 	return nil
 }
 
-func (e *Executor) Save(collectionName string, d interface{}) error {
-	err := e.db.InsertOne(collectionName, d)
+func (e *Executor) Save(ctx context.Context, collectionName string, d interface{}) error {
+	err := e.db.InsertOne(ctx, collectionName, d)
 	if err != nil {
 		return err
 	}
@@ -72,58 +108,82 @@ func (e *Executor) Save(collectionName string, d interface{}) error {
 	return nil
 }
 
+// Close closes the database, the executor is not used afterwards
+func (e *Executor) Close(ctx context.Context) error {
+	return e.db.Close(ctx)
+}
 
-func (e *Executor) DoTrxRetries(fn func() error) error {
-	var err error
 
-	retries := e.retries
+// DoTrxRetries runs fn in a transaction and runs it again, up to the
+// configured number of attempts in all, as long as it fails with a retryable
+// error. Without transactions fn runs once, its statements are already committed.
+func (e *Executor) DoTrxRetries(ctx context.Context, fn func() error) error {
+	e.lastRetries = 0
 
 	if ! e.transaction {
-		retries = 1
+		return fn()
 	}
 
+	for {
+		err := e.doTrx(ctx, fn)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
 
-	for i := 0; i < retries; i++ {
-		err = nil
-		if e.transaction {
-			err = e.db.StartTrx()
-			if err != nil {
-				return err
-			}
+		if e.lastRetries+1 >= e.retries || !e.Classify(err).Retryable() {
+			return err
 		}
 
-		err = fn()
+		e.lastRetries++
+	}
+}
 
-		if err != nil {
-			if e.transaction {
-				e := e.db.RollbackTrx()
-				if e != nil {
-					return e
-				}
-			}
-			break
+func (e *Executor) doTrx(ctx context.Context, fn func() error) error {
+	err := e.db.StartTrx(ctx)
+	if err != nil {
+		return err
+	}
+
+	// a panic must not leave the transaction open on the connection
+	defer func() {
+		if r := recover(); r != nil {
+			e.rollback()
+			panic(r)
 		}
+	}()
 
-		if e.transaction {
-			err := e.db.CommitTrx()
-			if err != nil {
-				return err
-			}
+	err = fn()
+	if err != nil {
+		rerr := e.rollback()
+		if rerr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rerr)
 		}
+
+		return err
 	}
 
-	return err
+	return e.db.CommitTrx(ctx)
 }
 
-func (e *Executor) DoStockLevelTrx(warehouseId int, districtId int, threshold int) error {
+// rollback aborts the open transaction. It does not use the context of the
+// transaction, which may be the very reason the transaction failed.
+func (e *Executor) rollback() error {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	return e.db.RollbackTrx(ctx)
+}
+
+func (e *Executor) DoStockLevelTrx(ctx context.Context, warehouseId int, districtId int, threshold int) error {
 	// Do Stock Level never requires a transactions
+	e.lastRetries = 0
 
-	noid, err := e.db.GetNextOrderId(warehouseId, districtId)
+	noid, err := e.db.GetNextOrderId(ctx, warehouseId, districtId)
 	if err != nil {
 		return err
 	}
 
-	_, err = e.db.GetStockCount(noid, noid-20, threshold, warehouseId, districtId)
+	_, err = e.db.GetStockCount(ctx, noid, noid-20, threshold, warehouseId, districtId)
 
 	if err != nil {
 		return err
@@ -133,12 +193,12 @@ func (e *Executor) DoStockLevelTrx(warehouseId int, districtId int, threshold in
 }
 
 
-func (e *Executor) DoDeliveryTrx(wId int, oCarrierId int, olDeliveryD time.Time, dId int) error {
-	return e.DoTrxRetries(func() error {
+func (e *Executor) DoDeliveryTrx(ctx context.Context, wId int, oCarrierId int, olDeliveryD time.Time, dId int) error {
+	return e.DoTrxRetries(ctx, func() error {
 		for i := 1; i <= dId; i++ {
-			err := e.DoDelivery(wId, oCarrierId, olDeliveryD, i)
+			err := e.DoDelivery(ctx, wId, oCarrierId, olDeliveryD, i)
 			if err != nil {
-				panic(err)
+				return err
 			}
 		}
 
@@ -149,40 +209,43 @@ func (e *Executor) DoDeliveryTrx(wId int, oCarrierId int, olDeliveryD time.Time,
 
 //todo the order of arguments here is weird
 // also the dId passed from the worker is probably utterly wrong
-func (e *Executor) DoDelivery(wId int, oCarrierId int, olDeliveryD time.Time, dId int) error {
+func (e *Executor) DoDelivery(ctx context.Context, wId int, oCarrierId int, olDeliveryD time.Time, dId int) error {
 
-	no, err := e.db.GetNewOrder(wId, dId)
+	no, err := e.db.GetNewOrder(ctx, wId, dId)
 	if err != nil {
-		fmt.Println("WID=",wId, " DID=",dId)
+		// the delivery is skipped for a district without new orders (TPC-C 2.7.4.2)
+		if e.db.Classify(err) == databases.ClassNotFound {
+			return nil
+		}
 		return err
 	}
 
-	cid, err := e.db.GetCustomerIdOrder(no.NO_O_ID, wId, dId)
+	cid, err := e.db.GetCustomerIdOrder(ctx, no.NO_O_ID, wId, dId)
 	if err != nil {
 		return err
 	}
 
-	olAmount, err := e.db.SumOLAmount(no.NO_O_ID, wId, dId)
+	olAmount, err := e.db.SumOLAmount(ctx, no.NO_O_ID, wId, dId)
 	if err != nil {
 		return err
 	}
 
-	err = e.db.DeleteNewOrder(no.NO_O_ID, wId, dId)
+	err = e.db.DeleteNewOrder(ctx, no.NO_O_ID, wId, dId)
 	if err != nil {
 		return err
 	}
 
-	_, err = e.db.GetCustomerIdOrder(no.NO_O_ID, wId, dId)
+	_, err = e.db.GetCustomerIdOrder(ctx, no.NO_O_ID, wId, dId)
 	if err != nil {
 		return err
 	}
 
-	err = e.db.UpdateOrders(no.NO_O_ID, wId, dId, oCarrierId, olDeliveryD)
+	err = e.db.UpdateOrders(ctx, no.NO_O_ID, wId, dId, oCarrierId, olDeliveryD)
 	if err != nil {
 		return err
 	}
 
-	err = e.db.UpdateCustomer(cid, wId, dId, olAmount)
+	err = e.db.UpdateCustomer(ctx, cid, wId, dId, olAmount)
 	if err != nil {
 		return err
 	}
@@ -190,21 +253,21 @@ func (e *Executor) DoDelivery(wId int, oCarrierId int, olDeliveryD time.Time, dI
 	return nil
 }
 
-func (e *Executor) DoOrderStatusTrx(warehouseId, districtId, cId int, cLast string) error {
-	return e.DoTrxRetries(func() error {
-		return e.DoOrderStatus(warehouseId, districtId, cId, cLast)
+func (e *Executor) DoOrderStatusTrx(ctx context.Context, warehouseId, districtId, cId int, cLast string) error {
+	return e.DoTrxRetries(ctx, func() error {
+		return e.DoOrderStatus(ctx, warehouseId, districtId, cId, cLast)
 	})
 }
 
-func (e *Executor) DoOrderStatus(warehouseId, districtId, cId int, cLast string) error {
+func (e *Executor) DoOrderStatus(ctx context.Context, warehouseId, districtId, cId int, cLast string) error {
 
 	var err error
 
 	if cId > 0 {
-		_, err = e.db.GetCustomerById(cId, warehouseId, districtId)
+		_, err = e.db.GetCustomerById(ctx, cId, warehouseId, districtId)
 	} else {
 		var customer *models.Customer
-		customer, err = e.db.GetCustomerByName(cLast, warehouseId, districtId)
+		customer, err = e.db.GetCustomerByName(ctx, cLast, warehouseId, districtId)
 		if err != nil {
 			return err
 		}
@@ -216,13 +279,13 @@ func (e *Executor) DoOrderStatus(warehouseId, districtId, cId int, cLast string)
 		return err
 	}
 
-	order, err := e.db.GetLastOrder(cId, warehouseId, districtId)
+	order, err := e.db.GetLastOrder(ctx, cId, warehouseId, districtId)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = e.db.GetOrderLines(order.O_ID, warehouseId, districtId)
+	_, err = e.db.GetOrderLines(ctx, order.O_ID, warehouseId, districtId)
 
 	if err != nil {
 		return err
@@ -231,15 +294,15 @@ func (e *Executor) DoOrderStatus(warehouseId, districtId, cId int, cLast string)
 	return nil
 }
 
-func (e *Executor) DoPaymentTrx(warehouseId, districtId int,
+func (e *Executor) DoPaymentTrx(ctx context.Context, warehouseId, districtId int,
 	amount float64,
 	cWId, cDId, cId int,
 	cLast string,
 	hDate time.Time,
 	badCredit string,
 	cdatalen int) error {
-	return e.DoTrxRetries(func() error {
-		return e.DoPayment(warehouseId, districtId,
+	return e.DoTrxRetries(ctx, func() error {
+		return e.DoPayment(ctx, warehouseId, districtId,
 			amount,
 			cWId, cDId, cId,
 			cLast,
@@ -250,6 +313,7 @@ func (e *Executor) DoPaymentTrx(warehouseId, districtId int,
 }
 
 func (e *Executor) DoPayment(
+	ctx context.Context,
 	warehouseId, districtId int,
 	amount float64,
 	cWId, cDId, cId int,
@@ -258,38 +322,37 @@ func (e *Executor) DoPayment(
 	badCredit string,
 	cdatalen int,
 ) error {
-	warehouse, err := e.db.GetWarehouse(warehouseId)
+	warehouse, err := e.db.GetWarehouse(ctx, warehouseId)
 
 	if err != nil {
 		return err
 	}
 
-	err = e.db.UpdateWarehouseBalance(warehouseId, amount)
+	err = e.db.UpdateWarehouseBalance(ctx, warehouseId, amount)
 
 	if err != nil {
 		return err
 	}
 
-	district, err := e.db.GetDistrict(warehouseId, districtId)
+	district, err := e.db.GetDistrict(ctx, warehouseId, districtId)
 
 	if err != nil {
-		fmt.Println(warehouseId, districtId)
 		return err
 	}
 
-	err = e.db.UpdateDistrictBalance(warehouseId, districtId, amount)
+	err = e.db.UpdateDistrictBalance(ctx, warehouseId, districtId, amount)
 
 	if err != nil {
 		return err
 	}
 	var customer *models.Customer
 	if cId > 0 {
-		customer, err = e.db.GetCustomerById(cId, warehouseId, districtId)
+		customer, err = e.db.GetCustomerById(ctx, cId, warehouseId, districtId)
 		if err != nil {
 			return err
 		}
 	} else {
-		customer, err = e.db.GetCustomerByName(cLast, warehouseId, districtId)
+		customer, err = e.db.GetCustomerByName(ctx, cLast, warehouseId, districtId)
 		if err != nil {
 			return err
 		}
@@ -307,14 +370,17 @@ func (e *Executor) DoPayment(
 		var buf string
 
 		buf = fmt.Sprintf("%v %v %v %v %v %v|%v", cId, cDId, cWId, districtId, warehouseId, amount, customer.C_DATA)
-		err = e.db.UpdateCredit(cId, warehouseId, districtId, amount, buf[:cdatalen])
+		if len(buf) > cdatalen {
+			buf = buf[:cdatalen]
+		}
+		err = e.db.UpdateCredit(ctx, cId, warehouseId, districtId, amount, buf)
 
 		if err != nil {
 			return err
 		}
 
 	} else {
-		err = e.db.UpdateCredit(cId, warehouseId, districtId, amount, "")
+		err = e.db.UpdateCredit(ctx, cId, warehouseId, districtId, amount, "")
 
 		if err != nil {
 			return err
@@ -323,42 +389,40 @@ func (e *Executor) DoPayment(
 
 	hData := fmt.Sprintf("%v    %v", warehouse.W_NAME, district.D_NAME)
 
-	err = e.db.InsertHistory(warehouseId, districtId, time.Now(), amount, hData)
+	err = e.db.InsertHistory(ctx, warehouseId, districtId, time.Now(), amount, hData)
 
 	if err != nil {
-		panic(err)
-		panic("here")
 		return err
 	}
 
 	return nil
 }
 
-func (e *Executor) DoNewOrderTrx(wId, dId, cId int, oEntryD time.Time, iIds []int, iWids []int, iQtys []int) error {
-	return e.DoTrxRetries(func() error {
-		return e.DoNewOrder(wId, dId, cId, oEntryD, iIds, iWids, iQtys)
+func (e *Executor) DoNewOrderTrx(ctx context.Context, wId, dId, cId int, oEntryD time.Time, iIds []int, iWids []int, iQtys []int) error {
+	return e.DoTrxRetries(ctx, func() error {
+		return e.DoNewOrder(ctx, wId, dId, cId, oEntryD, iIds, iWids, iQtys)
 	})
 }
 
-func (e *Executor) DoNewOrder(wId, dId, cId int, oEntryD time.Time, iIds []int, iWids []int, iQtys []int) error {
+func (e *Executor) DoNewOrder(ctx context.Context, wId, dId, cId int, oEntryD time.Time, iIds []int, iWids []int, iQtys []int) error {
 	var err error
 
-	_, err = e.db.GetWarehouse(wId)
+	_, err = e.db.GetWarehouse(ctx, wId)
 	if err != nil {
 		return err
 	}
 
-	district, err := e.db.GetDistrict(wId, dId)
+	district, err := e.db.GetDistrict(ctx, wId, dId)
 	if err != nil {
 		return err
 	}
 
-	err = e.db.IncrementDistrictOrderId(wId, dId)
+	err = e.db.IncrementDistrictOrderId(ctx, wId, dId)
 	if err != nil {
 		return err
 	}
 
-	_, err = e.db.GetCustomer(cId, wId, dId)
+	_, err = e.db.GetCustomer(ctx, cId, wId, dId)
 	if err != nil {
 		return err
 	}
@@ -372,17 +436,17 @@ func (e *Executor) DoNewOrder(wId, dId, cId int, oEntryD time.Time, iIds []int,
 		}
 	}
 
-	items, err := e.db.GetItems(iIds)
+	items, err := e.db.GetItems(ctx, iIds)
 	if err != nil {
 		return err
 	}
 
 	if len(*items) != len(iIds) {
-		return fmt.Errorf("TPCC defines 1%% of neworder gives a wrong itemid, causing rollback. This happens on purpose")
+		return ErrInvalidItem
 	}
 
 
-	stocks, err := e.db.GetStockInfo(dId, iIds, iWids, allLocal)
+	stocks, err := e.db.GetStockInfo(ctx, dId, iIds, iWids, allLocal)
 	if err != nil {
 		return err
 	}
@@ -404,7 +468,7 @@ func (e *Executor) DoNewOrder(wId, dId, cId int, oEntryD time.Time, iIds []int,
 		}
 
 		if iWids[i] != wId {
-			err = e.db.UpdateStock(
+			err = e.db.UpdateStock(ctx, 
 				(*stocks)[i].S_I_ID,
 				iWids[1],
 				sQuantity,
@@ -430,7 +494,7 @@ func (e *Executor) DoNewOrder(wId, dId, cId int, oEntryD time.Time, iIds []int,
 		})
 	}
 
-	err = e.db.CreateOrder(district.D_NEXT_O_ID, cId, wId, dId, 0, len(iIds), allLocal, oEntryD, orderLines)
+	err = e.db.CreateOrder(ctx, district.D_NEXT_O_ID, cId, wId, dId, 0, len(iIds), allLocal, oEntryD, orderLines)
 	if err != nil {
 		return err
 	}
@@ -438,12 +502,40 @@ func (e *Executor) DoNewOrder(wId, dId, cId int, oEntryD time.Time, iIds []int,
 	return nil
 }
 
-func (e *Executor) CreateIndexes() error {
-	return e.db.CreateIndexes()
+func (e *Executor) Indexes() []databases.Index {
+	return e.db.Indexes()
+}
+
+func (e *Executor) CreateIndex(ctx context.Context, index databases.Index, online bool) error {
+	return e.db.CreateIndex(ctx, index, online)
+}
+
+func (e *Executor) CreateSchema(ctx context.Context) error {
+	return e.db.CreateSchema(ctx)
+}
+
+func (e *Executor) DropSchema(ctx context.Context) error {
+	return e.db.DropSchema(ctx)
+}
+
+func (e *Executor) TruncateSchema(ctx context.Context) error {
+	return e.db.TruncateSchema(ctx)
+}
+
+func (e *Executor) CountRows(ctx context.Context, table string, warehouseId int) (int64, error) {
+	return e.db.CountRows(ctx, table, warehouseId)
+}
+
+func (e *Executor) SumOrderLineCounts(ctx context.Context, warehouseId int) (int64, error) {
+	return e.db.SumOrderLineCounts(ctx, warehouseId)
+}
+
+func (e *Executor) SaveMetadata(ctx context.Context, metadata map[string]string) error {
+	return e.db.SaveMetadata(ctx, metadata)
 }
 
-func (e *Executor) CreateSchema() error {
-	return e.db.CreateSchema()
+func (e *Executor) LoadMetadata(ctx context.Context) (map[string]string, error) {
+	return e.db.LoadMetadata(ctx)
 }
 
 func distCol(dId int, stock *models.Stock) string {
@@ -0,0 +1,281 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"github.com/Percona-Lab/go-tpcc/databases/memory"
+	"github.com/Percona-Lab/go-tpcc/tpcc/models"
+)
+
+// newTestExecutor returns an executor on a memory database of its own
+// holding one warehouse, see seed
+func newTestExecutor(t *testing.T) (*Executor, *memory.Memory) {
+	t.Helper()
+
+	name := t.Name()
+	memory.Drop(name)
+	t.Cleanup(func() { memory.Drop(name) })
+
+	db, err := memory.NewMemory(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewExecutor(db, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seed(t, e)
+
+	return e, db
+}
+
+// seed loads warehouse 1 with districts 1 and 2, customer 1 of district 1,
+// items 1 to 3 in stock, the delivered order 1 and the new order 2 of
+// customer 1. District 2 has no orders.
+func seed(t *testing.T, e *Executor) {
+	t.Helper()
+
+	ctx := context.Background()
+	entry := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := []interface{}{
+		models.Warehouse{W_ID: 1, W_NAME: "w1", W_YTD: 300000},
+		models.District{D_ID: 1, D_W_ID: 1, D_NAME: "d1", D_YTD: 30000, D_NEXT_O_ID: 3},
+		models.District{D_ID: 2, D_W_ID: 1, D_NAME: "d2", D_YTD: 30000, D_NEXT_O_ID: 1},
+		models.Customer{C_ID: 1, C_D_ID: 1, C_W_ID: 1, C_LAST: "BARBARBAR", C_CREDIT: "GC", C_BALANCE: -10, C_YTD_PAYMENT: 10, C_PAYMENT_CNT: 1},
+		models.Item{I_ID: 1, I_NAME: "i1", I_PRICE: 1.5},
+		models.Item{I_ID: 2, I_NAME: "i2", I_PRICE: 2},
+		models.Item{I_ID: 3, I_NAME: "i3", I_PRICE: 10},
+		models.Order{O_ID: 1, O_C_ID: 1, O_D_ID: 1, O_W_ID: 1, O_ENTRY_D: entry, O_CARRIER_ID: 5, O_OL_CNT: 1, O_ALL_LOCAL: 1},
+		models.OrderLine{OL_O_ID: 1, OL_D_ID: 1, OL_W_ID: 1, OL_NUMBER: 1, OL_I_ID: 1, OL_SUPPLY_W_ID: 1, OL_DELIVERY_D: entry, OL_QUANTITY: 5, OL_AMOUNT: 7.5},
+		models.Order{O_ID: 2, O_C_ID: 1, O_D_ID: 1, O_W_ID: 1, O_ENTRY_D: entry, O_OL_CNT: 2, O_ALL_LOCAL: 1},
+		models.OrderLine{OL_O_ID: 2, OL_D_ID: 1, OL_W_ID: 1, OL_NUMBER: 1, OL_I_ID: 2, OL_SUPPLY_W_ID: 1, OL_QUANTITY: 2, OL_AMOUNT: 4},
+		models.OrderLine{OL_O_ID: 2, OL_D_ID: 1, OL_W_ID: 1, OL_NUMBER: 2, OL_I_ID: 3, OL_SUPPLY_W_ID: 1, OL_QUANTITY: 1, OL_AMOUNT: 10},
+		models.NewOrder{NO_O_ID: 2, NO_D_ID: 1, NO_W_ID: 1},
+	}
+	for i := 1; i <= 3; i++ {
+		rows = append(rows, models.Stock{S_I_ID: i, S_W_ID: 1, S_QUANTITY: 50, S_DIST_01: "dist-01", S_DIST_02: "dist-02"})
+	}
+
+	for _, row := range rows {
+		if err := e.Save(ctx, reflect.TypeOf(row).Name(), row); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDoNewOrder(t *testing.T) {
+	e, db := newTestExecutor(t)
+	entry := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	err := e.DoNewOrder(context.Background(), 1, 1, 1, entry, []int{1, 3}, []int{1, 1}, []int{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Snapshot()
+	if got := s.Districts[0].D_NEXT_O_ID; got != 4 {
+		t.Errorf("D_NEXT_O_ID = %d, want 4", got)
+	}
+
+	want := models.Order{O_ID: 3, O_C_ID: 1, O_D_ID: 1, O_W_ID: 1, O_ENTRY_D: entry, O_OL_CNT: 2, O_ALL_LOCAL: 1}
+	if len(s.Orders) != 3 || !reflect.DeepEqual(s.Orders[2], want) {
+		t.Errorf("orders = %+v, want the last to be %+v", s.Orders, want)
+	}
+
+	if len(s.NewOrders) != 2 || s.NewOrders[1] != (models.NewOrder{NO_O_ID: 3, NO_D_ID: 1, NO_W_ID: 1}) {
+		t.Errorf("new orders = %+v, want order 3 added", s.NewOrders)
+	}
+
+	var amounts []float64
+	for _, ol := range s.OrderLines {
+		if ol.OL_O_ID == 3 {
+			amounts = append(amounts, ol.OL_AMOUNT)
+		}
+	}
+	if !reflect.DeepEqual(amounts, []float64{3, 10}) {
+		t.Errorf("order line amounts = %v, want [3 10]", amounts)
+	}
+}
+
+func TestDoNewOrderInvalidItem(t *testing.T) {
+	e, db := newTestExecutor(t)
+
+	err := e.DoNewOrder(context.Background(), 1, 1, 1, time.Now(), []int{1, 99}, []int{1, 1}, []int{2, 1})
+	if !errors.Is(err, ErrInvalidItem) {
+		t.Fatalf("err = %v, want ErrInvalidItem", err)
+	}
+	if class := e.Classify(err); class != databases.ClassRollback {
+		t.Errorf("class = %s, want %s", class, databases.ClassRollback)
+	}
+
+	s := db.Snapshot()
+	if len(s.Orders) != 2 || len(s.NewOrders) != 1 {
+		t.Errorf("orders = %+v, new orders = %+v, want no order added", s.Orders, s.NewOrders)
+	}
+}
+
+func TestDoNewOrderTrxInvalidItem(t *testing.T) {
+	e, db := newTestExecutor(t)
+	e.ChangeTransactions(true)
+	before := db.Snapshot()
+
+	err := e.DoNewOrderTrx(context.Background(), 1, 1, 1, time.Now(), []int{1, 99}, []int{1, 1}, []int{2, 1})
+	if !errors.Is(err, ErrInvalidItem) {
+		t.Fatalf("err = %v, want ErrInvalidItem", err)
+	}
+
+	// the order id taken before the items were checked is given back
+	if after := db.Snapshot(); !reflect.DeepEqual(before, after) {
+		t.Errorf("the rolled back transaction changed the database:\n%+v\n%+v", before, after)
+	}
+}
+
+func TestDoPayment(t *testing.T) {
+	e, db := newTestExecutor(t)
+
+	err := e.DoPayment(context.Background(), 1, 1, 25, 1, 1, 1, "", time.Now(), "BC", 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Snapshot()
+	if got := s.Warehouses[0].W_YTD; got != 300025 {
+		t.Errorf("W_YTD = %v, want 300025", got)
+	}
+	if got := s.Districts[0].D_YTD; got != 30025 {
+		t.Errorf("D_YTD = %v, want 30025", got)
+	}
+
+	c := s.Customers[0]
+	if c.C_BALANCE != -35 || c.C_YTD_PAYMENT != 35 || c.C_PAYMENT_CNT != 2 {
+		t.Errorf("customer balance, payments and count = %v %v %d, want -35 35 2", c.C_BALANCE, c.C_YTD_PAYMENT, c.C_PAYMENT_CNT)
+	}
+
+	if len(s.History) != 1 || s.History[0].H_AMOUNT != 25 || s.History[0].H_DATA != "w1    d1" {
+		t.Errorf("history = %+v, want one payment of 25", s.History)
+	}
+}
+
+func TestDoPaymentBadCredit(t *testing.T) {
+	e, db := newTestExecutor(t)
+
+	// the customer data is shorter than the limit
+	err := e.DoPayment(context.Background(), 1, 1, 25, 1, 1, 1, "", time.Now(), "GC", 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := db.Snapshot().Customers[0]
+	if c.C_BALANCE != -35 {
+		t.Errorf("C_BALANCE = %v, want -35", c.C_BALANCE)
+	}
+	if want := "1 1 1 1 1 25|"; c.C_DATA != want {
+		t.Errorf("C_DATA = %q, want %q", c.C_DATA, want)
+	}
+}
+
+func TestDoDelivery(t *testing.T) {
+	e, db := newTestExecutor(t)
+	delivery := time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	err := e.DoDelivery(context.Background(), 1, 7, delivery, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Snapshot()
+	if len(s.NewOrders) != 0 {
+		t.Errorf("new orders = %+v, want none", s.NewOrders)
+	}
+	if got := s.Orders[1].O_CARRIER_ID; got != 7 {
+		t.Errorf("O_CARRIER_ID = %d, want 7", got)
+	}
+	for _, ol := range s.OrderLines {
+		if ol.OL_O_ID == 2 && !ol.OL_DELIVERY_D.Equal(delivery) {
+			t.Errorf("OL_DELIVERY_D of line %d = %v, want %v", ol.OL_NUMBER, ol.OL_DELIVERY_D, delivery)
+		}
+	}
+	if got := s.Customers[0].C_BALANCE; got != 4 {
+		t.Errorf("C_BALANCE = %v, want 4", got)
+	}
+}
+
+func TestDoDeliveryTrx(t *testing.T) {
+	e, db := newTestExecutor(t)
+	e.ChangeTransactions(true)
+
+	// district 2 has no new order and is skipped
+	err := e.DoDeliveryTrx(context.Background(), 1, 7, time.Now(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := db.Snapshot()
+	if len(s.NewOrders) != 0 {
+		t.Errorf("new orders = %+v, want none", s.NewOrders)
+	}
+	if got := s.Customers[0].C_BALANCE; got != 4 {
+		t.Errorf("C_BALANCE = %v, want 4", got)
+	}
+}
+
+func TestDoTrxRetries(t *testing.T) {
+	conflict := &databases.FaultError{Method: "test", Fault: "conflict", Class: databases.ClassConflict}
+	other := errors.New("other")
+
+	tests := []struct {
+		name         string
+		transactions bool
+		// errs are returned by the attempts in turn, nil once they run out
+		errs        []error
+		wantErr     error
+		wantCalls   int
+		wantRetries int
+	}{
+		{"success", true, nil, nil, 1, 0},
+		{"conflicts", true, []error{conflict, conflict}, nil, 3, 2},
+		{"attempts exhausted", true, []error{conflict, conflict, conflict, conflict}, conflict, 3, 2},
+		{"not retryable", true, []error{other}, other, 1, 0},
+		// the statements before the error are committed already
+		{"no transactions", false, []error{conflict}, conflict, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, db := newTestExecutor(t)
+			// the interceptor classifies the injected conflict
+			e.db = databases.Intercept(db, func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+				return call(ctx)
+			})
+			e.ChangeTransactions(tt.transactions)
+			e.ChangeRetries(3)
+
+			calls := 0
+			err := e.DoTrxRetries(context.Background(), func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+
+			if err != tt.wantErr {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if got := e.LastRetries(); got != tt.wantRetries {
+				t.Errorf("LastRetries() = %d, want %d", got, tt.wantRetries)
+			}
+		})
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"time"
 )
 
-func randomString(length int, charset string) string {
+// the source is seeded once, seeding it again gives a reproducible sequence
+func init() {
 	rand.Seed(time.Now().UnixNano())
+}
 
+func randomString(length int, charset string) string {
 	b := make([]byte, length)
 	for i := range b {
 		b[i] = charset[rand.Intn(len(charset))]
@@ -24,14 +27,10 @@ func RandNumericString(length int) string {
 	return randomString(length, "01234567890")
 }
 func RandInt(minimum int, maximum int) int {
-	rand.Seed(time.Now().UnixNano())
-
 	return rand.Intn(maximum - minimum + 1) + minimum
 }
 
 func RandIntExcluding(minimum int, maximum int, excluding int) int {
-	rand.Seed(time.Now().UnixNano())
-
 	n := RandInt(minimum, maximum-1)
 	if n >= excluding {
 		n += 1
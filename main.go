@@ -14,7 +14,16 @@
 
 package main
 
-import "github.com/Percona-Lab/go-tpcc/cmd"
+import (
+	"github.com/Percona-Lab/go-tpcc/cmd"
+
+	// Database drivers register themselves in databases.Register, out-of-tree
+	// drivers are enabled the same way by importing their package here.
+	_ "github.com/Percona-Lab/go-tpcc/databases/memory"
+	_ "github.com/Percona-Lab/go-tpcc/databases/mongodb"
+	_ "github.com/Percona-Lab/go-tpcc/databases/mysql"
+	_ "github.com/Percona-Lab/go-tpcc/databases/postgresql"
+)
 
 func main() {
 	cmd.Execute()
@@ -0,0 +1,111 @@
+package tpcc
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Arrivals schedules the transactions of an open-loop run. It generates
+// the intended start times at a fixed rate, independently of how fast the
+// database answers, and the workers take the due ones in order. When the
+// database stalls the due transactions queue up, and measuring from the
+// intended start makes that queuing part of the latency instead of hiding
+// it (coordinated omission).
+type Arrivals struct {
+	mu      sync.Mutex
+	rate    float64
+	poisson bool
+	rnd     *rand.Rand
+	// next is the first arrival that is not due yet
+	next time.Time
+	// due are the arrivals whose time has come but were not started yet
+	due []time.Time
+}
+
+// NewArrivals returns a schedule of rate transactions per second starting
+// now. Arrivals are either "poisson", with exponentially distributed gaps,
+// or "constant".
+func NewArrivals(rate float64, distribution string) (*Arrivals, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("rate must be positive, got %v", rate)
+	}
+
+	a := &Arrivals{
+		rate: rate,
+		rnd:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	switch distribution {
+	case "poisson":
+		a.poisson = true
+	case "constant":
+	default:
+		return nil, fmt.Errorf("unknown arrival distribution %q, use poisson|constant", distribution)
+	}
+
+	a.next = time.Now().Add(a.gap())
+
+	return a, nil
+}
+
+func (a *Arrivals) gap() time.Duration {
+	mean := float64(time.Second) / a.rate
+	if a.poisson {
+		return time.Duration(a.rnd.ExpFloat64() * mean)
+	}
+
+	return time.Duration(mean)
+}
+
+// catchUp moves the arrivals up to now to the due queue, a.mu must be held
+func (a *Arrivals) catchUp(now time.Time) {
+	for !a.next.After(now) {
+		a.due = append(a.due, a.next)
+		a.next = a.next.Add(a.gap())
+	}
+}
+
+// Next waits for the next due transaction and returns its intended start
+func (a *Arrivals) Next(ctx context.Context) (time.Time, error) {
+	for {
+		a.mu.Lock()
+		now := time.Now()
+		a.catchUp(now)
+
+		if len(a.due) > 0 {
+			t := a.due[0]
+			a.due = a.due[1:]
+			a.mu.Unlock()
+			return t, nil
+		}
+
+		wait := a.next.Sub(now)
+		a.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return time.Time{}, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Backlog is the number of due transactions no worker has started yet
+func (a *Arrivals) Backlog() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.catchUp(time.Now())
+
+	return len(a.due)
+}
+
+// Rate is the target rate in transactions per second
+func (a *Arrivals) Rate() float64 {
+	return a.rate
+}
@@ -17,9 +17,9 @@ func (w *Worker) LoadItems() {
 				break
 			}
 		}
-		w.ex.SaveBatch(TABLENAME_ITEM, w.GenerateItem(i, isOriginalRow))
+		w.ex.SaveBatch(w.ctx, TABLENAME_ITEM, w.GenerateItem(i, isOriginalRow))
 	}
-	w.ex.Flush(TABLENAME_ITEM)
+	w.ex.Flush(w.ctx, TABLENAME_ITEM)
 }
 func (w *Worker) GenerateItem(id int, isOriginalRow bool) models.Item {
 
@@ -0,0 +1,95 @@
+package tpcc
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Percona-Lab/go-tpcc/databases"
+)
+
+// The keys of the dataset metadata, named after the options of prepare
+const (
+	MetadataWarehouses = "warehouses"
+	MetadataItems      = "items"
+	MetadataDistricts  = "districts"
+	MetadataCustomers  = "customers"
+	MetadataOrders     = "orders"
+	MetadataNewOrders  = "new-orders"
+	// the storage profile and the options set over it
+	MetadataStorageProfile = "storage-profile"
+	MetadataStorage        = "storage"
+)
+
+// SaveMetadata stores the cardinalities and the storage of the dataset with
+// it, so later runs do not depend on being given the same options as prepare
+func (w *Worker) SaveMetadata() error {
+	metadata := w.sc.Metadata()
+
+	profile := w.cfg.Storage.Profile
+	if profile == "" {
+		profile = databases.DefaultStorage
+	}
+	metadata[MetadataStorageProfile] = profile
+	metadata[MetadataStorage] = w.cfg.Storage.String()
+
+	return w.ex.SaveMetadata(w.ctx, metadata)
+}
+
+// LoadMetadata returns the cardinalities stored by SaveMetadata, or nil for
+// a dataset without them
+func (w *Worker) LoadMetadata() (*ScaleParameters, error) {
+	metadata, err := w.ex.LoadMetadata(w.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+
+	return ParseMetadata(metadata)
+}
+
+// Metadata is s as dataset metadata
+func (s *ScaleParameters) Metadata() map[string]string {
+	return map[string]string{
+		MetadataWarehouses: strconv.Itoa(s.Warehouses),
+		MetadataItems:      strconv.Itoa(s.Items),
+		MetadataDistricts:  strconv.Itoa(s.DistrictsPerWarehouse),
+		MetadataCustomers:  strconv.Itoa(s.CustomersPerDistrict),
+		MetadataOrders:     strconv.Itoa(s.OrdersPerDistrict),
+		MetadataNewOrders:  strconv.Itoa(s.NewOrdersPerDistrict),
+	}
+}
+
+// ParseMetadata is the reverse of Metadata
+func ParseMetadata(metadata map[string]string) (*ScaleParameters, error) {
+	s := &ScaleParameters{}
+
+	fields := []struct {
+		key   string
+		value *int
+	}{
+		{MetadataWarehouses, &s.Warehouses},
+		{MetadataItems, &s.Items},
+		{MetadataDistricts, &s.DistrictsPerWarehouse},
+		{MetadataCustomers, &s.CustomersPerDistrict},
+		{MetadataOrders, &s.OrdersPerDistrict},
+		{MetadataNewOrders, &s.NewOrdersPerDistrict},
+	}
+
+	for _, f := range fields {
+		v, ok := metadata[f.key]
+		if !ok {
+			return nil, fmt.Errorf("dataset metadata has no %s", f.key)
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q in the dataset metadata", f.key, v)
+		}
+		*f.value = n
+	}
+
+	return s, s.Validate()
+}
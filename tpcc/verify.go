@@ -0,0 +1,80 @@
+package tpcc
+
+import "fmt"
+
+// Mismatch is a table whose row count differs from the TPC-C cardinality
+type Mismatch struct {
+	Table string
+	// Warehouse is 0 for the counts over all warehouses
+	Warehouse int
+	Expected  int64
+	Actual    int64
+}
+
+func (m Mismatch) String() string {
+	if m.Warehouse == 0 {
+		return fmt.Sprintf("%s: expected %d rows, found %d", m.Table, m.Expected, m.Actual)
+	}
+
+	return fmt.Sprintf("%s of warehouse %d: expected %d rows, found %d", m.Table, m.Warehouse, m.Expected, m.Actual)
+}
+
+type cardinality struct {
+	table    string
+	expected int64
+}
+
+// VerifyTables checks the tables that are not split by warehouse and that
+// there are no more warehouses than configured
+func (w *Worker) VerifyTables() ([]Mismatch, error) {
+	return w.verify(0, []cardinality{
+		{TABLENAME_ITEM, int64(w.sc.Items)},
+		{TABLENAME_WAREHOUSE, int64(w.sc.Warehouses)},
+	})
+}
+
+// VerifyWarehouse checks the row counts of one warehouse as loaded by
+// LoadWarehouse. Order lines are random, 5 to 15 per order, so they are
+// checked against O_OL_CNT of the orders.
+func (w *Worker) VerifyWarehouse(id int) ([]Mismatch, error) {
+	districts := int64(w.sc.DistrictsPerWarehouse)
+	customers := districts * int64(w.sc.CustomersPerDistrict)
+
+	orderLines, err := w.ex.SumOrderLineCounts(w.ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.verify(id, []cardinality{
+		{TABLENAME_WAREHOUSE, 1},
+		{TABLENAME_DISTRICT, districts},
+		{TABLENAME_CUSTOMER, customers},
+		{TABLENAME_HISTORY, customers},
+		{TABLENAME_ORDERS, districts * int64(w.sc.OrdersPerDistrict)},
+		{TABLENAME_NEW_ORDER, districts * int64(w.sc.NewOrdersPerDistrict)},
+		{TABLENAME_ORDER_LINE, orderLines},
+		{TABLENAME_STOCK, int64(w.sc.Items)},
+	})
+}
+
+func (w *Worker) verify(warehouseId int, expected []cardinality) ([]Mismatch, error) {
+	var mismatches []Mismatch
+
+	for _, c := range expected {
+		n, err := w.ex.CountRows(w.ctx, c.table, warehouseId)
+		if err != nil {
+			return nil, fmt.Errorf("counting %s: %w", c.table, err)
+		}
+
+		if n != c.expected {
+			mismatches = append(mismatches, Mismatch{
+				Table:     c.table,
+				Warehouse: warehouseId,
+				Expected:  c.expected,
+				Actual:    n,
+			})
+		}
+	}
+
+	return mismatches, nil
+}
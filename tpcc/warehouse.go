@@ -4,7 +4,6 @@ import (
 	"github.com/Percona-Lab/go-tpcc/tpcc/models"
 	"math/rand"
 	"github.com/Percona-Lab/go-tpcc/helpers"
-	"time"
 )
 
 
@@ -27,14 +26,17 @@ func (w *Worker) GenerateWarehouse(id int) models.Warehouse {
 func (w *Worker) LoadWarehouse(id int) error {
 	var err error
 	warehouse := w.GenerateWarehouse(id)
-	err = w.ex.Save(TABLENAME_WAREHOUSE, warehouse)
+	err = w.ex.Save(w.ctx, TABLENAME_WAREHOUSE, warehouse)
 	if err != nil {
 		return err
 	}
 
-	for i := 1; i <= w.sc.DistrictsPerWarehouse+1; i++ {
-		district := w.generateDistrict(i, id, w.sc.CustomersPerDistrict+1)
-		w.ex.Save(TABLENAME_DISTRICT, district)
+	for i := 1; i <= w.sc.DistrictsPerWarehouse; i++ {
+		district := w.generateDistrict(i, id, w.sc.OrdersPerDistrict+1)
+		err = w.ex.Save(w.ctx, TABLENAME_DISTRICT, district)
+		if err != nil {
+			return err
+		}
 		badCredits := helpers.SelectUniqueIds(w.sc.CustomersPerDistrict/10, 1, w.sc.CustomersPerDistrict)
 
 		var customersId []int
@@ -53,41 +55,42 @@ func (w *Worker) LoadWarehouse(id int) error {
 			}
 
 			customersId = append(customersId, c)
-			err = w.ex.SaveBatch(TABLENAME_CUSTOMER, w.generateCustomer(c, id, i, isBadCredit))
+			err = w.ex.SaveBatch(w.ctx, TABLENAME_CUSTOMER, w.generateCustomer(c, id, i, isBadCredit))
 			if err != nil {
 				return err
 			}
 
-			err = w.ex.SaveBatch(TABLENAME_HISTORY, w.generateHistory(id, i, c))
+			err = w.ex.SaveBatch(w.ctx, TABLENAME_HISTORY, w.generateHistory(id, i, c))
 			if err != nil {
 				return err
 			}
 		}
 
-		err = w.ex.Flush(TABLENAME_CUSTOMER)
+		err = w.ex.Flush(w.ctx, TABLENAME_CUSTOMER)
 		if err != nil {
 			return err
 		}
-		err = w.ex.Flush(TABLENAME_HISTORY)
+		err = w.ex.Flush(w.ctx, TABLENAME_HISTORY)
 		if err != nil {
 			return err
 		}
 
-		rand.Seed(time.Now().UnixNano())
 		rand.Shuffle(len(customersId), func(i, j int) { customersId[i], customersId[j] = customersId[j], customersId[i] })
-		for c := 1; c < w.sc.CustomersPerDistrict+1; c++ {
+		// the customers place the orders in random order, taking turns when
+		// there are more orders than customers
+		for c := 1; c < w.sc.OrdersPerDistrict+1; c++ {
 			orderCount := helpers.RandInt(MIN_OL_CNT, MAX_OL_CNT)
 
 			isNewOrder := false
-			if w.sc.CustomersPerDistrict - w.sc.NewOrdersPerDistrict < c {
+			if w.sc.OrdersPerDistrict - w.sc.NewOrdersPerDistrict < c {
 				isNewOrder = true
-				err = w.ex.SaveBatch(TABLENAME_NEW_ORDER, w.generateNewOrder(id, i, c))
+				err = w.ex.SaveBatch(w.ctx, TABLENAME_NEW_ORDER, w.generateNewOrder(id, i, c))
 				if err != nil {
 					return err
 				}
 			}
 
-			order := w.generateOrder(id, i, c, customersId[c-1], orderCount, isNewOrder)
+			order := w.generateOrder(id, i, c, customersId[(c-1)%len(customersId)], orderCount, isNewOrder)
 			if w.denormalized {
 				for o := 0; o < orderCount; o++ {
 					//@TODO@
@@ -96,22 +99,22 @@ func (w *Worker) LoadWarehouse(id int) error {
 					//orderLines = append(orderLines, )
 					order.ORDER_LINE = append(order.ORDER_LINE, w.generateOrderLine(id, i, c, o, w.sc.Items, isNewOrder))
 				}
-				err = w.ex.SaveBatch(TABLENAME_ORDERS, order)
+				err = w.ex.SaveBatch(w.ctx, TABLENAME_ORDERS, order)
 				if err != nil {
 					return err
 				}
 			} else {
-				err = w.ex.SaveBatch(TABLENAME_ORDERS, order)
+				err = w.ex.SaveBatch(w.ctx, TABLENAME_ORDERS, order)
 				if err != nil {
 					return err
 				}
 				for o := 0; o < orderCount; o++ {
-					err = w.ex.SaveBatch(TABLENAME_ORDER_LINE, w.generateOrderLine(id, i, c, o, w.sc.Items, isNewOrder))
+					err = w.ex.SaveBatch(w.ctx, TABLENAME_ORDER_LINE, w.generateOrderLine(id, i, c, o, w.sc.Items, isNewOrder))
 					if err != nil {
 						return err
 					}
 				}
-				err = w.ex.Flush(TABLENAME_ORDER_LINE)
+				err = w.ex.Flush(w.ctx, TABLENAME_ORDER_LINE)
 				if err != nil {
 					return err
 				}
@@ -121,11 +124,11 @@ func (w *Worker) LoadWarehouse(id int) error {
 
 		}
 
-		err = w.ex.Flush(TABLENAME_ORDERS)
+		err = w.ex.Flush(w.ctx, TABLENAME_ORDERS)
 		if err != nil {
 			return err
 		}
-		err = w.ex.Flush(TABLENAME_NEW_ORDER)
+		err = w.ex.Flush(w.ctx, TABLENAME_NEW_ORDER)
 		if err != nil {
 			return err
 		}
@@ -142,13 +145,13 @@ func (w *Worker) LoadWarehouse(id int) error {
 			}
 		}
 
-		err = w.ex.SaveBatch(TABLENAME_STOCK, w.generateStock(id, i, isOriginal))
+		err = w.ex.SaveBatch(w.ctx, TABLENAME_STOCK, w.generateStock(id, i, isOriginal))
 		if err != nil {
 			return err
 		}
 	}
 
-	err = w.ex.Flush(TABLENAME_STOCK)
+	err = w.ex.Flush(w.ctx, TABLENAME_STOCK)
 	if err != nil {
 		return err
 	}
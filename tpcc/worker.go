@@ -2,11 +2,14 @@ package tpcc
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/Percona-Lab/go-tpcc/databases"
 	"github.com/Percona-Lab/go-tpcc/executor"
 	"github.com/Percona-Lab/go-tpcc/helpers"
+	"os"
+	"runtime/debug"
 	"sync"
-	"fmt"
 	"time"
 )
 
@@ -21,65 +24,221 @@ type Configuration struct {
 	ReportInterval int
 	WareHouses int
 	ScaleFactor float64
+	// Scale sets the cardinalities of the dataset instead of ScaleFactor,
+	// its Warehouses is replaced by WareHouses
+	Scale *ScaleParameters
+	// Partitions splits the tables by warehouse when creating the schema,
+	// PartitionBy is hash or range
+	Partitions int
+	PartitionBy string
+	// ForeignKeys and IndexProfile select the constraints and indexes
+	// created after loading
+	ForeignKeys bool
+	IndexProfile string
+	// Storage selects the table options of the schema
+	Storage databases.Storage
 	PercentFail int
+	QueryTimeout time.Duration
+	TrxTimeout time.Duration
+	// TagQueries tags the statements with the transaction, method and worker
+	TagQueries bool
+	// TraceStatements times the database calls of every transaction
+	TraceStatements bool
+	// Faults are injected into the calls of every worker when set
+	Faults *databases.Faults
+	// Reconnect replaces broken connections with this backoff when set
+	Reconnect *databases.Backoff
+	// ReplicaURIs and ReadPreference route the read-only transactions to
+	// replicas, the workers take turns on the URIs. ReadPreference and
+	// MaxStaleness are for MongoDB, which reads from the main URI without
+	// replica URIs.
+	ReplicaURIs []string
+	ReadPreference string
+	MaxStaleness time.Duration
+	// Arrivals switches the workers to an open loop, nil runs them closed-loop
+	Arrivals *Arrivals
 }
 
 
+// Replicas reports whether the read-only transactions run on replicas
+func (c *Configuration) Replicas() bool {
+	return len(c.ReplicaURIs) > 0 || c.ReadPreference != ""
+}
+
 type Worker struct {
 	cfg *Configuration
 	sc *ScaleParameters
 	threadId  int
 	ex *executor.Executor
+	// replica runs the read-only transactions when there are replicas
+	replica *executor.Executor
+	// tracer times the calls of both executors with TraceStatements
+	tracer *databases.Tracer
+	// reconnector replaces the broken connections of both executors
+	reconnector *databases.Reconnector
 	ctx context.Context
 	wg *sync.WaitGroup
 	c chan Transaction
 	denormalized bool
+	stop chan struct{}
 }
 
 func NewWorker(ctx context.Context, configuration *Configuration, wg *sync.WaitGroup, c chan Transaction, threadId int) (*Worker, error) {
 
-	sc,_ := NewScaleParameters(
-		configuration.ScaleFactor,
-		NUM_ITEMS,
-		configuration.WareHouses,
-		DISTRICTS_PER_WAREHOUSE,
-		CUSTOMERS_PER_DISTRICT,
-		INITIAL_NEW_ORDERS_PER_DISTRICT,
-	)
+	sc, err := configuration.ScaleParameters()
+	if err != nil {
+		return nil, err
+	}
 
 	den := false
 	if configuration.DBDriver == "mongodb" {
 		den = true
 	}
 
-	d, err := databases.NewDatabase(configuration.DBDriver, configuration.URI, configuration.DBName, "a", "b", configuration.Transactions, false)
-	if err != nil {
-		return nil, err
+	options := databases.Options{
+		URI:          configuration.URI,
+		DBName:       configuration.DBName,
+		Transactions: configuration.Transactions,
+		Partitions: databases.Partitioning{
+			Count:      configuration.Partitions,
+			Method:     configuration.PartitionBy,
+			Warehouses: configuration.WareHouses,
+		},
+		ForeignKeys:  configuration.ForeignKeys,
+		IndexProfile: configuration.IndexProfile,
+		Storage:      configuration.Storage,
 	}
-	ex, err := executor.NewExecutor(d,256)
+	if configuration.TagQueries {
+		options.ApplicationName = fmt.Sprintf("go-tpcc worker %d", threadId)
+	}
+
+	var tracer *databases.Tracer
+	if configuration.TraceStatements {
+		tracer = databases.NewTracer()
+	}
+
+	var faults *databases.Faults
+	if configuration.Faults != nil {
+		f := *configuration.Faults
+		// every worker gets its own sequence of faults
+		if f.Seed != 0 {
+			f.Seed += int64(threadId)
+		}
+		faults = &f
+	}
+
+	var reconnector *databases.Reconnector
+	if configuration.Reconnect != nil {
+		reconnector = databases.NewReconnector(*configuration.Reconnect)
+	}
+
+	ex, err := newExecutor(configuration, options, tracer, faults, reconnector)
 	if err != nil {
 		return nil, err
 	}
 
+	var replica *executor.Executor
+	if configuration.Replicas() {
+		if len(configuration.ReplicaURIs) > 0 {
+			options.URI = configuration.ReplicaURIs[threadId%len(configuration.ReplicaURIs)]
+		}
+		options.ReadPreference = configuration.ReadPreference
+		options.MaxStaleness = configuration.MaxStaleness
+		// MongoDB runs transactions on the primary only
+		options.Transactions = options.Transactions && options.ReadPreference == ""
+
+		replicaFaults := faults
+		if faults != nil && faults.Seed != 0 {
+			// the replica connection gets a sequence of its own too, apart
+			// from the primary connections of every worker
+			f := *faults
+			f.Seed += replicaSeedOffset
+			replicaFaults = &f
+		}
+
+		replica, err = newExecutor(configuration, options, tracer, replicaFaults, reconnector)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to the replica: %w", err)
+		}
+	}
+
 	w := &Worker {
 		threadId:	threadId,
 		cfg: configuration,
 		sc: sc,
 		ex: ex,
+		replica: replica,
+		tracer: tracer,
+		reconnector: reconnector,
 		ctx: ctx,
 		wg: wg,
 		c: c,
 		denormalized: den,
+		stop: make(chan struct{}),
 	}
 
 	return w, nil
 }
 
+// replicaSeedOffset moves the fault seeds of the replica connections past the
+// ones of the primary connections, which are the seed plus the thread id
+const replicaSeedOffset = 1 << 32
+
+// newExecutor connects to the database with options and applies the
+// interceptors of the configuration. tracer, faults and reconnector may be
+// nil.
+func newExecutor(configuration *Configuration, options databases.Options, tracer *databases.Tracer, faults *databases.Faults, reconnector *databases.Reconnector) (*executor.Executor, error) {
+	open := func() (databases.Database, error) {
+		return databases.NewDatabase(configuration.DBDriver, options)
+	}
+
+	if faults != nil {
+		fi, err := databases.NewFaultInjector(*faults)
+		if err != nil {
+			return nil, err
+		}
+		open = fi.Open(open)
+	}
+
+	d, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	// the faults are inside, so a dropped connection is reconnected
+	if reconnector != nil {
+		d = reconnector.Wrap(d, open)
+	}
+
+	// before the other interceptors so they are not timed, the faults and
+	// reconnects are
+	if tracer != nil {
+		d = databases.Intercept(d, tracer.Interceptor())
+	}
+
+	if configuration.QueryTimeout > 0 {
+		d = databases.Intercept(d, databases.QueryTimeout(configuration.QueryTimeout))
+	}
+
+	if configuration.TagQueries {
+		d = databases.Intercept(d, databases.Tagging())
+	}
+
+	ex, err := executor.NewExecutor(d,256)
+	if err != nil {
+		return nil, err
+	}
+	ex.ChangeTransactions(options.Transactions)
+
+	return ex, nil
+}
+
 type ScaleParameters struct {
 	Items int
 	Warehouses int
 	DistrictsPerWarehouse int
 	CustomersPerDistrict int
+	OrdersPerDistrict int
 	NewOrdersPerDistrict int
 }
 
@@ -89,20 +248,87 @@ func NewScaleParameters(
 	warehouses int,
 	districtsPerWarehouse int,
 	customersPerDistrict int,
+	ordersPerDistrict int,
 	newOrdersPerDistrict int,
 ) (*ScaleParameters, error) {
+	if scaleFactor <= 0 {
+		return nil, fmt.Errorf("scalefactor must be positive, got %v", scaleFactor)
+	}
+
 	s := &ScaleParameters{
 		Items:                 int(float64(items) / scaleFactor),
 		DistrictsPerWarehouse: districtsPerWarehouse,
 		CustomersPerDistrict:  int(float64(customersPerDistrict)/scaleFactor),
+		OrdersPerDistrict:     int(float64(ordersPerDistrict)/scaleFactor),
 		NewOrdersPerDistrict:  int(float64(newOrdersPerDistrict)/scaleFactor),
 		Warehouses: warehouses,
 	}
 
 	return s, nil
 }
+
+// DefaultScaleParameters returns the TPC-C cardinalities divided by the
+// scale factor
+func DefaultScaleParameters(scaleFactor float64, warehouses int) (*ScaleParameters, error) {
+	if scaleFactor == 0 {
+		scaleFactor = 1
+	}
+
+	return NewScaleParameters(
+		scaleFactor,
+		NUM_ITEMS,
+		warehouses,
+		DISTRICTS_PER_WAREHOUSE,
+		CUSTOMERS_PER_DISTRICT,
+		INITIAL_ORDERS_PER_DISTRICT,
+		INITIAL_NEW_ORDERS_PER_DISTRICT,
+	)
+}
+
+// ScaleParameters returns the validated cardinalities of the configured
+// dataset
+func (c *Configuration) ScaleParameters() (*ScaleParameters, error) {
+	var s *ScaleParameters
+	if c.Scale != nil {
+		scale := *c.Scale
+		scale.Warehouses = c.WareHouses
+		s = &scale
+	} else {
+		var err error
+		s, err = DefaultScaleParameters(c.ScaleFactor, c.WareHouses)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, s.Validate()
+}
+
+// Validate checks that the cardinalities make a usable dataset
+func (s *ScaleParameters) Validate() error {
+	switch {
+	case s.Items < MAX_OL_CNT:
+		// New-Order needs up to MAX_OL_CNT items
+		return fmt.Errorf("items must be at least %d, got %d", MAX_OL_CNT, s.Items)
+	case s.DistrictsPerWarehouse < 1 || s.DistrictsPerWarehouse > DISTRICTS_PER_WAREHOUSE:
+		// STOCK has S_DIST_01 to S_DIST_10 only
+		return fmt.Errorf("districts per warehouse must be between 1 and %d, got %d", DISTRICTS_PER_WAREHOUSE, s.DistrictsPerWarehouse)
+	case s.CustomersPerDistrict < 1:
+		return fmt.Errorf("customers per district must be at least 1, got %d", s.CustomersPerDistrict)
+	case s.OrdersPerDistrict < 1:
+		return fmt.Errorf("orders per district must be at least 1, got %d", s.OrdersPerDistrict)
+	case s.NewOrdersPerDistrict < 0 || s.NewOrdersPerDistrict > s.OrdersPerDistrict:
+		// the new orders are the most recent of the initial orders
+		return fmt.Errorf("new orders per district must be between 0 and the %d orders per district, got %d", s.OrdersPerDistrict, s.NewOrdersPerDistrict)
+	}
+
+	return nil
+}
 type TransactionType int
 
+// closeTimeout bounds closing the connections of a worker
+const closeTimeout = 5 * time.Second
+
 const (
 	StockLevelTrx = iota
 	DeliveryTrx
@@ -111,11 +337,58 @@ const (
 	NewOrderTrx
 )
 
+// TransactionTypes lists every transaction type in the order they are reported
+var TransactionTypes = []TransactionType{StockLevelTrx, DeliveryTrx, OrderStatusTrx, PaymentTrx, NewOrderTrx}
+
+func (t TransactionType) String() string {
+	switch t {
+	case StockLevelTrx:
+		return "StockLevel"
+	case DeliveryTrx:
+		return "Delivery"
+	case OrderStatusTrx:
+		return "OrderStatus"
+	case PaymentTrx:
+		return "Payment"
+	case NewOrderTrx:
+		return "NewOrder"
+	default:
+		return "Unknown"
+	}
+}
+
+// ReadOnly reports whether transactions of type t only read, so they can
+// run on a replica
+func (t TransactionType) ReadOnly() bool {
+	return t == StockLevelTrx || t == OrderStatusTrx
+}
+
+// ErrPanic is the error of a transaction that panicked
+var ErrPanic = errors.New("transaction panicked")
+
 type Transaction struct {
 	ThreadId int
 	Type TransactionType
 	Failed bool
+	// TimedOut is set when the transaction failed because it ran into
+	// --query-timeout or --trx-timeout
+	TimedOut bool
+	// Retries is how many times the transaction was retried after a conflict
+	Retries int
+	// Error is the class of the error the transaction failed with
+	Error databases.ErrorClass
+	// Time is the latency in milliseconds. In an open-loop run it is measured
+	// from the intended start, so it includes QueueTime.
 	Time float64
+	// QueueTime is how long an open-loop transaction waited for a free worker
+	QueueTime float64
+	// Replica is set when the transaction ran on a replica
+	Replica bool
+	// Calls are the database calls of the transaction with TraceStatements,
+	// those of the retries included
+	Calls []databases.Call
+	// Downtimes are the lost connections the transaction reconnected
+	Downtimes []databases.Downtime
 }
 
 func (w *Worker) Execute() {
@@ -124,60 +397,150 @@ func (w *Worker) Execute() {
 		select {
 		case <- w.ctx.Done():
 			return
+		case <- w.stop:
+			return
 		default:
 			t := time.Now()
-			var status error
+			var queueTime float64
+			if w.cfg.Arrivals != nil {
+				intended, err := w.cfg.Arrivals.Next(w.ctx)
+				if err != nil {
+					return
+				}
+				t = intended
+				queueTime = float64(time.Now().Sub(t).Nanoseconds())/1e6
+			}
+
+			ctx, cancel := w.trxContext()
 			trx := Transaction{
 				ThreadId: w.threadId,
+				QueueTime: queueTime,
 			}
-			switch r := helpers.RandInt(1, 100); {
-			case r <= 4:
-				trx.Type = StockLevelTrx
-				status = w.DoStockLevelTrx()
-			case r <= 8:
-				trx.Type = DeliveryTrx
-				status = w.DoDelivery()
-			case r <= 12:
-				trx.Type = OrderStatusTrx
-				status = w.DoOrderStatus()
-			case r <= 55:
-				trx.Type = PaymentTrx
-				status = w.DoPayment()
-			default:
-				trx.Type = NewOrderTrx
-				status = w.DoNewOrder()
-			}
-
+			status := w.doTransaction(ctx, &trx)
 
 			trx.Time = float64(time.Now().Sub(t).Nanoseconds())/1e6
 
+			ex := w.executorFor(trx.Type)
+			trx.Replica = ex == w.replica
+			if w.tracer != nil {
+				trx.Calls = w.tracer.Take()
+			}
+			if w.reconnector != nil {
+				trx.Downtimes = w.reconnector.Take()
+			}
+
 			trx.Failed = false
 			if status != nil {
 				trx.Failed = true
+				trx.TimedOut = ctx.Err() == context.DeadlineExceeded || errors.Is(status, context.DeadlineExceeded)
+				trx.Error = ex.Classify(status)
 			}
+			trx.Retries = ex.LastRetries()
+			cancel()
 
 			w.c <- trx
 		}
 	}
 }
 
-func (w *Worker) DoStockLevelTrx() error {
+// doTransaction picks and runs one transaction of the TPC-C mix. A panic
+// fails only this transaction, not the whole run.
+func (w *Worker) doTransaction(ctx context.Context, trx *Transaction) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "thread %d: %s transaction panicked: %v\n%s", w.threadId, trx.Type, r, debug.Stack())
+			err = fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+
+	switch r := helpers.RandInt(1, 100); {
+	case r <= 4:
+		trx.Type = StockLevelTrx
+		return w.DoStockLevelTrx(w.tagged(ctx, trx.Type))
+	case r <= 8:
+		trx.Type = DeliveryTrx
+		return w.DoDelivery(w.tagged(ctx, trx.Type))
+	case r <= 12:
+		trx.Type = OrderStatusTrx
+		return w.DoOrderStatus(w.tagged(ctx, trx.Type))
+	case r <= 55:
+		trx.Type = PaymentTrx
+		return w.DoPayment(w.tagged(ctx, trx.Type))
+	default:
+		trx.Type = NewOrderTrx
+		return w.DoNewOrder(w.tagged(ctx, trx.Type))
+	}
+}
+
+// executorFor returns the executor transactions of type t run on
+func (w *Worker) executorFor(t TransactionType) *executor.Executor {
+	if w.replica != nil && t.ReadOnly() {
+		return w.replica
+	}
+
+	return w.ex
+}
+
+// tagged tags the statements of a transaction of type t when TagQueries is
+// set
+func (w *Worker) tagged(ctx context.Context, t TransactionType) context.Context {
+	if !w.cfg.TagQueries {
+		return ctx
+	}
+
+	return databases.WithTag(ctx, databases.Tag{Transaction: t.String(), Worker: w.threadId})
+}
+
+// Stop makes the worker return after the transaction it is running, unlike
+// cancelling its context which aborts that transaction. Stop must be called
+// at most once.
+func (w *Worker) Stop() {
+	close(w.stop)
+}
+
+// Close closes the connections of the worker once it returned from Execute,
+// waiting at most closeTimeout
+func (w *Worker) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+
+	err := w.ex.Close(ctx)
+	if w.replica != nil {
+		if rerr := w.replica.Close(ctx); err == nil {
+			err = rerr
+		}
+	}
+
+	return err
+}
+
+// trxContext returns the context a single transaction runs with, limited by
+// --trx-timeout when it is set
+func (w *Worker) trxContext() (context.Context, context.CancelFunc) {
+	if w.cfg.TrxTimeout > 0 {
+		return context.WithTimeout(w.ctx, w.cfg.TrxTimeout)
+	}
+
+	return context.WithCancel(w.ctx)
+}
+
+func (w *Worker) DoStockLevelTrx(ctx context.Context) error {
 	warehouseId := helpers.RandInt(1, w.sc.Warehouses)
 	districtId := helpers.RandInt(1, w.sc.DistrictsPerWarehouse)
 	threshold := helpers.RandInt(MIN_STOCK_LEVEL_THRESHOLD, MAX_STOCK_LEVEL_THRESHOLD)
 
-	return w.ex.DoStockLevelTrx(warehouseId, districtId, threshold)
+	return w.executorFor(StockLevelTrx).DoStockLevelTrx(ctx, warehouseId, districtId, threshold)
 }
 
-func (w *Worker) DoDelivery() error {
+func (w *Worker) DoDelivery(ctx context.Context) error {
 	warehouseId := helpers.RandInt(1, w.sc.Warehouses)
 	OCarrierId := helpers.RandInt(MIN_CARRIER_ID, MAX_CARRIER_ID)
 	OlDeliveryD := time.Now()
 
-	return w.ex.DoDelivery(warehouseId, OCarrierId, OlDeliveryD, w.sc.DistrictsPerWarehouse)
+	return w.ex.DoDeliveryTrx(ctx, warehouseId, OCarrierId, OlDeliveryD, w.sc.DistrictsPerWarehouse)
 }
 
-func (w *Worker) DoOrderStatus() error {
+func (w *Worker) DoOrderStatus(ctx context.Context) error {
 	wId := helpers.RandInt(1, w.sc.Warehouses)
 	dId := helpers.RandInt(1, w.sc.DistrictsPerWarehouse)
 	cId := 0
@@ -194,10 +557,10 @@ func (w *Worker) DoOrderStatus() error {
 		cId = helpers.RandInt(1, w.sc.CustomersPerDistrict)
 	}
 
-	return w.ex.DoOrderStatus(wId, dId, cId, cLast)
+	return w.executorFor(OrderStatusTrx).DoOrderStatusTrx(ctx, wId, dId, cId, cLast)
 }
 
-func (w *Worker) DoPayment() error {
+func (w *Worker) DoPayment(ctx context.Context) error {
 	wId := helpers.RandInt(1, w.sc.Warehouses)
 	dId := helpers.RandInt(1, w.sc.DistrictsPerWarehouse)
 	cWId := 0
@@ -226,10 +589,10 @@ func (w *Worker) DoPayment() error {
 		cId = helpers.RandInt(1, w.sc.CustomersPerDistrict)
 	}
 
-	return w.ex.DoPayment(wId, dId, hAmount, cWId, cDId, cId, cLast, hDate, BAD_CREDIT, MAX_C_DATA)
+	return w.ex.DoPaymentTrx(ctx, wId, dId, hAmount, cWId, cDId, cId, cLast, hDate, BAD_CREDIT, MAX_C_DATA)
 }
 
-func (w *Worker) DoNewOrder() error {
+func (w *Worker) DoNewOrder(ctx context.Context) error {
 	wId := helpers.RandInt(1, w.sc.Warehouses)
 	dId := helpers.RandInt(1, w.sc.DistrictsPerWarehouse)
 	cId := helpers.RandInt(1, w.sc.CustomersPerDistrict)
@@ -264,13 +627,37 @@ func (w *Worker) DoNewOrder() error {
 		iQtys = append(iQtys, helpers.RandInt(1, MAX_OL_QUANTITY))
 	}
 
-	return w.ex.DoNewOrder(wId, dId, cId, oEntryD, iIds, iWIds, iQtys)
+	return w.ex.DoNewOrderTrx(ctx, wId, dId, cId, oEntryD, iIds, iWIds, iQtys)
 }
 
+// CreateIndexes creates the indexes and then the foreign keys one by one
 func (w *Worker) CreateIndexes() error {
-	return w.ex.CreateIndexes()
+	for _, index := range w.Indexes() {
+		err := w.CreateIndex(index, false)
+		if err != nil {
+			return fmt.Errorf("creating %s: %w", index, err)
+		}
+	}
+
+	return nil
+}
+
+func (w *Worker) Indexes() []databases.Index {
+	return w.ex.Indexes()
+}
+
+func (w *Worker) CreateIndex(index databases.Index, online bool) error {
+	return w.ex.CreateIndex(w.ctx, index, online)
 }
 
 func (w *Worker) CreateSchema() error {
-	return w.ex.CreateSchema()
+	return w.ex.CreateSchema(w.ctx)
+}
+
+func (w *Worker) DropSchema() error {
+	return w.ex.DropSchema(w.ctx)
+}
+
+func (w *Worker) TruncateSchema() error {
+	return w.ex.TruncateSchema(w.ctx)
 }
@@ -0,0 +1,238 @@
+package tpcc
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Percona-Lab/go-tpcc/databases"
+	"github.com/Percona-Lab/go-tpcc/databases/memory"
+)
+
+// newTestWorker loads two warehouses of a hundredth of the TPC-C size into
+// the memory database name, seeding the random source with seed first, and
+// returns a worker on it
+func newTestWorker(t *testing.T, ctx context.Context, name string, seed int64, c chan Transaction) *Worker {
+	t.Helper()
+
+	memory.Drop(name)
+	t.Cleanup(func() { memory.Drop(name) })
+
+	rand.Seed(seed)
+
+	conf := &Configuration{
+		DBDriver:     "memory",
+		URI:          "memory",
+		DBName:       name,
+		Transactions: true,
+		WareHouses:   2,
+		ScaleFactor:  100,
+		PercentFail:  1,
+	}
+
+	w, err := NewWorker(ctx, conf, &sync.WaitGroup{}, c, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.CreateSchema(); err != nil {
+		t.Fatal(err)
+	}
+	w.LoadItems()
+	for id := 1; id <= conf.WareHouses; id++ {
+		if err := w.LoadWarehouse(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return w
+}
+
+// snapshot returns the state of the memory database name
+func snapshot(t *testing.T, name string) *memory.Snapshot {
+	t.Helper()
+
+	db, err := memory.NewMemory(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db.Snapshot()
+}
+
+func TestWorkerExecute(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := make(chan Transaction)
+	w := newTestWorker(t, ctx, t.Name(), time.Now().UnixNano(), c)
+	loaded := snapshot(t, t.Name())
+
+	w.wg.Add(1)
+	go w.Execute()
+
+	succeeded := make(map[TransactionType]int)
+	for i := 0; i < 500; i++ {
+		trx := <-c
+		if !trx.Failed {
+			succeeded[trx.Type]++
+		}
+
+		// the dataset is too small for some of the customer names, and
+		// New-Order uses an invalid item on purpose
+		if trx.Failed && trx.Error != databases.ClassNotFound && trx.Error != databases.ClassRollback {
+			t.Errorf("transaction of type %d failed with %s", trx.Type, trx.Error)
+		}
+	}
+
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-c:
+		case <-done:
+			running = false
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+
+	for _, trxType := range []TransactionType{StockLevelTrx, DeliveryTrx, OrderStatusTrx, PaymentTrx, NewOrderTrx} {
+		if succeeded[trxType] == 0 {
+			t.Errorf("no transaction of type %d succeeded: %v", trxType, succeeded)
+		}
+	}
+
+	checkConsistency(t, loaded, snapshot(t, t.Name()))
+}
+
+// TestSeededRun runs the same seeded transactions twice, single-threaded,
+// and compares the final states. Their agreement is what makes the memory
+// driver usable as an oracle for the other drivers.
+func TestSeededRun(t *testing.T) {
+	run := func(name string) *memory.Snapshot {
+		w := newTestWorker(t, context.Background(), name, 42, nil)
+		loaded := snapshot(t, name)
+
+		transactions := []func(context.Context) error{w.DoStockLevelTrx, w.DoDelivery, w.DoOrderStatus, w.DoPayment, w.DoNewOrder}
+		for i := 0; i < 500; i++ {
+			transactions[i%len(transactions)](context.Background())
+		}
+
+		s := snapshot(t, name)
+		if len(s.Orders) <= len(loaded.Orders) {
+			t.Fatal("the run did not add any order")
+		}
+		checkConsistency(t, loaded, s)
+		clearTimes(s)
+
+		return s
+	}
+
+	a := run(t.Name() + "/a")
+	b := run(t.Name() + "/b")
+
+	if !reflect.DeepEqual(a, b) {
+		t.Error("the seeded runs ended in different states")
+	}
+}
+
+// checkConsistency checks the consistency conditions of TPC-C 3.3.2. W_YTD
+// is compared as a change since loading, the loader does not make it the sum
+// of D_YTD.
+func checkConsistency(t *testing.T, loaded *memory.Snapshot, s *memory.Snapshot) {
+	t.Helper()
+
+	type district struct{ w, d int }
+
+	ytd := make(map[int]float64)
+	for _, w := range s.Warehouses {
+		ytd[w.W_ID] += w.W_YTD
+	}
+	for _, w := range loaded.Warehouses {
+		ytd[w.W_ID] -= w.W_YTD
+	}
+	for _, d := range s.Districts {
+		ytd[d.D_W_ID] -= d.D_YTD
+	}
+	for _, d := range loaded.Districts {
+		ytd[d.D_W_ID] += d.D_YTD
+	}
+	for w, diff := range ytd {
+		if math.Abs(diff) > 1e-6 {
+			t.Errorf("warehouse %d: W_YTD and the D_YTD of its districts changed by amounts %v apart", w, diff)
+		}
+	}
+
+	maxOrder := make(map[district]int)
+	olCount := make(map[district]int)
+	delivered := make(map[district]map[int]bool)
+	for _, o := range s.Orders {
+		k := district{o.O_W_ID, o.O_D_ID}
+		if o.O_ID > maxOrder[k] {
+			maxOrder[k] = o.O_ID
+		}
+		olCount[k] += o.O_OL_CNT
+		if delivered[k] == nil {
+			delivered[k] = make(map[int]bool)
+		}
+		delivered[k][o.O_ID] = o.O_CARRIER_ID != NULL_CARRIER_ID
+	}
+
+	newOrders := make(map[district][]int)
+	for _, no := range s.NewOrders {
+		k := district{no.NO_W_ID, no.NO_D_ID}
+		newOrders[k] = append(newOrders[k], no.NO_O_ID)
+		if done, ok := delivered[k][no.NO_O_ID]; !ok || done {
+			t.Errorf("district %v: new order %d is not an undelivered order", k, no.NO_O_ID)
+		}
+	}
+
+	lines := make(map[district]int)
+	for _, ol := range s.OrderLines {
+		lines[district{ol.OL_W_ID, ol.OL_D_ID}]++
+	}
+
+	for _, d := range s.Districts {
+		k := district{d.D_W_ID, d.D_ID}
+		if d.D_NEXT_O_ID-1 != maxOrder[k] {
+			t.Errorf("district %v: D_NEXT_O_ID is %d, the last order %d", k, d.D_NEXT_O_ID, maxOrder[k])
+		}
+
+		// the new orders are the undelivered orders, the most recent ones
+		ids := newOrders[k]
+		if len(ids) > 0 && (ids[len(ids)-1] != maxOrder[k] || ids[len(ids)-1]-ids[0]+1 != len(ids)) {
+			t.Errorf("district %v: new orders %v are not the orders %d and before", k, ids, maxOrder[k])
+		}
+
+		if olCount[k] != lines[k] {
+			t.Errorf("district %v: the orders have %d lines, there are %d", k, olCount[k], lines[k])
+		}
+	}
+}
+
+// clearTimes zeroes the dates, which are set from the clock
+func clearTimes(s *memory.Snapshot) {
+	for i := range s.Customers {
+		s.Customers[i].C_SINCE = time.Time{}
+	}
+	for i := range s.History {
+		s.History[i].H_DATE = time.Time{}
+	}
+	for i := range s.Orders {
+		s.Orders[i].O_ENTRY_D = time.Time{}
+	}
+	for i := range s.OrderLines {
+		s.OrderLines[i].OL_DELIVERY_D = time.Time{}
+	}
+}